@@ -0,0 +1,159 @@
+// alert.go
+// URL Shortener with MySQL database.
+//
+// Copyright (C) 2020 iDigitalFlame
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+//
+
+package linker
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"sync"
+)
+
+// weight is the weight of the newest hit count in the moving average of the hit counts of a name.
+const weight = 0.2
+
+type alerts struct {
+	lock      sync.RWMutex
+	average   map[string]float64
+	disabled  map[string]struct{}
+	report    *reporter
+	webhook   string
+	factor    float64
+	threshold uint64
+	disable   bool
+}
+type alert struct {
+	Name     string  `json:"name"`
+	Hits     uint64  `json:"hits"`
+	Average  float64 `json:"average"`
+	Disabled bool    `json:"disabled"`
+}
+type alertsConfig struct {
+	Webhook   string  `json:"webhook"`
+	Factor    float64 `json:"factor"`
+	Threshold uint32  `json:"threshold"`
+	Disable   bool    `json:"disable"`
+}
+
+func (a *alerts) load(c alertsConfig) {
+	if c.Threshold == 0 {
+		return
+	}
+	a.threshold, a.factor, a.webhook, a.disable = uint64(c.Threshold), c.Factor, c.Webhook, c.Disable
+	a.average, a.disabled = make(map[string]float64), make(map[string]struct{})
+}
+func (a *alerts) blocked(n string) bool {
+	if a.disabled == nil {
+		return false
+	}
+	a.lock.RLock()
+	_, ok := a.disabled[n]
+	a.lock.RUnlock()
+	return ok
+}
+func (a *alerts) check(h map[string]uint64) {
+	if a.average == nil {
+		return
+	}
+	var v []alert
+	a.lock.Lock()
+	// Names without hits in this interval decay towards zero and are removed once their average is below a hit,
+	// so the averages do not keep every name that was ever requested.
+	for n, e := range a.average {
+		if _, ok := h[n]; ok {
+			continue
+		}
+		if e *= 1 - weight; e < 1 {
+			delete(a.average, n)
+		} else {
+			a.average[n] = e
+		}
+	}
+	for n, c := range h {
+		e, ok := a.average[n]
+		if ok {
+			a.average[n] = e*(1-weight) + float64(c)*weight
+		} else {
+			a.average[n] = float64(c)
+		}
+		if c < a.threshold || (a.factor > 0 && ok && float64(c) <= e*a.factor) {
+			continue
+		}
+		if a.disable {
+			a.disabled[n] = struct{}{}
+		}
+		v = append(v, alert{Name: n, Hits: c, Average: e, Disabled: a.disable})
+	}
+	a.lock.Unlock()
+	for i := range v {
+		os.Stderr.WriteString(`Name "` + v[i].Name + `" received ` + strconv.FormatUint(v[i].Hits, 10) +
+			" hits in the last interval (average " + strconv.FormatFloat(v[i].Average, 'f', 1, 64) + ")!\n")
+		if len(a.webhook) > 0 {
+			go a.send(v[i])
+		}
+	}
+}
+
+// Blocked returns the names that were disabled by an alert, sorted by name. Disabled names are only kept in memory,
+// so they are enabled again when Linker is restarted or when Unblock is called.
+func (l *Linker) Blocked() []string {
+	a := &l.alerts
+	if a.disabled == nil {
+		return nil
+	}
+	a.lock.RLock()
+	v := make([]string, 0, len(a.disabled))
+	for n := range a.disabled {
+		v = append(v, n)
+	}
+	a.lock.RUnlock()
+	sort.Strings(v)
+	return v
+}
+
+// Unblock will enable the supplied name again after it was disabled by an alert. This function returns false if the
+// name was not disabled.
+func (l *Linker) Unblock(n string) bool {
+	a := &l.alerts
+	if a.disabled == nil {
+		return false
+	}
+	a.lock.Lock()
+	_, ok := a.disabled[n]
+	delete(a.disabled, n)
+	a.lock.Unlock()
+	return ok
+}
+func (a *alerts) send(v alert) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return
+	}
+	c := http.Client{Timeout: defaultTimeout}
+	r, err := c.Post(a.webhook, "application/json", bytes.NewReader(b))
+	if err != nil {
+		a.report.error("Unable to send alert webhook", err)
+		return
+	}
+	r.Body.Close()
+}
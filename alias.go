@@ -0,0 +1,120 @@
+// alias.go
+// URL Shortener with MySQL database.
+//
+// Copyright (C) 2020 iDigitalFlame
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+//
+
+package linker
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"time"
+)
+
+// maxAlias is the longest chain of aliases that is followed before a redirect fails.
+const maxAlias = 8
+
+const aliasPrefix = "link:"
+
+var errAliasLoop = &errval{s: "alias chain is too long or contains a loop"}
+
+func aliased(u string) (string, bool) {
+	if len(u) <= len(aliasPrefix) || !strings.EqualFold(u[:len(aliasPrefix)], aliasPrefix) {
+		return "", false
+	}
+	return u[len(aliasPrefix):], true
+}
+func (l *Linker) target(n, u string) (string, error) {
+	t, ok := aliased(strings.TrimSpace(u))
+	if !ok {
+		return l.parse(u)
+	}
+	if !validName(t) {
+		return "", &errval{s: `alias target "` + t + `" contains invalid characters`}
+	}
+	for i, s := 0, t; ; i++ {
+		if s == n {
+			return "", &errval{s: `alias "` + n + `" to "` + t + `" would create a loop`}
+		}
+		if i >= maxAlias {
+			return "", errAliasLoop
+		}
+		v, err := l.db.get(context.Background(), s)
+		if err == sql.ErrNoRows {
+			return "", &errval{s: `alias target "` + s + `" does not exist`}
+		}
+		if err != nil {
+			return "", err
+		}
+		if s, ok = aliased(v.url); !ok {
+			break
+		}
+	}
+	return aliasPrefix + t, nil
+}
+
+// chase follows the alias chain of the supplied record. The rollout and schedule of every link in the chain are
+// picked before its URL is followed, so a link reached through an alias keeps its gradual rollout. Only the
+// destination is taken from the target, so the referrers, signing key and headers of the requested name are kept.
+func (l *Linker) chase(x context.Context, v record) (record, error) {
+	n := time.Now()
+	for i := 0; ; i++ {
+		v.url = v.roll.pick(n, v.url)
+		if u := scheduled(v.sched, n); len(u) > 0 {
+			v.url = u
+		}
+		t, ok := aliased(v.url)
+		if !ok {
+			return v, nil
+		}
+		if i >= maxAlias {
+			return record{}, errAliasLoop
+		}
+		d, err := l.fetch(x, t)
+		if err != nil {
+			return record{}, err
+		}
+		v.url, v.app, v.sched, v.roll = d.url, d.app, d.sched, d.roll
+	}
+}
+
+// resolved returns a copy of the supplied links with alias URLs replaced by the URL of the link they point to, so
+// they can be written as server configuration. Aliases that cannot be resolved from the list are removed.
+func resolved(v []Link) []Link {
+	m := make(map[string]string, len(v))
+	for i := range v {
+		m[v[i].Name] = v[i].URL
+	}
+	r := make([]Link, 0, len(v))
+	for i := range v {
+		u, ok := v[i].URL, true
+		for x := 0; ok && x <= maxAlias; x++ {
+			var t string
+			if t, ok = aliased(u); ok {
+				u = m[t]
+			}
+		}
+		if _, a := aliased(u); a || len(u) == 0 {
+			continue
+		}
+		e := v[i]
+		e.URL = u
+		r = append(r, e)
+	}
+	return r
+}
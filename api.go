@@ -0,0 +1,213 @@
+// api.go
+// URL Shortener with MySQL database.
+//
+// Copyright (C) 2020 iDigitalFlame
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+//
+
+package linker
+
+import (
+	"bytes"
+	"crypto/subtle"
+	"encoding/json"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+const defaultAPIPath = "/api/v1"
+
+type api struct {
+	path  string
+	token string
+}
+type apiConfig struct {
+	Path  string `json:"path"`
+	Token string `json:"token"`
+}
+
+func (a *api) load(c apiConfig) error {
+	if a.token = c.Token; len(a.token) == 0 {
+		a.token = os.Getenv("LINKER_API_TOKEN")
+	}
+	if len(a.token) == 0 {
+		return nil
+	}
+	if a.path = strings.TrimSuffix(c.Path, "/"); len(a.path) == 0 {
+		a.path = defaultAPIPath
+	}
+	if a.path[0] != '/' {
+		return &errval{s: `invalid API path "` + c.Path + `"`}
+	}
+	return nil
+}
+func (a *api) allowed(r *http.Request) bool {
+	h := r.Header.Get("Authorization")
+	if len(h) < 7 || !strings.EqualFold(h[:7], "bearer ") {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(strings.TrimSpace(h[7:])), []byte(a.token)) == 1
+}
+func (l *Linker) called(w http.ResponseWriter, r *http.Request) {
+	defer l.recovered(w, r)
+	if r.Body.Close(); r.ContentLength > l.body {
+		failTooLarge.json(w)
+		return
+	}
+	l.lock.RLock()
+	ok, p := l.api.allowed(r), l.api.path
+	if l.lock.RUnlock(); !ok {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="linker"`)
+		failUnauthorized.json(w)
+		return
+	}
+	switch r.URL.Path[len(p):] {
+	case "/version":
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			failMethod.json(w)
+			return
+		}
+		reply(w, Info())
+	case "/queries":
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			failMethod.json(w)
+			return
+		}
+		v := l.Statements()
+		if v == nil {
+			v = []Statement{}
+		}
+		reply(w, struct {
+			Statements []Statement `json:"statements"`
+			Stale      uint64      `json:"stale"`
+		}{v, l.Stale()})
+	case "/quit":
+		if r.Method != http.MethodPost {
+			failMethod.json(w)
+			return
+		}
+		if l.quit == nil {
+			failure{"not_listening", "The HTTP service was not started by Listen.", http.StatusConflict}.json(w)
+			return
+		}
+		reply(w, struct {
+			Drain duration `json:"drain"`
+		}{duration(l.delay)})
+		l.Quit()
+	case "/reload":
+		if r.Method != http.MethodPost {
+			failMethod.json(w)
+			return
+		}
+		v, err := l.Reload()
+		if err != nil {
+			l.report.error("Unable to reload the configuration", err)
+			failure{"reload_failed", err.Error(), http.StatusInternalServerError}.json(w)
+			return
+		}
+		if v == nil {
+			v = []Change{}
+		}
+		reply(w, struct {
+			Changes []Change `json:"changes"`
+		}{v})
+	case "/alerts":
+		switch r.Method {
+		case http.MethodGet, http.MethodHead:
+		case http.MethodDelete:
+			if !l.Unblock(r.URL.Query().Get("name")) {
+				failure{"not_disabled", `The "name" was not disabled by an alert.`, http.StatusNotFound}.json(w)
+				return
+			}
+		default:
+			failMethod.json(w)
+			return
+		}
+		v := l.Blocked()
+		if v == nil {
+			v = []string{}
+		}
+		reply(w, struct {
+			Disabled []string `json:"disabled"`
+		}{v})
+	case "/campaigns":
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			failMethod.json(w)
+			return
+		}
+		l.campaigns(w, r)
+	default:
+		failNotFound.json(w)
+	}
+}
+func (l *Linker) campaigns(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	f, err := time.Parse(dateFormat, q.Get("from"))
+	if err != nil {
+		failure{"invalid_date", `The "from" date must be a YYYY-MM-DD date.`, http.StatusBadRequest}.json(w)
+		return
+	}
+	t := time.Now().UTC()
+	if s := q.Get("to"); len(s) > 0 {
+		if t, err = time.Parse(dateFormat, s); err != nil || t.Before(f) {
+			failure{"invalid_date", `The "to" date must be a YYYY-MM-DD date after "from".`, http.StatusBadRequest}.json(w)
+			return
+		}
+	}
+	o := JSON
+	if s := q.Get("format"); len(s) > 0 {
+		if o, err = ParseFormat(s); err != nil || (o != JSON && o != CSV && o != XLSX) {
+			failure{"invalid_format", `The "format" must be "json", "csv" or "xlsx".`, http.StatusBadRequest}.json(w)
+			return
+		}
+	}
+	v, err := l.Campaigns(f, t)
+	if err != nil {
+		l.report.error("Unable to create the campaign report", err)
+		failInternal.json(w)
+		return
+	}
+	var b bytes.Buffer
+	if err = o.WriteCampaigns(&b, v); err != nil {
+		l.report.error("Unable to write the campaign report", err)
+		failInternal.json(w)
+		return
+	}
+	switch w.Header().Set("Cache-Control", "no-store"); o {
+	case CSV:
+		w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+		w.Header().Set("Content-Disposition", `attachment; filename="campaigns.csv"`)
+	case XLSX:
+		w.Header().Set("Content-Type", "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet")
+		w.Header().Set("Content-Disposition", `attachment; filename="campaigns.xlsx"`)
+	default:
+		w.Header().Set("Content-Type", "application/json")
+	}
+	w.WriteHeader(http.StatusOK)
+	w.Write(b.Bytes())
+}
+func reply(w http.ResponseWriter, v interface{}) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		failInternal.json(w)
+		return
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(b)
+}
@@ -0,0 +1,88 @@
+// app.go
+// URL Shortener with MySQL database.
+//
+// Copyright (C) 2020 iDigitalFlame
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+//
+
+package linker
+
+import (
+	"encoding/json"
+	"html"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+var mobiles = [...]string{"android", "iphone", "ipad", "ipod", "mobile"}
+
+// SetApp will change the mobile app deep link URL (such as "myapp://item/1") of the redirect with the supplied
+// name. Requests from mobile devices for a redirect with an app URL get a page that opens the app URL and falls
+// back to the redirect URL. An empty string will remove the app URL. This function will return an error if the
+// change fails, the app URL is invalid or the name does not exist.
+func (l *Linker) SetApp(n, a string) error {
+	if l.db == nil {
+		return errNotConfigured
+	}
+	if !validName(n) {
+		return &errval{s: `name "` + n + `" contains invalid characters`}
+	}
+	if a = strings.TrimSpace(a); len(a) > 0 {
+		u, err := url.Parse(a)
+		if err != nil {
+			return &errval{s: `invalid app URL "` + a + `"`, e: err}
+		}
+		switch strings.ToLower(u.Scheme) {
+		case "":
+			return &errval{s: `app URL "` + a + `" does not contain a scheme`}
+		case "javascript", "data", "vbscript", "file":
+			return &errval{s: `app URL "` + a + `" uses an unsupported scheme`}
+		}
+		for i := 0; i < len(a); i++ {
+			if a[i] < 0x21 || a[i] == 0x7F {
+				return &errval{s: `app URL "` + a + `" contains invalid characters`}
+			}
+		}
+	}
+	if err := l.max.check("", a); err != nil {
+		return err
+	}
+	if err := l.db.setApp(n, a); err != nil {
+		return err
+	}
+	l.cache.remove(n)
+	return nil
+}
+func mobile(r *http.Request) bool {
+	a := strings.ToLower(r.UserAgent())
+	for i := range mobiles {
+		if strings.Contains(a, mobiles[i]) {
+			return true
+		}
+	}
+	return false
+}
+func interstitial(w http.ResponseWriter, a, u string) {
+	j, _ := json.Marshal(a)
+	a, u = html.EscapeString(a), html.EscapeString(u)
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(`<!DOCTYPE html><html><head><meta charset="utf-8"><meta name="viewport" ` +
+		`content="width=device-width, initial-scale=1"><meta http-equiv="refresh" content="2;url=` + u +
+		`"><title>Redirecting</title></head><body><p><a href="` + a + `">Open in the app</a> or <a href="` + u +
+		`">continue to the website</a>.</p><script>window.location.replace(` + string(j) + `);</script></body></html>`))
+}
@@ -0,0 +1,900 @@
+// bolt.go
+// URL Shortener with MySQL database.
+//
+// Copyright (C) 2020 iDigitalFlame
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+//
+
+package linker
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/binary"
+	"encoding/json"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.etcd.io/bbolt"
+)
+
+var (
+	bucketLinks   = []byte("links")
+	bucketHistory = []byte("history")
+	bucketDaily   = []byte("daily")
+	bucketDeleted = []byte("deleted")
+)
+
+// boltDB is a store backed by an embedded Bolt database file. The file is only opened (and locked) while it is
+// being used, so the command line can change mappings while the HTTP service is running.
+type boltDB struct {
+	path string
+}
+type boltLink struct {
+	Meta      *Meta             `json:"meta,omitempty"`
+	Created   *time.Time        `json:"created,omitempty"`
+	Referrers []string          `json:"referrers,omitempty"`
+	Countries []string          `json:"countries,omitempty"`
+	Schedule  []Schedule        `json:"schedule,omitempty"`
+	Headers   map[string]string `json:"headers,omitempty"`
+	Append    *bool             `json:"append,omitempty"`
+	Refresh   *bool             `json:"refresh,omitempty"`
+	Rollout   *Rollout          `json:"rollout,omitempty"`
+	Owner     string            `json:"owner,omitempty"`
+	App       string            `json:"app,omitempty"`
+	Key       string            `json:"key,omitempty"`
+	URL       string            `json:"url"`
+	Hits      uint64            `json:"hits"`
+	ID        uint64            `json:"id"`
+}
+type boltDeleted struct {
+	Date  time.Time `json:"date"`
+	Owner string    `json:"owner,omitempty"`
+}
+
+func (e boltLink) link(n string) Link {
+	return Link{
+		Name: n, URL: e.URL, App: e.App, Key: e.Key, Owner: e.Owner, Meta: e.Meta, Referrers: e.Referrers,
+		Countries: e.Countries, Schedule: e.Schedule, Headers: e.Headers, Append: e.Append, Refresh: e.Refresh,
+		Rollout: e.Rollout, Hits: e.Hits, Created: e.Created,
+	}
+}
+func (boltDB) close() error {
+	return nil
+}
+func wrap(s string, err error) error {
+	if err == nil {
+		return nil
+	}
+	if _, ok := err.(*errval); ok {
+		return err
+	}
+	return &errval{s: s, e: err}
+}
+func (b boltDB) add(n, u string) error {
+	return wrap("unable to add link", b.write(func(t *bbolt.Tx) error {
+		k := t.Bucket(bucketLinks)
+		if k.Get([]byte(n)) != nil {
+			return &errval{s: `name "` + n + `" already exists`}
+		}
+		i, err := k.NextSequence()
+		if err != nil {
+			return err
+		}
+		c := time.Now()
+		return putLink(k, n, boltLink{URL: u, ID: i, Created: &c})
+	}))
+}
+func (b boltDB) claim(n, u, o string, q int) error {
+	return wrap("unable to claim link", b.write(func(t *bbolt.Tx) error {
+		k := t.Bucket(bucketLinks)
+		if k.Get([]byte(n)) != nil {
+			return &errval{s: `name "` + n + `" already exists`}
+		}
+		if q > 0 {
+			var (
+				c int
+				f = filter{owner: o}
+			)
+			err := k.ForEach(func(x, d []byte) error {
+				var e boltLink
+				if err := json.Unmarshal(d, &e); err != nil {
+					return err
+				}
+				if f.match(e.link(string(x))) {
+					c++
+				}
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+			if c >= q {
+				return errQuota
+			}
+		}
+		i, err := k.NextSequence()
+		if err != nil {
+			return err
+		}
+		c := time.Now()
+		return putLink(k, n, boltLink{URL: u, Owner: o, ID: i, Created: &c})
+	}))
+}
+func (b boltDB) list() ([]Link, error) {
+	var v []Link
+	err := b.read(func(t *bbolt.Tx) error {
+		return t.Bucket(bucketLinks).ForEach(func(k, d []byte) error {
+			var e boltLink
+			if err := json.Unmarshal(d, &e); err != nil {
+				return err
+			}
+			v = append(v, e.link(string(k)))
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, wrap("unable to list links", err)
+	}
+	return v, nil
+}
+func (b boltDB) filter(_ context.Context, f filter) ([]Link, error) {
+	v, err := b.list()
+	if err != nil {
+		return nil, err
+	}
+	return f.apply(v), nil
+}
+func (b boltDB) delete(n string) error {
+	return wrap("unable to delete link", b.write(func(t *bbolt.Tx) error {
+		k := t.Bucket(bucketLinks)
+		if e, err := getLink(k, n); err == nil {
+			d, err := json.Marshal(boltDeleted{Date: time.Now().UTC(), Owner: e.Owner})
+			if err != nil {
+				return err
+			}
+			if err = t.Bucket(bucketDeleted).Put([]byte(n), d); err != nil {
+				return err
+			}
+		}
+		if err := k.Delete([]byte(n)); err != nil {
+			return err
+		}
+		if err := t.Bucket(bucketHistory).Delete([]byte(n)); err != nil {
+			return err
+		}
+		var (
+			c = t.Bucket(bucketDaily).Cursor()
+			p = []byte(n + "\x00")
+		)
+		for k, _ := c.Seek(p); k != nil && bytes.HasPrefix(k, p); k, _ = c.Seek(p) {
+			if err := c.Delete(); err != nil {
+				return err
+			}
+		}
+		return nil
+	}))
+}
+func (b boltDB) deleted(_ context.Context, n string) (time.Time, string, error) {
+	var e boltDeleted
+	err := b.read(func(t *bbolt.Tx) error {
+		d := t.Bucket(bucketDeleted).Get([]byte(n))
+		if d == nil {
+			return sql.ErrNoRows
+		}
+		return json.Unmarshal(d, &e)
+	})
+	return e.Date, e.Owner, err
+}
+func (boltDB) resize(_, _ int) error {
+	return nil
+}
+func (b boltDB) verify(f bool) ([]string, error) {
+	var (
+		v []string
+		x = b.read
+	)
+	if f {
+		x = b.write
+	}
+	err := x(func(t *bbolt.Tx) error {
+		for _, n := range [...][]byte{bucketLinks, bucketHistory, bucketDaily, bucketDeleted} {
+			if t.Bucket(n) != nil {
+				continue
+			}
+			if v = append(v, `bucket "`+string(n)+`" is missing`); f {
+				if _, err := t.CreateBucket(n); err != nil {
+					return err
+				}
+			}
+		}
+		if k := t.Bucket(bucketLinks); k != nil {
+			k.ForEach(func(n, d []byte) error {
+				var e boltLink
+				switch {
+				case json.Unmarshal(d, &e) != nil:
+					v = append(v, `link "`+string(n)+`" cannot be read`)
+				case !validName(string(n)):
+					v = append(v, `link "`+string(n)+`" has an invalid name`)
+				case len(e.URL) == 0:
+					v = append(v, `link "`+string(n)+`" has no URL`)
+				}
+				return nil
+			})
+		}
+		if k := t.Bucket(bucketHistory); k != nil {
+			k.ForEach(func(n, d []byte) error {
+				var e []Version
+				if json.Unmarshal(d, &e) != nil {
+					v = append(v, `history of link "`+string(n)+`" cannot be read`)
+				}
+				return nil
+			})
+		}
+		if k := t.Bucket(bucketDaily); k != nil {
+			k.ForEach(func(n, d []byte) error {
+				if i := bytes.IndexByte(n, 0); i <= 0 || (len(d) != 8 && len(d) != 16) {
+					v = append(v, `daily hits entry "`+strings.Replace(string(n), "\x00", " ", 1)+`" cannot be read`)
+				}
+				return nil
+			})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, wrap("unable to check database", err)
+	}
+	return v, nil
+}
+func openBolt(d database) (*boltDB, error) {
+	if len(d.File) == 0 {
+		return nil, &errval{s: "invalid Bolt database configuration"}
+	}
+	b := &boltDB{path: d.File}
+	err := b.write(func(t *bbolt.Tx) error {
+		if _, err := t.CreateBucketIfNotExists(bucketLinks); err != nil {
+			return err
+		}
+		if _, err := t.CreateBucketIfNotExists(bucketHistory); err != nil {
+			return err
+		}
+		if _, err := t.CreateBucketIfNotExists(bucketDaily); err != nil {
+			return err
+		}
+		_, err := t.CreateBucketIfNotExists(bucketDeleted)
+		return err
+	})
+	if err != nil {
+		return nil, &errval{s: `unable to open database "` + d.File + `"`, e: err}
+	}
+	return b, nil
+}
+func (b boltDB) update(n, u string) error {
+	return wrap("unable to update link", b.write(func(t *bbolt.Tx) error {
+		return boltUpdate(t, n, u)
+	}))
+}
+func (b boltDB) read(f func(*bbolt.Tx) error) error {
+	db, err := bbolt.Open(b.path, 0640, &bbolt.Options{Timeout: defaultTimeout, ReadOnly: true})
+	if err != nil {
+		return err
+	}
+	err = db.View(f)
+	db.Close()
+	return err
+}
+func (b boltDB) write(f func(*bbolt.Tx) error) error {
+	db, err := bbolt.Open(b.path, 0640, &bbolt.Options{Timeout: defaultTimeout})
+	if err != nil {
+		return err
+	}
+	err = db.Update(f)
+	if x := db.Close(); err == nil {
+		err = x
+	}
+	return err
+}
+func putLink(k *bbolt.Bucket, n string, e boltLink) error {
+	d, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	return k.Put([]byte(n), d)
+}
+func getLink(k *bbolt.Bucket, n string) (boltLink, error) {
+	var (
+		e boltLink
+		d = k.Get([]byte(n))
+	)
+	if d == nil {
+		return e, &errval{s: `name "` + n + `" does not exist`}
+	}
+	return e, json.Unmarshal(d, &e)
+}
+func boltUpdate(t *bbolt.Tx, n, u string) error {
+	k, h := t.Bucket(bucketLinks), t.Bucket(bucketHistory)
+	e, err := getLink(k, n)
+	if err != nil {
+		return err
+	}
+	var v []Version
+	if d := h.Get([]byte(n)); d != nil {
+		if err = json.Unmarshal(d, &v); err != nil {
+			return err
+		}
+	}
+	i, err := h.NextSequence()
+	if err != nil {
+		return err
+	}
+	d, err := json.Marshal(append(v, Version{ID: i, URL: e.URL, Time: time.Now()}))
+	if err != nil {
+		return err
+	}
+	if err = h.Put([]byte(n), d); err != nil {
+		return err
+	}
+	e.URL = u
+	return putLink(k, n, e)
+}
+func (b boltDB) setAppend(n string, a *bool) error {
+	return wrap("unable to update link", b.write(func(t *bbolt.Tx) error {
+		k := t.Bucket(bucketLinks)
+		e, err := getLink(k, n)
+		if err != nil {
+			return err
+		}
+		e.Append = a
+		return putLink(k, n, e)
+	}))
+}
+func (b boltDB) setRefresh(n string, a *bool) error {
+	return wrap("unable to update link", b.write(func(t *bbolt.Tx) error {
+		k := t.Bucket(bucketLinks)
+		e, err := getLink(k, n)
+		if err != nil {
+			return err
+		}
+		e.Refresh = a
+		return putLink(k, n, e)
+	}))
+}
+func (b boltDB) setRollout(n string, r *Rollout) error {
+	return wrap("unable to update link", b.write(func(t *bbolt.Tx) error {
+		k := t.Bucket(bucketLinks)
+		e, err := getLink(k, n)
+		if err != nil {
+			return err
+		}
+		e.Rollout = r
+		return putLink(k, n, e)
+	}))
+}
+func (b boltDB) setApp(n, a string) error {
+	return wrap("unable to update link", b.write(func(t *bbolt.Tx) error {
+		k := t.Bucket(bucketLinks)
+		e, err := getLink(k, n)
+		if err != nil {
+			return err
+		}
+		e.App = a
+		return putLink(k, n, e)
+	}))
+}
+func (b boltDB) setMeta(n string, m *Meta) error {
+	return wrap("unable to update link", b.write(func(t *bbolt.Tx) error {
+		k := t.Bucket(bucketLinks)
+		e, err := getLink(k, n)
+		if err != nil {
+			return err
+		}
+		e.Meta = m
+		return putLink(k, n, e)
+	}))
+}
+func (b boltDB) setKey(n, v string) error {
+	return wrap("unable to update link", b.write(func(t *bbolt.Tx) error {
+		k := t.Bucket(bucketLinks)
+		e, err := getLink(k, n)
+		if err != nil {
+			return err
+		}
+		e.Key = v
+		return putLink(k, n, e)
+	}))
+}
+func (b boltDB) setReferrers(n string, v []string) error {
+	return wrap("unable to update link", b.write(func(t *bbolt.Tx) error {
+		k := t.Bucket(bucketLinks)
+		e, err := getLink(k, n)
+		if err != nil {
+			return err
+		}
+		e.Referrers = v
+		return putLink(k, n, e)
+	}))
+}
+func (b boltDB) setCountries(n string, v []string) error {
+	return wrap("unable to update link", b.write(func(t *bbolt.Tx) error {
+		k := t.Bucket(bucketLinks)
+		e, err := getLink(k, n)
+		if err != nil {
+			return err
+		}
+		e.Countries = v
+		return putLink(k, n, e)
+	}))
+}
+func (b boltDB) setSchedule(n string, v []Schedule) error {
+	return wrap("unable to update link", b.write(func(t *bbolt.Tx) error {
+		k := t.Bucket(bucketLinks)
+		e, err := getLink(k, n)
+		if err != nil {
+			return err
+		}
+		e.Schedule = v
+		return putLink(k, n, e)
+	}))
+}
+func (b boltDB) setHeaders(n string, v map[string]string) error {
+	return wrap("unable to update link", b.write(func(t *bbolt.Tx) error {
+		k := t.Bucket(bucketLinks)
+		e, err := getLink(k, n)
+		if err != nil {
+			return err
+		}
+		e.Headers = v
+		return putLink(k, n, e)
+	}))
+}
+func (b boltDB) setOwner(n, v string) error {
+	return wrap("unable to update link", b.write(func(t *bbolt.Tx) error {
+		k := t.Bucket(bucketLinks)
+		e, err := getLink(k, n)
+		if err != nil {
+			return err
+		}
+		e.Owner = v
+		return putLink(k, n, e)
+	}))
+}
+func (b boltDB) rollback(n string, v uint64) error {
+	return wrap("unable to rollback link", b.write(func(t *bbolt.Tx) error {
+		var h []Version
+		if d := t.Bucket(bucketHistory).Get([]byte(n)); d != nil {
+			if err := json.Unmarshal(d, &h); err != nil {
+				return err
+			}
+		}
+		for i := range h {
+			if h[i].ID == v {
+				return boltUpdate(t, n, h[i].URL)
+			}
+		}
+		return &errval{s: `history ID "` + strconv.FormatUint(v, 10) + `" for name "` + n + `" does not exist`}
+	}))
+}
+func (b boltDB) history(n string) ([]Version, error) {
+	var v []Version
+	err := b.read(func(t *bbolt.Tx) error {
+		if d := t.Bucket(bucketHistory).Get([]byte(n)); d != nil {
+			return json.Unmarshal(d, &v)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, wrap("unable to read link history", err)
+	}
+	for i, j := 0, len(v)-1; i < j; i, j = i+1, j-1 {
+		v[i], v[j] = v[j], v[i]
+	}
+	return v, nil
+}
+func (b boltDB) top(_ context.Context, n int) ([]Link, error) {
+	var (
+		v   []Link
+		o   []uint64
+		err = b.read(func(t *bbolt.Tx) error {
+			return t.Bucket(bucketLinks).ForEach(func(k, d []byte) error {
+				var e boltLink
+				if err := json.Unmarshal(d, &e); err != nil {
+					return err
+				}
+				v, o = append(v, e.link(string(k))), append(o, e.ID)
+				return nil
+			})
+		})
+	)
+	if err != nil {
+		return nil, wrap("unable to list links", err)
+	}
+	sort.Sort(byHits{v: v, o: o})
+	if len(v) > n {
+		v = v[:n]
+	}
+	return v, nil
+}
+func (b boltDB) search(_ context.Context, q string, n int) ([]Link, error) {
+	v, err := b.list()
+	if err != nil {
+		return nil, err
+	}
+	return match(v, q, n), nil
+}
+func (b boltDB) recent(_ context.Context, n int) ([]Link, error) {
+	var (
+		v []Link
+		o []uint64
+	)
+	err := b.read(func(t *bbolt.Tx) error {
+		return t.Bucket(bucketLinks).ForEach(func(k, d []byte) error {
+			var e boltLink
+			if err := json.Unmarshal(d, &e); err != nil {
+				return err
+			}
+			v, o = append(v, e.link(string(k))), append(o, e.ID)
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, wrap("unable to list recent links", err)
+	}
+	sort.Sort(byID{byHits{v: v, o: o}})
+	if len(v) > n {
+		v = v[:n]
+	}
+	return v, nil
+}
+func (b boltDB) get(_ context.Context, n string) (record, error) {
+	var r record
+	err := b.read(func(t *bbolt.Tx) error {
+		d := t.Bucket(bucketLinks).Get([]byte(n))
+		if d == nil {
+			return sql.ErrNoRows
+		}
+		var e boltLink
+		if err := json.Unmarshal(d, &e); err != nil {
+			return err
+		}
+		r = e.link(n).record()
+		return nil
+	})
+	return r, err
+}
+func (b boltDB) hits(_ context.Context, h map[string]uint64) error {
+	return wrap("unable to save link hits", b.write(func(t *bbolt.Tx) error {
+		k := t.Bucket(bucketLinks)
+		for n, c := range h {
+			e, err := getLink(k, n)
+			if err != nil {
+				continue
+			}
+			e.Hits += c
+			if err = putLink(k, n, e); err != nil {
+				return err
+			}
+		}
+		return nil
+	}))
+}
+
+func (b boltDB) daily(_ context.Context, d time.Time, h, u map[string]uint64) error {
+	s := "\x00" + d.UTC().Format(dateFormat)
+	return wrap("unable to save daily link hits", b.write(func(t *bbolt.Tx) error {
+		k := t.Bucket(bucketDaily)
+		for n, c := range h {
+			var (
+				i = []byte(n + s)
+				v = make([]byte, 16)
+				q = u[n]
+			)
+			if e := k.Get(i); len(e) >= 8 {
+				if c += binary.BigEndian.Uint64(e); len(e) == 16 {
+					q += binary.BigEndian.Uint64(e[8:])
+				}
+			}
+			binary.BigEndian.PutUint64(v, c)
+			binary.BigEndian.PutUint64(v[8:], q)
+			if err := k.Put(i, v); err != nil {
+				return err
+			}
+		}
+		return nil
+	}))
+}
+func (b boltDB) visits(_ context.Context, n string, d time.Time) ([]Day, error) {
+	var (
+		v []Day
+		p = []byte(n + "\x00")
+		s = n + "\x00" + d.UTC().Format(dateFormat)
+	)
+	err := b.read(func(t *bbolt.Tx) error {
+		c := t.Bucket(bucketDaily).Cursor()
+		for k, e := c.Seek([]byte(s)); k != nil && bytes.HasPrefix(k, p); k, e = c.Next() {
+			if len(e) < 8 {
+				continue
+			}
+			r, err := time.Parse(dateFormat, string(k[len(p):]))
+			if err != nil {
+				continue
+			}
+			i := Day{Date: r, Hits: binary.BigEndian.Uint64(e)}
+			if len(e) == 16 {
+				i.Uniques = binary.BigEndian.Uint64(e[8:])
+			}
+			v = append(v, i)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, wrap("unable to list link visits", err)
+	}
+	for i, j := 0, len(v)-1; i < j; i, j = i+1, j-1 {
+		v[i], v[j] = v[j], v[i]
+	}
+	return v, nil
+}
+func (b boltDB) rewrite(f func(string) (string, error)) (int, error) {
+	var c int
+	err := b.write(func(t *bbolt.Tx) error {
+		var (
+			l, h = t.Bucket(bucketLinks), t.Bucket(bucketHistory)
+			e    = make(map[string]boltLink)
+			v    = make(map[string][]Version)
+		)
+		err := l.ForEach(func(k, d []byte) error {
+			var r boltLink
+			if err := json.Unmarshal(d, &r); err != nil {
+				return err
+			}
+			u, err := f(r.URL)
+			if err != nil {
+				return err
+			}
+			p := r.Key
+			if len(p) > 0 {
+				if p, err = f(p); err != nil {
+					return err
+				}
+			}
+			o := r.Rollout
+			if o != nil && len(o.From) > 0 {
+				s, err := f(o.From)
+				if err != nil {
+					return err
+				}
+				if s != o.From {
+					o = &Rollout{Start: o.Start, From: s, Ramp: o.Ramp, Percent: o.Percent}
+					c++
+				}
+			}
+			a := r.App
+			if len(a) > 0 {
+				if a, err = f(a); err != nil {
+					return err
+				}
+			}
+			w, m := r.Schedule, false
+			if len(w) > 0 {
+				s := encodeSchedule(w).String
+				q, err := rescheduled(f)(s)
+				if err != nil {
+					return err
+				}
+				if m = q != s; m {
+					w = decodeSchedule(q)
+					c++
+				}
+			}
+			if u != r.URL || p != r.Key || a != r.App || o != r.Rollout || m {
+				if u != r.URL {
+					c++
+				}
+				if p != r.Key {
+					c++
+				}
+				if a != r.App {
+					c++
+				}
+				r.URL, r.Key, r.App, r.Rollout, r.Schedule = u, p, a, o, w
+				e[string(k)] = r
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		err = h.ForEach(func(k, d []byte) error {
+			var r []Version
+			if err := json.Unmarshal(d, &r); err != nil {
+				return err
+			}
+			var s bool
+			for i := range r {
+				u, err := f(r[i].URL)
+				if err != nil {
+					return err
+				}
+				if u != r[i].URL {
+					r[i].URL, s = u, true
+					c++
+				}
+			}
+			if s {
+				v[string(k)] = r
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		for k, r := range e {
+			if err = putLink(l, k, r); err != nil {
+				return err
+			}
+		}
+		for k, r := range v {
+			d, err := json.Marshal(r)
+			if err != nil {
+				return err
+			}
+			if err = h.Put([]byte(k), d); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, wrap("unable to rewrite link values", err)
+	}
+	return c, nil
+}
+func (b boltDB) usage(_ context.Context, f, t time.Time) ([]usage, error) {
+	var (
+		v    []usage
+		s, e = f.UTC().Format(dateFormat), t.UTC().Format(dateFormat)
+	)
+	err := b.read(func(t *bbolt.Tx) error {
+		c := make(map[string]*usage)
+		err := t.Bucket(bucketDaily).ForEach(func(k, d []byte) error {
+			i := bytes.IndexByte(k, 0)
+			if i <= 0 || len(d) < 8 || string(k[i+1:]) < s || string(k[i+1:]) > e {
+				return nil
+			}
+			u, ok := c[string(k[:i])]
+			if !ok {
+				u = &usage{name: string(k[:i])}
+				c[u.name] = u
+			}
+			if u.hits += binary.BigEndian.Uint64(d); len(d) == 16 {
+				u.uniques += binary.BigEndian.Uint64(d[8:])
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		l := t.Bucket(bucketLinks)
+		for _, u := range c {
+			r, err := getLink(l, u.name)
+			if err != nil {
+				continue
+			}
+			u.url = r.URL
+			v = append(v, *u)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, wrap("unable to read link usage", err)
+	}
+	return v, nil
+}
+func (b boltDB) popular(_ context.Context, d time.Time, n int) ([]Link, error) {
+	var (
+		v []Link
+		s = d.UTC().Format(dateFormat)
+	)
+	err := b.read(func(t *bbolt.Tx) error {
+		c := make(map[string]uint64)
+		err := t.Bucket(bucketDaily).ForEach(func(k, e []byte) error {
+			i := bytes.IndexByte(k, 0)
+			if i <= 0 || len(e) < 8 || string(k[i+1:]) < s {
+				return nil
+			}
+			c[string(k[:i])] += binary.BigEndian.Uint64(e)
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		l := t.Bucket(bucketLinks)
+		for k, h := range c {
+			e, err := getLink(l, k)
+			if err != nil {
+				continue
+			}
+			r := e.link(k)
+			r.Hits = h
+			v = append(v, r)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, wrap("unable to list popular links", err)
+	}
+	sort.Slice(v, func(i, j int) bool {
+		if v[i].Hits == v[j].Hits {
+			return v[i].Name < v[j].Name
+		}
+		return v[i].Hits > v[j].Hits
+	})
+	if len(v) > n {
+		v = v[:n]
+	}
+	return v, nil
+}
+func (b boltDB) purge(_ context.Context, d time.Time) error {
+	s := d.UTC().Format(dateFormat)
+	return wrap("unable to purge daily link hits", b.write(func(t *bbolt.Tx) error {
+		var (
+			k = t.Bucket(bucketDaily)
+			v [][]byte
+		)
+		err := k.ForEach(func(n, _ []byte) error {
+			if i := bytes.IndexByte(n, 0); i > 0 && string(n[i+1:]) < s {
+				v = append(v, n)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		for i := range v {
+			if err = k.Delete(v[i]); err != nil {
+				return err
+			}
+		}
+		return nil
+	}))
+}
+
+type byHits struct {
+	v []Link
+	o []uint64
+}
+type byID struct {
+	byHits
+}
+
+func (b byHits) Len() int {
+	return len(b.v)
+}
+func (b byHits) Swap(i, j int) {
+	b.v[i], b.v[j] = b.v[j], b.v[i]
+	b.o[i], b.o[j] = b.o[j], b.o[i]
+}
+func (b byHits) Less(i, j int) bool {
+	if b.v[i].Hits == b.v[j].Hits {
+		return b.o[i] > b.o[j]
+	}
+	return b.v[i].Hits > b.v[j].Hits
+}
+func (b byID) Less(i, j int) bool {
+	return b.o[i] > b.o[j]
+}
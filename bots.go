@@ -0,0 +1,142 @@
+// bots.go
+// URL Shortener with MySQL database.
+//
+// Copyright (C) 2020 iDigitalFlame
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+//
+
+package linker
+
+import (
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+const defaultBlockLimit = 16384
+
+var agents = [...]string{
+	"bot", "crawl", "spider", "slurp", "scan", "curl/", "wget/", "python-requests", "python-urllib", "go-http-client",
+	"libwww-perl", "java/", "okhttp", "httpclient", "headlesschrome", "phantomjs", "facebookexternalhit", "masscan",
+	"zgrab", "nikto", "sqlmap",
+}
+
+type bots struct {
+	lock    sync.Mutex
+	traps   map[string]struct{}
+	blocked map[string]time.Time
+	agents  []string
+	block   time.Duration
+	filter  bool
+}
+type botsConfig struct {
+	Block  duration `json:"block"`
+	Traps  []string `json:"traps"`
+	Agents []string `json:"agents"`
+	Filter bool     `json:"filter"`
+}
+
+func address(r *http.Request) string {
+	h, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return h
+}
+func (b *bots) load(c botsConfig) {
+	b.filter, b.block = c.Filter, time.Duration(c.Block)
+	b.agents = append(make([]string, 0, len(agents)+len(c.Agents)), agents[:]...)
+	for i := range c.Agents {
+		if len(c.Agents[i]) > 0 {
+			b.agents = append(b.agents, strings.ToLower(c.Agents[i]))
+		}
+	}
+	if len(c.Traps) == 0 {
+		return
+	}
+	b.traps = make(map[string]struct{}, len(c.Traps))
+	for i := range c.Traps {
+		if len(c.Traps[i]) == 0 {
+			continue
+		}
+		if c.Traps[i][0] != '/' {
+			c.Traps[i] = "/" + c.Traps[i]
+		}
+		b.traps[strings.ToLower(strings.TrimRight(c.Traps[i], "/"))] = struct{}{}
+	}
+	if b.block > 0 {
+		b.blocked = make(map[string]time.Time)
+	}
+}
+func (b *bots) bot(r *http.Request) bool {
+	a := strings.ToLower(r.UserAgent())
+	if len(a) == 0 {
+		return true
+	}
+	for i := range b.agents {
+		if strings.Contains(a, b.agents[i]) {
+			return true
+		}
+	}
+	return false
+}
+func (b *bots) deny(r *http.Request, a string) bool {
+	if b.blocked != nil {
+		b.lock.Lock()
+		e, ok := b.blocked[a]
+		if ok && time.Now().After(e) {
+			delete(b.blocked, a)
+			ok = false
+		}
+		if b.lock.Unlock(); ok {
+			return true
+		}
+	}
+	if b.traps != nil && b.trap(r.URL.Path) {
+		if b.blocked != nil {
+			b.lock.Lock()
+			if len(b.blocked) >= defaultBlockLimit {
+				x := time.Now()
+				for k, v := range b.blocked {
+					if x.After(v) {
+						delete(b.blocked, k)
+					}
+				}
+			}
+			if len(b.blocked) < defaultBlockLimit {
+				b.blocked[a] = time.Now().Add(b.block)
+			}
+			b.lock.Unlock()
+		}
+		return true
+	}
+	// Social media crawlers are let through the filter, so shared links still show their preview.
+	return b.filter && b.bot(r) && !social(r)
+}
+func (b *bots) trap(p string) bool {
+	for p = strings.ToLower(p); len(p) > 1; {
+		if _, ok := b.traps[strings.TrimRight(p, "/")]; ok {
+			return true
+		}
+		i := strings.LastIndexByte(strings.TrimRight(p, "/"), '/')
+		if i <= 0 {
+			break
+		}
+		p = p[:i]
+	}
+	return false
+}
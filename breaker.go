@@ -0,0 +1,75 @@
+// breaker.go
+// URL Shortener with MySQL database.
+//
+// Copyright (C) 2020 iDigitalFlame
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+//
+
+package linker
+
+import (
+	"context"
+	"database/sql"
+	"sync"
+	"time"
+)
+
+var errBreakerOpen = &errval{s: "database circuit breaker is open"}
+
+type breaker struct {
+	open  time.Time
+	cool  time.Duration
+	lock  sync.Mutex
+	max   uint32
+	count uint32
+	trial bool
+}
+type breakerConfig struct {
+	Cooldown  duration `json:"cooldown"`
+	Threshold uint32   `json:"threshold"`
+	Redirect  bool     `json:"redirect"`
+}
+
+func (b *breaker) allow() bool {
+	if b.max == 0 {
+		return true
+	}
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	if b.count < b.max {
+		return true
+	}
+	if b.trial || time.Since(b.open) < b.cool {
+		return false
+	}
+	b.trial = true
+	return true
+}
+func (b *breaker) report(err error) {
+	if b.max == 0 {
+		return
+	}
+	b.lock.Lock()
+	switch b.trial = false; {
+	case err == context.Canceled:
+	case err == nil || err == sql.ErrNoRows:
+		b.count = 0
+	default:
+		if b.count++; b.count >= b.max {
+			b.open = time.Now()
+		}
+	}
+	b.lock.Unlock()
+}
@@ -0,0 +1,134 @@
+// cache.go
+// URL Shortener with MySQL database.
+//
+// Copyright (C) 2020 iDigitalFlame
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+//
+
+package linker
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+const defaultCacheLimit = 16384
+
+type entry struct {
+	exp time.Time
+	record
+}
+type cache struct {
+	lock    sync.RWMutex
+	entries map[string]entry
+	ttl     time.Duration
+	missing time.Duration
+	budget  time.Duration
+	stale   uint64
+	limit   int
+	warm    int
+}
+type cacheConfig struct {
+	TTL     duration `json:"ttl"`
+	Missing duration `json:"missing"`
+	Budget  duration `json:"budget"`
+	Limit   uint32   `json:"limit"`
+	Warm    uint32   `json:"warm"`
+}
+
+// Stale will return the number of redirect lookups that were answered with an expired cache entry because the
+// database lookup took longer than the cache "budget" since the HTTP service started.
+func (l *Linker) Stale() uint64 {
+	l.cache.lock.RLock()
+	n := l.cache.stale
+	l.cache.lock.RUnlock()
+	return n
+}
+
+func (c *cache) remove(n string) {
+	c.lock.Lock()
+	delete(c.entries, n)
+	c.lock.Unlock()
+}
+func (c *cache) get(n string) (record, bool) {
+	if c.entries == nil {
+		return record{}, false
+	}
+	c.lock.RLock()
+	e, ok := c.entries[n]
+	c.lock.RUnlock()
+	if !ok || time.Now().After(e.exp) {
+		return record{}, false
+	}
+	return e.record, true
+}
+func (c *cache) last(n string) (record, bool) {
+	if c.entries == nil || c.budget <= 0 {
+		return record{}, false
+	}
+	c.lock.RLock()
+	e, ok := c.entries[n]
+	c.lock.RUnlock()
+	if !ok || len(e.url) == 0 {
+		return record{}, false
+	}
+	return e.record, true
+}
+func (c *cache) set(n string, v record, t time.Duration) {
+	if c.entries == nil || (t <= 0 && (c.budget <= 0 || len(v.url) == 0)) {
+		return
+	}
+	c.lock.Lock()
+	if _, ok := c.entries[n]; !ok && len(c.entries) >= c.limit {
+		var (
+			x = time.Now()
+			o string
+			f time.Time
+		)
+		for k, e := range c.entries {
+			if x.After(e.exp) {
+				delete(c.entries, k)
+				continue
+			}
+			if len(o) == 0 || e.exp.Before(f) {
+				o, f = k, e.exp
+			}
+		}
+		// When no entry has expired, the entry closest to expiring is removed, so new names are still cached.
+		if len(c.entries) >= c.limit {
+			delete(c.entries, o)
+		}
+	}
+	c.entries[n] = entry{record: v, exp: time.Now().Add(t)}
+	c.lock.Unlock()
+}
+func (l *Linker) warm(x context.Context) error {
+	if l.cache.entries == nil || l.cache.ttl <= 0 || l.cache.warm <= 0 {
+		return nil
+	}
+	n := l.cache.warm
+	if n > l.cache.limit {
+		n = l.cache.limit
+	}
+	v, err := l.db.top(x, n)
+	if err != nil {
+		return err
+	}
+	for i := range v {
+		l.cache.set(v[i].Name, v[i].record(), l.cache.ttl)
+	}
+	return nil
+}
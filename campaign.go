@@ -0,0 +1,93 @@
+// campaign.go
+// URL Shortener with MySQL database.
+//
+// Copyright (C) 2020 iDigitalFlame
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+//
+
+package linker
+
+import (
+	"context"
+	"net/url"
+	"sort"
+	"time"
+)
+
+// Campaign is a struct that represents the hits of a redirect in a campaign report. The campaign, source and
+// medium are the "utm_campaign", "utm_source" and "utm_medium" query parameters of the redirect URL. The hits and
+// unique visitors are the totals of the redirect over the report dates.
+type Campaign struct {
+	Campaign string `json:"campaign"`
+	Source   string `json:"source,omitempty"`
+	Medium   string `json:"medium,omitempty"`
+	Name     string `json:"name"`
+	Hits     uint64 `json:"hits"`
+	Uniques  uint64 `json:"uniques"`
+}
+type usage struct {
+	name, url     string
+	hits, uniques uint64
+}
+
+// Campaigns will return the campaign report of the redirects with a "utm_campaign" query parameter in their URL,
+// with the hits and unique visitors of each redirect from the first to the last supplied date (including both
+// days, in UTC). The report is sorted by campaign, then by hits. Daily hits are only saved when "stats" is enabled.
+// This function will return an error if the lookup fails.
+func (l *Linker) Campaigns(f, t time.Time) ([]Campaign, error) {
+	if l.db == nil {
+		return nil, errNotConfigured
+	}
+	if t.Before(f) {
+		return nil, &errval{s: "report end date is before the start date"}
+	}
+	x := l.ctx
+	if x == nil {
+		x = context.Background()
+	}
+	u, err := l.db.usage(x, f, t)
+	if err != nil {
+		return nil, err
+	}
+	var v []Campaign
+	for i := range u {
+		p, err := url.Parse(u[i].url)
+		if err != nil {
+			continue
+		}
+		q := p.Query()
+		if len(q.Get("utm_campaign")) == 0 {
+			continue
+		}
+		v = append(v, Campaign{
+			Campaign: q.Get("utm_campaign"),
+			Source:   q.Get("utm_source"),
+			Medium:   q.Get("utm_medium"),
+			Name:     u[i].name,
+			Hits:     u[i].hits,
+			Uniques:  u[i].uniques,
+		})
+	}
+	sort.Slice(v, func(i, j int) bool {
+		if v[i].Campaign != v[j].Campaign {
+			return v[i].Campaign < v[j].Campaign
+		}
+		if v[i].Hits == v[j].Hits {
+			return v[i].Name < v[j].Name
+		}
+		return v[i].Hits > v[j].Hits
+	})
+	return v, nil
+}
@@ -0,0 +1,32 @@
+// check.go
+// URL Shortener with MySQL database.
+//
+// Copyright (C) 2020 iDigitalFlame
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+//
+
+package linker
+
+// Check will look for problems in the database, such as missing indexes, columns that are too small for the
+// supported name and URL sizes or tables that do not use the utf8mb4 character set in MySQL, or entries that cannot
+// be read in Bolt. When fix is true, the problems that can be fixed are fixed. Problems are also logged when the
+// HTTP service starts. This function returns the list of problems that were found and will return an error if the
+// check (or a fix) fails.
+func (l *Linker) Check(fix bool) ([]string, error) {
+	if l.db == nil {
+		return nil, errNotConfigured
+	}
+	return l.db.verify(fix)
+}
@@ -0,0 +1,204 @@
+// claim.go
+// URL Shortener with MySQL database.
+//
+// Copyright (C) 2020 iDigitalFlame
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+//
+
+package linker
+
+import (
+	"crypto/subtle"
+	"database/sql"
+	"html"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+const (
+	defaultClaimHeader = "X-Forwarded-User"
+	claimSecretHeader  = "X-Linker-Secret"
+)
+
+var errQuota = &errval{s: "owner has reached the limit of claimed names"}
+
+type claim struct {
+	reserved map[string]struct{}
+	path     string
+	header   string
+	secret   string
+	quota    int
+}
+type claimConfig struct {
+	Path     string   `json:"path"`
+	Header   string   `json:"header"`
+	Secret   string   `json:"secret"`
+	Reserved []string `json:"reserved"`
+	Quota    uint16   `json:"quota"`
+}
+
+func (c *claim) load(v claimConfig) error {
+	if len(v.Path) == 0 {
+		return nil
+	}
+	if v.Path[0] != '/' || len(v.Path) == 1 {
+		return &errval{s: `invalid claim page path "` + v.Path + `"`}
+	}
+	if c.path, c.header, c.secret, c.quota = v.Path, v.Header, v.Secret, int(v.Quota); len(c.header) == 0 {
+		c.header = defaultClaimHeader
+	}
+	c.reserved = make(map[string]struct{}, len(v.Reserved)+1)
+	c.reserved[strings.ToLower(strings.Trim(v.Path, "/"))] = struct{}{}
+	for i := range v.Reserved {
+		c.reserved[strings.ToLower(strings.TrimSpace(v.Reserved[i]))] = struct{}{}
+	}
+	return nil
+}
+
+// SetOwner will change the owner of the redirect with the supplied name. Names claimed using the claim page are
+// owned by the user that claimed them, which is used for the claim quota. An empty string will remove the owner.
+// This function will return an error if the change fails or the name does not exist.
+func (l *Linker) SetOwner(n, o string) error {
+	if l.db == nil {
+		return errNotConfigured
+	}
+	if !validName(n) {
+		return &errval{s: `name "` + n + `" contains invalid characters`}
+	}
+	if err := l.db.setOwner(n, o); err != nil {
+		return err
+	}
+	l.cache.remove(n)
+	return nil
+}
+func (l *Linker) check(r *http.Request, n, o string) (int, string) {
+	if !validName(n) {
+		return http.StatusBadRequest, `Name "` + n + `" contains invalid characters.`
+	}
+	l.lock.RLock()
+	_, s := l.static[n]
+	_, ok := l.claim.reserved[strings.ToLower(n)]
+	if l.lock.RUnlock(); s {
+		return http.StatusConflict, `Name "` + n + `" is already taken.`
+	}
+	if ok {
+		return http.StatusConflict, `Name "` + n + `" is reserved.`
+	}
+	switch _, err := l.db.get(r.Context(), n); {
+	case err == nil:
+		return http.StatusConflict, `Name "` + n + `" is already taken.`
+	case err != sql.ErrNoRows:
+		l.report.error("Unable to check claimed name", err)
+		return http.StatusInternalServerError, `Unable to check name "` + n + `".`
+	}
+	switch m, err := l.recycled(r.Context(), n, o); {
+	case err != nil:
+		l.report.error("Unable to check claimed name", err)
+		return http.StatusInternalServerError, `Unable to check name "` + n + `".`
+	case len(m) > 0:
+		return http.StatusConflict, `Name "` + n + `" ` + m + "."
+	}
+	return http.StatusOK, `Name "` + n + `" is available.`
+}
+func (c *claim) trusted(r *http.Request, p proxies) bool {
+	if len(c.secret) > 0 && subtle.ConstantTimeCompare([]byte(r.Header.Get(claimSecretHeader)), []byte(c.secret)) == 1 {
+		return true
+	}
+	return p.trusted(r)
+}
+func (l *Linker) claimed(w http.ResponseWriter, r *http.Request) {
+	l.lock.RLock()
+	q, p := l.claim, l.proxy
+	if l.lock.RUnlock(); !q.trusted(r, p) {
+		r.Body.Close()
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+	o := strings.TrimSpace(r.Header.Get(q.header))
+	if len(o) == 0 {
+		r.Body.Close()
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	switch r.Method {
+	case http.MethodGet, http.MethodHead:
+		r.Body.Close()
+		n := r.URL.Query().Get("name")
+		if len(n) == 0 {
+			page(w, http.StatusOK, "", n)
+			return
+		}
+		c, m := l.check(r, n, o)
+		page(w, c, m, n)
+		return
+	case http.MethodPost:
+	default:
+		r.Body.Close()
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	if v := r.Header.Get("Origin"); len(v) > 0 {
+		if u, err := url.Parse(v); err != nil || !strings.EqualFold(u.Host, r.Host) {
+			r.Body.Close()
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, l.body)
+	err := r.ParseForm()
+	if r.Body.Close(); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	n := r.PostForm.Get("name")
+	c, m := l.check(r, n, o)
+	if c != http.StatusOK {
+		page(w, c, m, n)
+		return
+	}
+	v := strings.TrimSpace(r.PostForm.Get("url"))
+	if u, err := url.Parse(v); err != nil || (u.Scheme != "http" && u.Scheme != "https") || len(u.Host) == 0 {
+		page(w, http.StatusBadRequest, `URL "`+v+`" must be an HTTP or HTTPS URL.`, n)
+		return
+	}
+	switch err = l.add(n, v, o, q.quota); {
+	case err == errQuota:
+		page(w, http.StatusForbidden, "You have reached the limit of claimed names.", n)
+		return
+	case err != nil:
+		page(w, http.StatusBadRequest, `Unable to claim name "`+n+`": `+err.Error()+".", n)
+		return
+	}
+	page(w, http.StatusCreated, `Name "`+n+`" was claimed.`, n)
+}
+func page(w http.ResponseWriter, c int, m, n string) {
+	var b strings.Builder
+	n = html.EscapeString(n)
+	b.WriteString(`<!DOCTYPE html><html><head><meta charset="utf-8"><meta name="robots" content="noindex, nofollow">`)
+	b.WriteString(`<title>Claim a name</title></head><body><h1>Claim a name</h1>`)
+	if len(m) > 0 {
+		b.WriteString(`<p>` + html.EscapeString(m) + `</p>`)
+	}
+	b.WriteString(`<form method="get"><input name="name" placeholder="name" value="` + n + `" required>`)
+	b.WriteString(`<button type="submit">Check</button></form><form method="post">`)
+	b.WriteString(`<input name="name" placeholder="name" value="` + n + `" required>`)
+	b.WriteString(`<input name="url" type="url" placeholder="https://" required><button type="submit">Claim</button>`)
+	b.WriteString(`</form></body></html>`)
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(c)
+	w.Write([]byte(b.String()))
+}
@@ -0,0 +1,260 @@
+// Copyright (C) 2020 iDigitalFlame
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+//
+
+package main
+
+const completeBash = `# bash completion for linker
+_linker_names() {
+    linker -l -o csv 2> /dev/null | tail -n +2 | cut -d ',' -f 1
+}
+_linker() {
+    local cur="${COMP_WORDS[COMP_CWORD]}" prev="${COMP_WORDS[COMP_CWORD-1]}"
+    case "$prev" in
+        -r|-u|-i|-v|-b|-p|-z|-n|-t|-k|-f|-geo|-w|-j|-q)
+            COMPREPLY=($(compgen -W "$(_linker_names)" -- "$cur"))
+            return
+            ;;
+        -c|-m)
+            COMPREPLY=($(compgen -f -- "$cur"))
+            return
+            ;;
+        -o)
+            COMPREPLY=($(compgen -W "table json csv xlsx nginx caddy dns" -- "$cur"))
+            return
+            ;;
+        -g)
+            COMPREPLY=($(compgen -W "bash zsh fish man" -- "$cur"))
+            return
+            ;;
+    esac
+    COMPREPLY=($(compgen -W "-h -l -s -d -version -a -r -u -i -v -b -p -z -n -t -k -f -geo -w -j -q -e -x -y -m -o -c -g" -- "$cur"))
+}
+complete -F _linker linker
+`
+const completeZsh = `#compdef linker
+_linker_names() {
+    local -a names
+    names=(${(f)"$(linker -l -o csv 2> /dev/null | tail -n +2 | cut -d ',' -f 1)"})
+    compadd -a names
+}
+_arguments \
+    '-h[Print this help menu]' \
+    '-l[List the URL mapping and exit]' \
+    '-s[Start the Linker HTTP service]' \
+    '-d[Dump the default configuration and exit]' \
+    '-version[Print the version and build information and exit]' \
+    '-a[Add the specified name to URL mapping]:name:' \
+    '-r[Delete the specified name to URL mapping]:name:_linker_names' \
+    '-u[Update the specified name mapping to URL]:name:_linker_names' \
+    '-i[Print the URL history of the specified name mapping]:name:_linker_names' \
+    '-v[Print the daily hits and unique visitors of the specified name mapping]:name:_linker_names' \
+    '-b[Rollback the specified name mapping to the history ID]:name:_linker_names' \
+    '-p[Set if extra path and query data is added to the specified name mapping]:name:_linker_names' \
+    '-z[Set if the specified name mapping is sent as a refresh page]:name:_linker_names' \
+    '-n[Set the mobile app deep link URL of the specified name mapping]:name:_linker_names' \
+    '-t[Set the social media preview of the specified name mapping]:name:_linker_names' \
+    '-k[Set the signing key of the specified name mapping]:name:_linker_names' \
+    '-f[Set the allowed referrers of the specified name mapping]:name:_linker_names' \
+    '-geo[Set the allowed or denied countries of the specified name mapping]:name:_linker_names' \
+    '-w[Set the schedule of the specified name mapping]:name:_linker_names' \
+    '-j[Set the extra response headers of the specified name mapping]:name:_linker_names' \
+    '-q[Print the signed path of the specified name mapping]:name:_linker_names' \
+    '-e[Print the campaign report from the specified date]:date:' \
+    '-x[Encrypt the URLs and signing keys of all mappings with the current encryption key]' \
+    '-y[Check the database for problems]::fix:(fix)' \
+    '-m[Import the mappings exported from another URL shortener]:file:_files' \
+    '-o[Output format of the list, history, visits and report]:format:(table json csv xlsx nginx caddy dns)' \
+    '-c[Configuration file path]:file:_files' \
+    '-g[Print a shell completion script or man page]:type:(bash zsh fish man)' \
+    '*::argument:'
+`
+const completeFish = `# fish completion for linker
+function __linker_names
+    linker -l -o csv 2> /dev/null | tail -n +2 | cut -d ',' -f 1
+end
+complete -c linker -f
+complete -c linker -o h -d 'Print this help menu'
+complete -c linker -o l -d 'List the URL mapping and exit'
+complete -c linker -o s -d 'Start the Linker HTTP service'
+complete -c linker -o d -d 'Dump the default configuration and exit'
+complete -c linker -o version -d 'Print the version and build information and exit'
+complete -c linker -o a -x -d 'Add the specified name to URL mapping'
+complete -c linker -o r -x -a '(__linker_names)' -d 'Delete the specified name to URL mapping'
+complete -c linker -o u -x -a '(__linker_names)' -d 'Update the specified name mapping to URL'
+complete -c linker -o i -x -a '(__linker_names)' -d 'Print the URL history of the specified name mapping'
+complete -c linker -o v -x -a '(__linker_names)' -d 'Print the daily hits and unique visitors of the specified name mapping'
+complete -c linker -o b -x -a '(__linker_names)' -d 'Rollback the specified name mapping to the history ID'
+complete -c linker -o p -x -a '(__linker_names)' -d 'Set if extra path and query data is added to the specified name mapping'
+complete -c linker -o z -x -a '(__linker_names)' -d 'Set if the specified name mapping is sent as a refresh page'
+complete -c linker -o n -x -a '(__linker_names)' -d 'Set the mobile app deep link URL of the specified name mapping'
+complete -c linker -o t -x -a '(__linker_names)' -d 'Set the social media preview of the specified name mapping'
+complete -c linker -o k -x -a '(__linker_names)' -d 'Set the signing key of the specified name mapping'
+complete -c linker -o f -x -a '(__linker_names)' -d 'Set the allowed referrers of the specified name mapping'
+complete -c linker -o geo -x -a '(__linker_names)' -d 'Set the allowed or denied countries of the specified name mapping'
+complete -c linker -o w -x -a '(__linker_names)' -d 'Set the schedule of the specified name mapping'
+complete -c linker -o j -x -a '(__linker_names)' -d 'Set the extra response headers of the specified name mapping'
+complete -c linker -o q -x -a '(__linker_names)' -d 'Print the signed path of the specified name mapping'
+complete -c linker -o e -x -d 'Print the campaign report from the specified date'
+complete -c linker -o x -d 'Encrypt the URLs and signing keys of all mappings with the current encryption key'
+complete -c linker -o y -f -a 'fix' -d 'Check the database for problems'
+complete -c linker -o m -r -F -d 'Import the mappings exported from another URL shortener'
+complete -c linker -o o -x -a 'table json csv xlsx nginx caddy dns' -d 'Output format of the list, history, visits and report'
+complete -c linker -o c -r -F -d 'Configuration file path'
+complete -c linker -o g -x -a 'bash zsh fish man' -d 'Print a shell completion script or man page'
+`
+const manPage = `.TH LINKER 1 "" "Linker v2" "User Commands"
+.SH NAME
+linker \- HTTP web URL shortener
+.SH SYNOPSIS
+.B linker
+[\fB\-c\fR \fIfile\fR] [\fB\-o\fR \fIformat\fR] \fIoption\fR [\fIarguments\fR]
+.SH DESCRIPTION
+Linker is a self hosted URL shortening service backed by a MySQL database
+that stores name and URL mappings. Requests for a name are redirected to the
+mapped URL, while unknown names are redirected to the configured default URL.
+.SH OPTIONS
+.TP
+.B \-h
+Print the help menu.
+.TP
+.B \-l
+List the URL mapping and exit.
+.TP
+.B \-s
+Start the Linker HTTP service.
+.TP
+.B \-d
+Dump the default configuration and exit.
+.TP
+.B \-version
+Print the version and build information and exit.
+.TP
+.BI \-a " name URL"
+Add the specified \fIname\fR to \fIURL\fR mapping.
+.TP
+.BI \-r " name"
+Delete the specified \fIname\fR to URL mapping.
+.TP
+.BI \-u " name URL \fR[\fPduration\fR] [\fPpercent\fR]"
+Update the specified \fIname\fR mapping to \fIURL\fR. When \fIduration\fR is
+specified, \fIURL\fR is rolled out to \fIpercent\fR (or none) of requests at
+first, which grows to every request over \fIduration\fR (such as "24h"). The
+other requests go to the previous URL until the rollout is done.
+.TP
+.BI \-i " name"
+Print the URL history of the specified \fIname\fR mapping.
+.TP
+.BI \-v " name \fR[\fPdays\fR]"
+Print the daily hits and unique visitors of the specified \fIname\fR mapping
+over the last \fIdays\fR when specified. Unique visitors are only counted
+when the "uniques" stats option is enabled.
+.TP
+.BI \-b " name ID"
+Rollback the specified \fIname\fR mapping to the history \fIID\fR.
+.TP
+.BI \-p " name option"
+Set if extra path and query data is added to the URL of the specified
+\fIname\fR mapping, one of "true", "false" or "default".
+.TP
+.BI \-z " name option"
+Set if the specified \fIname\fR mapping is sent as an HTML page that redirects
+with a meta refresh (without a referrer) instead of a redirect, one of "true",
+"false" or "default".
+.TP
+.BI \-n " name URL"
+Set the mobile app deep link \fIURL\fR of the specified \fIname\fR mapping, or
+remove it when \fIURL\fR is "none". Mobile devices get a page that opens the app
+and falls back to the mapping URL.
+.TP
+.BI \-t " name title \fR[\fPdescription\fR] [\fPimage\fR]"
+Set the social media preview \fItitle\fR, \fIdescription\fR and \fIimage\fR URL
+of the specified \fIname\fR mapping, or remove them when \fItitle\fR is "none".
+Social media crawlers get a page with this metadata instead of a redirect.
+.TP
+.BI \-k " name key"
+Set the signing \fIkey\fR of the specified \fIname\fR mapping, or remove it when
+\fIkey\fR is "none". Requests for a signed mapping need a valid signature.
+.TP
+.BI \-f " name referrers"
+Set the comma separated allowed \fIreferrers\fR (host names or URL prefixes) of
+the specified \fIname\fR mapping, or remove them when \fIreferrers\fR is "none".
+Requests without a matching referrer get a not found response.
+.TP
+.BI \-geo " name countries"
+Set the comma separated allowed country codes (or denied codes with a "!"
+prefix) of the specified \fIname\fR mapping, or remove them when
+\fIcountries\fR is "none". Requests from other countries get the geo blocked
+response.
+.TP
+.BI \-w " name schedule"
+Set the schedule of the specified \fIname\fR mapping to the JSON list of time
+windows in \fIschedule\fR, or remove it when \fIschedule\fR is "none". During a
+window the mapping redirects to the "url" of the window instead.
+.TP
+.BI \-j " name headers"
+Set the extra response headers of the specified \fIname\fR mapping to the JSON
+object of header names and values in \fIheaders\fR (such as
+{"X-Robots-Tag":"noindex"}), or remove them when \fIheaders\fR is "none".
+.TP
+.BI \-q " name \fR[\fPduration\fR]"
+Print the signed path of the specified \fIname\fR mapping, which expires after
+\fIduration\fR (such as "24h") when specified.
+.TP
+.BI \-e " from \fR[\fPto\fR]"
+Print the campaign report of the mappings with a "utm_campaign" URL parameter
+from the \fIfrom\fR date to the \fIto\fR date (or today), both as
+"YYYY-MM-DD". Each row has the campaign, source, medium, name, hits and unique
+visitors of a mapping over the report dates.
+.TP
+.B \-x
+Encrypt the URLs (and URL history) and signing keys of all mappings with the
+current encryption key. Values encrypted with a previous key are re-encrypted,
+which rotates keys, while values already encrypted with the current key are not
+changed.
+.TP
+.BI \-y " \fR[\fPfix\fR]"
+Check the database for problems, such as missing indexes, columns that are too
+small for the supported name and URL sizes, MySQL tables that do not use the
+utf8mb4 character set or Bolt entries that cannot be read, and fix them when
+\fIfix\fR is "fix". Exits with an error status when problems are found.
+.TP
+.BI \-m " file"
+Import the mappings exported from another URL shortener (a YOURLS SQL dump or
+a Shlink or Bitly CSV export) or by \fB\-l\fR in \fIfile\fR, or standard input
+when \fIfile\fR is "\-". Existing names are skipped.
+.TP
+.BI \-o " format"
+Output format of the list, history, visits and report, one of "table" (the
+default), "json", "csv" or "xlsx" (a spreadsheet). The list can also be printed
+as web server redirects with "nginx"
+(a map of names to URLs) or "caddy" (redir directives), or as DNS zone file
+TXT records with "dns".
+.TP
+.BI \-c " file"
+Configuration file path.
+.TP
+.BI \-g " type"
+Print a shell completion script ("bash", "zsh" or "fish") or this man page
+("man") and exit.
+.SH ENVIRONMENT
+.TP
+.B LINKER_CONFIG
+Configuration file path, used when \fB\-c\fR is not specified.
+.SH FILES
+.TP
+.I /etc/linker.conf
+Default configuration file path.
+`
@@ -17,8 +17,12 @@
 package main
 
 import (
+	"encoding/json"
 	"flag"
 	"os"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/iDigitalFlame/linker"
 )
@@ -31,28 +35,111 @@ Usage:
   -l              List the URL mapping and exit.
   -s              Start the Linker HTTP service.
   -d              Dump the default configuration and exit.
+  -version        Print the version and build information and exit.
   -a <name> <URL> Add the specified <name> to <URL> mapping.
   -r <name>       Delete the specified <name> to URL mapping.
+  -u <name> <URL> [duration] [percent]
+                  Update the specified <name> mapping to <URL>, or roll out
+                  <URL> to [percent] (or none) of requests growing to every
+                  request over [duration] (such as "24h") when specified.
+  -i <name>       Print the URL history of the specified <name> mapping.
+  -v <name> [days]
+                  Print the daily hits and unique visitors of the specified
+                  <name> mapping over the last [days] when specified.
+  -b <name> <ID>  Rollback the specified <name> mapping to the history <ID>.
+  -p <name> <opt> Set if extra path and query data is added to the URL of the
+                  specified <name> mapping, one of "true", "false" or "default".
+  -z <name> <opt> Set if the specified <name> mapping is sent as a refresh page
+                  instead of a redirect, one of "true", "false" or "default".
+  -n <name> <URL> Set the mobile app deep link <URL> of the specified <name>
+                  mapping, or remove it when <URL> is "none".
+  -t <name> <title> [description] [image]
+                  Set the social media preview title, description and image
+                  URL of the specified <name> mapping, or remove them when
+                  <title> is "none".
+  -k <name> <key> Set the signing <key> of the specified <name> mapping, or
+                  remove it when <key> is "none".
+  -f <name> <referrers>
+                  Set the comma separated allowed <referrers> (host names or
+                  URL prefixes) of the specified <name> mapping, or remove
+                  them when <referrers> is "none".
+  -geo <name> <countries>
+                  Set the comma separated country codes allowed (or denied
+                  with a "!" prefix, such as "!RU") of the specified <name>
+                  mapping, or remove them when <countries> is "none".
+  -w <name> <schedule>
+                  Set the schedule of the specified <name> mapping to the JSON
+                  list of time windows in <schedule>, or remove it when
+                  <schedule> is "none".
+  -j <name> <headers>
+                  Set the extra response headers of the specified <name>
+                  mapping to the JSON object of header names and values in
+                  <headers>, or remove them when <headers> is "none".
+  -q <name> [duration]
+                  Print the signed path of the specified <name> mapping, which
+                  expires after [duration] (such as "24h") when specified.
+  -e <from> [to]  Print the campaign report of the mappings with a
+                  "utm_campaign" URL parameter from the <from> date to the [to]
+                  date (or today), both as "YYYY-MM-DD".
+  -x              Encrypt the URLs and signing keys of all mappings with the
+                  current encryption key, which also rotates previous keys.
+  -y [fix]        Check the database for problems (such as missing indexes
+                  or columns that are too small), and fix them when [fix] is
+                  "fix".
+  -m <file>       Import the mappings exported from another URL shortener
+                  (YOURLS SQL dump, Shlink or Bitly CSV) or by "-l" in <file>,
+                  or standard input when <file> is "-".
+  -o <format>     Output format of the list, history, visits and report, one
+                  of "table" (the default), "json", "csv" or "xlsx". The list
+                  can also be printed as web server redirects with "nginx" or
+                  "caddy" or as DNS TXT records with "dns".
   -c <file>       Configuration file path. The environment variable
                   "LINKER_CONFIG" can be used to specify the file path instead.
+  -g <type>       Print a shell completion script ("bash", "zsh" or "fish")
+                  or the man page ("man") and exit.
 `
 
 func main() {
 	var (
-		args                = flag.NewFlagSet("Linker - HTTP Web URL Shortener v2", flag.ExitOnError)
-		list, dump, listen  bool
-		add, delete, config string
+		args                                      = flag.NewFlagSet("Linker - HTTP Web URL Shortener v2", flag.ExitOnError)
+		list, dump, listen, crypt, check, version bool
+		add, delete, config, update, hist, revert string
+		output, gen, path, load, app, meta        string
+		key, refs, sched, sign, visits, report    string
+		heads, refresh, geo                       string
 	)
 	args.Usage = func() {
 		os.Stderr.WriteString(usage)
 		os.Exit(2)
 	}
 	args.StringVar(&config, "c", "", "Configuration file path.")
+	args.StringVar(&output, "o", "table", "Output format of the list, history, visits and report.")
+	args.StringVar(&output, "output", "table", "Output format of the list, history, visits and report.")
+	args.StringVar(&gen, "g", "", "Print a shell completion script or the man page and exit.")
 	args.BoolVar(&list, "l", false, "List the URL mapping and exit.")
 	args.BoolVar(&listen, "s", false, "Start the Linker HTTP service.")
 	args.BoolVar(&dump, "d", false, "Dump the default configuration and exit.")
+	args.BoolVar(&version, "version", false, "Print the version and build information and exit.")
 	args.StringVar(&add, "a", "", "Add the specified <name> to <URL> mapping.")
 	args.StringVar(&delete, "r", "", "Delete the specified <name> to URL mapping.")
+	args.StringVar(&update, "u", "", "Update the specified <name> mapping to <URL>.")
+	args.StringVar(&hist, "i", "", "Print the URL history of the specified <name> mapping.")
+	args.StringVar(&visits, "v", "", "Print the daily hits and unique visitors of the specified <name> mapping.")
+	args.StringVar(&revert, "b", "", "Rollback the specified <name> mapping to the history <ID>.")
+	args.StringVar(&path, "p", "", "Set if extra path and query data is added to the specified <name> mapping.")
+	args.StringVar(&refresh, "z", "", "Set if the specified <name> mapping is sent as a refresh page.")
+	args.StringVar(&app, "n", "", "Set the mobile app deep link <URL> of the specified <name> mapping.")
+	args.StringVar(&meta, "t", "", "Set the social media preview <title> of the specified <name> mapping.")
+	args.StringVar(&key, "k", "", "Set the signing <key> of the specified <name> mapping.")
+	args.StringVar(&refs, "f", "", "Set the allowed <referrers> of the specified <name> mapping.")
+	args.StringVar(&geo, "geo", "", "Set the allowed or denied <countries> of the specified <name> mapping.")
+	args.StringVar(&sched, "w", "", "Set the schedule of the specified <name> mapping.")
+	args.StringVar(&heads, "j", "", "Set the extra response headers of the specified <name> mapping.")
+	args.StringVar(&sign, "q", "", "Print the signed path of the specified <name> mapping.")
+	args.StringVar(&report, "e", "", "Print the campaign report from the specified <from> date.")
+	args.BoolVar(&crypt, "x", false, "Encrypt the URLs and signing keys of all mappings with the current encryption key.")
+	args.BoolVar(&check, "y", false, "Check the database for problems, and fix them when [fix] is \"fix\".")
+	args.StringVar(&load, "m", "", "Import the mappings exported from another URL shortener in <file>.")
 
 	if err := args.Parse(os.Args[1:]); err != nil {
 		os.Stderr.WriteString(usage)
@@ -63,6 +150,35 @@ func main() {
 		os.Stdout.WriteString(linker.Defaults)
 		os.Exit(0)
 	}
+	if version {
+		os.Stdout.WriteString("Linker " + linker.Info().String() + "\n")
+		os.Exit(0)
+	}
+
+	switch gen {
+	case "":
+	case "bash":
+		os.Stdout.WriteString(completeBash)
+		os.Exit(0)
+	case "zsh":
+		os.Stdout.WriteString(completeZsh)
+		os.Exit(0)
+	case "fish":
+		os.Stdout.WriteString(completeFish)
+		os.Exit(0)
+	case "man":
+		os.Stdout.WriteString(manPage)
+		os.Exit(0)
+	default:
+		os.Stdout.WriteString(`Error: invalid completion type "` + gen + `"!` + "\n")
+		os.Exit(2)
+	}
+
+	f, err := linker.ParseFormat(output)
+	if err != nil {
+		os.Stdout.WriteString("Error: " + err.Error() + "!\n")
+		os.Exit(2)
+	}
 
 	l, err := linker.New(config)
 	if err != nil {
@@ -72,7 +188,11 @@ func main() {
 
 	switch {
 	case list:
-		if err = l.List(); err != nil {
+		var v []linker.Link
+		if v, err = l.Links(); err == nil {
+			err = f.WriteLinks(os.Stdout, v)
+		}
+		if err != nil {
 			l.Close()
 			os.Stdout.WriteString("Error: " + err.Error() + "!\n")
 			os.Exit(1)
@@ -87,18 +207,386 @@ func main() {
 		if len(a) < 1 {
 			l.Close()
 			os.Stderr.WriteString(usage)
+			os.Exit(2)
 		}
 		if err = l.Add(add, a[0]); err != nil {
 			l.Close()
-			os.Stdout.WriteString(`Error adding "` + a[0] + `": ` + err.Error() + "!\n")
+			os.Stdout.WriteString(`Error adding "` + add + `": ` + err.Error() + "!\n")
+			os.Exit(1)
 		}
 		os.Stdout.WriteString(`Added mapping "` + add + `" to "` + a[0] + `"!` + "\n")
 	case len(delete) > 0:
 		if err = l.Delete(delete); err != nil {
 			l.Close()
 			os.Stdout.WriteString(`Error removing "` + delete + `": ` + err.Error() + "!\n")
+			os.Exit(1)
 		}
 		os.Stdout.WriteString(`Deleted mapping "` + delete + `"!` + "\n")
+	case len(update) > 0:
+		a := args.Args()
+		if len(a) < 1 {
+			l.Close()
+			os.Stderr.WriteString(usage)
+			os.Exit(2)
+		}
+		var (
+			d time.Duration
+			p uint64
+		)
+		if len(a) > 1 {
+			if d, err = time.ParseDuration(a[1]); err != nil || d <= 0 {
+				l.Close()
+				os.Stdout.WriteString(`Error: invalid duration "` + a[1] + `"!` + "\n")
+				os.Exit(1)
+			}
+		}
+		if len(a) > 2 {
+			if p, err = strconv.ParseUint(a[2], 10, 8); err != nil || p > 100 {
+				l.Close()
+				os.Stdout.WriteString(`Error: invalid rollout percent "` + a[2] + `"!` + "\n")
+				os.Exit(1)
+			}
+		}
+		if err = l.Rollout(update, a[0], d, uint8(p)); err != nil {
+			l.Close()
+			os.Stdout.WriteString(`Error updating "` + update + `": ` + err.Error() + "!\n")
+			os.Exit(1)
+		}
+		if d > 0 {
+			os.Stdout.WriteString(`Rolling out mapping "` + update + `" to "` + a[0] + `" over ` + d.String() + "!\n")
+		} else {
+			os.Stdout.WriteString(`Updated mapping "` + update + `" to "` + a[0] + `"!` + "\n")
+		}
+	case len(hist) > 0:
+		var v []linker.Version
+		if v, err = l.History(hist); err != nil {
+			l.Close()
+			os.Stdout.WriteString(`Error reading history of "` + hist + `": ` + err.Error() + "!\n")
+			os.Exit(1)
+		}
+		if err = f.WriteHistory(os.Stdout, v); err != nil {
+			l.Close()
+			os.Stdout.WriteString("Error: " + err.Error() + "!\n")
+			os.Exit(1)
+		}
+	case len(visits) > 0:
+		var (
+			v []linker.Day
+			d int
+		)
+		if a := args.Args(); len(a) > 0 {
+			if d, err = strconv.Atoi(a[0]); err != nil || d < 0 {
+				l.Close()
+				os.Stdout.WriteString(`Error: invalid day count "` + a[0] + `"!` + "\n")
+				os.Exit(1)
+			}
+		}
+		if v, err = l.Visits(visits, d); err != nil {
+			l.Close()
+			os.Stdout.WriteString(`Error reading visits of "` + visits + `": ` + err.Error() + "!\n")
+			os.Exit(1)
+		}
+		if err = f.WriteVisits(os.Stdout, v); err != nil {
+			l.Close()
+			os.Stdout.WriteString("Error: " + err.Error() + "!\n")
+			os.Exit(1)
+		}
+	case len(revert) > 0:
+		a := args.Args()
+		if len(a) < 1 {
+			l.Close()
+			os.Stderr.WriteString(usage)
+			os.Exit(2)
+		}
+		i, err := strconv.ParseUint(a[0], 10, 64)
+		if err != nil {
+			l.Close()
+			os.Stdout.WriteString(`Error: invalid history ID "` + a[0] + `"!` + "\n")
+			os.Exit(1)
+		}
+		if err = l.Rollback(revert, i); err != nil {
+			l.Close()
+			os.Stdout.WriteString(`Error rolling back "` + revert + `": ` + err.Error() + "!\n")
+			os.Exit(1)
+		}
+		os.Stdout.WriteString(`Rolled back mapping "` + revert + `" to history ID "` + a[0] + `"!` + "\n")
+	case len(path) > 0:
+		a := args.Args()
+		if len(a) < 1 {
+			l.Close()
+			os.Stderr.WriteString(usage)
+			os.Exit(2)
+		}
+		var v *bool
+		if a[0] != "default" {
+			b, err := strconv.ParseBool(a[0])
+			if err != nil {
+				l.Close()
+				os.Stdout.WriteString(`Error: invalid append value "` + a[0] + `"!` + "\n")
+				os.Exit(1)
+			}
+			v = &b
+		}
+		if err = l.SetAppend(path, v); err != nil {
+			l.Close()
+			os.Stdout.WriteString(`Error changing "` + path + `": ` + err.Error() + "!\n")
+			os.Exit(1)
+		}
+		os.Stdout.WriteString(`Set append of mapping "` + path + `" to "` + a[0] + `"!` + "\n")
+	case len(refresh) > 0:
+		a := args.Args()
+		if len(a) < 1 {
+			l.Close()
+			os.Stderr.WriteString(usage)
+			os.Exit(2)
+		}
+		var v *bool
+		if a[0] != "default" {
+			b, err := strconv.ParseBool(a[0])
+			if err != nil {
+				l.Close()
+				os.Stdout.WriteString(`Error: invalid refresh value "` + a[0] + `"!` + "\n")
+				os.Exit(1)
+			}
+			v = &b
+		}
+		if err = l.SetRefresh(refresh, v); err != nil {
+			l.Close()
+			os.Stdout.WriteString(`Error changing "` + refresh + `": ` + err.Error() + "!\n")
+			os.Exit(1)
+		}
+		os.Stdout.WriteString(`Set refresh of mapping "` + refresh + `" to "` + a[0] + `"!` + "\n")
+	case len(app) > 0:
+		a := args.Args()
+		if len(a) < 1 {
+			l.Close()
+			os.Stderr.WriteString(usage)
+			os.Exit(2)
+		}
+		var u string
+		if a[0] != "none" {
+			u = a[0]
+		}
+		if err = l.SetApp(app, u); err != nil {
+			l.Close()
+			os.Stdout.WriteString(`Error changing "` + app + `": ` + err.Error() + "!\n")
+			os.Exit(1)
+		}
+		os.Stdout.WriteString(`Set app URL of mapping "` + app + `" to "` + a[0] + `"!` + "\n")
+	case len(meta) > 0:
+		a := args.Args()
+		if len(a) < 1 {
+			l.Close()
+			os.Stderr.WriteString(usage)
+			os.Exit(2)
+		}
+		var m *linker.Meta
+		if a[0] != "none" {
+			m = &linker.Meta{Title: a[0]}
+			if len(a) > 1 {
+				m.Description = a[1]
+			}
+			if len(a) > 2 {
+				m.Image = a[2]
+			}
+		}
+		if err = l.SetMeta(meta, m); err != nil {
+			l.Close()
+			os.Stdout.WriteString(`Error changing "` + meta + `": ` + err.Error() + "!\n")
+			os.Exit(1)
+		}
+		os.Stdout.WriteString(`Set preview of mapping "` + meta + `" to "` + a[0] + `"!` + "\n")
+	case len(key) > 0:
+		a := args.Args()
+		if len(a) < 1 {
+			l.Close()
+			os.Stderr.WriteString(usage)
+			os.Exit(2)
+		}
+		var k string
+		if a[0] != "none" {
+			k = a[0]
+		}
+		if err = l.SetKey(key, k); err != nil {
+			l.Close()
+			os.Stdout.WriteString(`Error changing "` + key + `": ` + err.Error() + "!\n")
+			os.Exit(1)
+		}
+		os.Stdout.WriteString(`Set signing key of mapping "` + key + `"!` + "\n")
+	case len(refs) > 0:
+		a := args.Args()
+		if len(a) < 1 {
+			l.Close()
+			os.Stderr.WriteString(usage)
+			os.Exit(2)
+		}
+		var v []string
+		if a[0] != "none" {
+			v = strings.Split(a[0], ",")
+		}
+		if err = l.SetReferrers(refs, v); err != nil {
+			l.Close()
+			os.Stdout.WriteString(`Error changing "` + refs + `": ` + err.Error() + "!\n")
+			os.Exit(1)
+		}
+		os.Stdout.WriteString(`Set referrers of mapping "` + refs + `"!` + "\n")
+	case len(geo) > 0:
+		a := args.Args()
+		if len(a) < 1 {
+			l.Close()
+			os.Stderr.WriteString(usage)
+			os.Exit(2)
+		}
+		var v []string
+		if a[0] != "none" {
+			v = strings.Split(a[0], ",")
+		}
+		if err = l.SetCountries(geo, v); err != nil {
+			l.Close()
+			os.Stdout.WriteString(`Error changing "` + geo + `": ` + err.Error() + "!\n")
+			os.Exit(1)
+		}
+		os.Stdout.WriteString(`Set countries of mapping "` + geo + `"!` + "\n")
+	case len(sched) > 0:
+		a := args.Args()
+		if len(a) < 1 {
+			l.Close()
+			os.Stderr.WriteString(usage)
+			os.Exit(2)
+		}
+		var v []linker.Schedule
+		if a[0] != "none" {
+			if err = json.Unmarshal([]byte(a[0]), &v); err != nil {
+				l.Close()
+				os.Stdout.WriteString(`Error reading schedule "` + a[0] + `": ` + err.Error() + "!\n")
+				os.Exit(1)
+			}
+		}
+		if err = l.SetSchedule(sched, v); err != nil {
+			l.Close()
+			os.Stdout.WriteString(`Error changing "` + sched + `": ` + err.Error() + "!\n")
+			os.Exit(1)
+		}
+		os.Stdout.WriteString(`Set schedule of mapping "` + sched + `"!` + "\n")
+	case len(heads) > 0:
+		a := args.Args()
+		if len(a) < 1 {
+			l.Close()
+			os.Stderr.WriteString(usage)
+			os.Exit(2)
+		}
+		var v map[string]string
+		if a[0] != "none" {
+			if err = json.Unmarshal([]byte(a[0]), &v); err != nil {
+				l.Close()
+				os.Stdout.WriteString(`Error reading headers "` + a[0] + `": ` + err.Error() + "!\n")
+				os.Exit(1)
+			}
+		}
+		if err = l.SetHeaders(heads, v); err != nil {
+			l.Close()
+			os.Stdout.WriteString(`Error changing "` + heads + `": ` + err.Error() + "!\n")
+			os.Exit(1)
+		}
+		os.Stdout.WriteString(`Set headers of mapping "` + heads + `"!` + "\n")
+	case len(sign) > 0:
+		var d time.Duration
+		if a := args.Args(); len(a) > 0 {
+			if d, err = time.ParseDuration(a[0]); err != nil || d <= 0 {
+				l.Close()
+				os.Stdout.WriteString(`Error: invalid duration "` + a[0] + `"!` + "\n")
+				os.Exit(1)
+			}
+		}
+		var q string
+		if q, err = l.Sign(sign, d); err != nil {
+			l.Close()
+			os.Stdout.WriteString(`Error signing "` + sign + `": ` + err.Error() + "!\n")
+			os.Exit(1)
+		}
+		os.Stdout.WriteString("/" + sign + "?" + q + "\n")
+	case len(report) > 0:
+		var (
+			a    = args.Args()
+			s, e time.Time
+			v    []linker.Campaign
+		)
+		if s, err = time.Parse("2006-01-02", report); err != nil {
+			l.Close()
+			os.Stdout.WriteString(`Error: invalid report date "` + report + `"!` + "\n")
+			os.Exit(1)
+		}
+		if e = time.Now().UTC(); len(a) > 0 {
+			if e, err = time.Parse("2006-01-02", a[0]); err != nil {
+				l.Close()
+				os.Stdout.WriteString(`Error: invalid report date "` + a[0] + `"!` + "\n")
+				os.Exit(1)
+			}
+		}
+		if v, err = l.Campaigns(s, e); err != nil {
+			l.Close()
+			os.Stdout.WriteString("Error creating campaign report: " + err.Error() + "!\n")
+			os.Exit(1)
+		}
+		if err = f.WriteCampaigns(os.Stdout, v); err != nil {
+			l.Close()
+			os.Stdout.WriteString("Error: " + err.Error() + "!\n")
+			os.Exit(1)
+		}
+	case len(load) > 0:
+		var (
+			v []linker.Link
+			c int
+			r = os.Stdin
+		)
+		if load != "-" {
+			r, err = os.Open(load)
+		}
+		if err == nil {
+			v, err = linker.ReadImport(r)
+			r.Close()
+		}
+		if err == nil {
+			c, err = l.Import(v)
+		}
+		if err != nil {
+			l.Close()
+			os.Stdout.WriteString(`Error importing "` + load + `": ` + err.Error() + "!\n")
+			os.Exit(1)
+		}
+		os.Stdout.WriteString("Imported " + strconv.Itoa(c) + " of " + strconv.Itoa(len(v)) + ` mappings from "` + load + `"!` + "\n")
+	case check:
+		a := args.Args()
+		if len(a) > 0 && a[0] != "fix" {
+			l.Close()
+			os.Stderr.WriteString(usage)
+			os.Exit(2)
+		}
+		var v []string
+		if v, err = l.Check(len(a) > 0); err != nil {
+			l.Close()
+			os.Stdout.WriteString("Error checking the database: " + err.Error() + "!\n")
+			os.Exit(1)
+		}
+		for i := range v {
+			os.Stdout.WriteString("Problem: " + v[i] + "\n")
+		}
+		switch {
+		case len(v) == 0:
+			os.Stdout.WriteString("No database problems found!\n")
+		case len(a) > 0:
+			os.Stdout.WriteString("Fixed the database problems that can be fixed!\n")
+		default:
+			err = flag.ErrHelp
+		}
+	case crypt:
+		var c int
+		if c, err = l.Encrypt(); err != nil {
+			l.Close()
+			os.Stdout.WriteString("Error encrypting mappings: " + err.Error() + "!\n")
+			os.Exit(1)
+		}
+		os.Stdout.WriteString("Encrypted " + strconv.Itoa(c) + " mapping values!\n")
 	default:
 		os.Stderr.WriteString(usage)
 		err = flag.ErrHelp
@@ -0,0 +1,87 @@
+// crawlers.go
+// URL Shortener with MySQL database.
+//
+// Copyright (C) 2020 iDigitalFlame
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+//
+
+package linker
+
+import (
+	"html"
+	"net/http"
+	"strings"
+)
+
+const (
+	crawlRedirect uint8 = iota
+	crawlNoIndex
+	crawlBlock
+)
+
+var searches = [...]string{
+	"googlebot", "bingbot", "slurp", "duckduckbot", "baiduspider", "yandex", "applebot", "petalbot", "sogou",
+	"exabot", "seznambot", "qwantify", "ia_archiver",
+}
+
+type crawlers struct {
+	agents []string
+	action uint8
+}
+type crawlersConfig struct {
+	Action string   `json:"action"`
+	Agents []string `json:"agents"`
+}
+
+func (c *crawlers) load(v crawlersConfig) error {
+	switch strings.ToLower(v.Action) {
+	case "", "redirect":
+		c.action = crawlRedirect
+	case "noindex":
+		c.action = crawlNoIndex
+	case "block":
+		c.action = crawlBlock
+	default:
+		return &errval{s: `invalid crawler action "` + v.Action + `"`}
+	}
+	c.agents = make([]string, 0, len(searches)+len(socials)+len(v.Agents))
+	c.agents = append(append(c.agents, searches[:]...), socials[:]...)
+	for i := range v.Agents {
+		if len(v.Agents[i]) > 0 {
+			c.agents = append(c.agents, strings.ToLower(v.Agents[i]))
+		}
+	}
+	return nil
+}
+func (c *crawlers) crawler(r *http.Request) bool {
+	if c.action == crawlRedirect {
+		return false
+	}
+	a := strings.ToLower(r.UserAgent())
+	for i := range c.agents {
+		if strings.Contains(a, c.agents[i]) {
+			return true
+		}
+	}
+	return false
+}
+func noindex(w http.ResponseWriter, u string) {
+	u = html.EscapeString(u)
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("X-Robots-Tag", "noindex, nofollow")
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(`<!DOCTYPE html><html><head><meta charset="utf-8"><meta name="robots" content="noindex, nofollow">` +
+		`<title>Redirect</title></head><body><a href="` + u + `" rel="nofollow">` + u + `</a></body></html>`))
+}
@@ -0,0 +1,333 @@
+// crypt.go
+// URL Shortener with MySQL database.
+//
+// Copyright (C) 2020 iDigitalFlame
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+//
+
+package linker
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	crypto "crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"os"
+	"strings"
+	"time"
+)
+
+// sealPrefix is added to the start of encrypted values, followed by the key ID and a colon. Values without it
+// are read as plain text, so databases can be encrypted after they are created.
+const sealPrefix = "enc:"
+
+type sealed struct {
+	store
+	keys map[string]cipher.AEAD
+	id   string
+}
+type encryptionConfig struct {
+	Key      string   `json:"key"`
+	Previous []string `json:"previous"`
+}
+
+func seal(d store, c encryptionConfig) (store, error) {
+	if len(c.Key) == 0 {
+		c.Key = os.Getenv("LINKER_ENCRYPTION_KEY")
+	}
+	if len(c.Key) == 0 {
+		return d, nil
+	}
+	i, a, err := aead(c.Key)
+	if err != nil {
+		return nil, err
+	}
+	s := &sealed{store: d, id: i, keys: make(map[string]cipher.AEAD, 1+len(c.Previous))}
+	s.keys[i] = a
+	for x := range c.Previous {
+		if i, a, err = aead(c.Previous[x]); err != nil {
+			return nil, err
+		}
+		s.keys[i] = a
+	}
+	return s, nil
+}
+
+// Encrypt will encrypt the URLs (and URL history, app, schedule and Rollout URLs) and signing keys of all redirects
+// with the configured encryption key. Values stored as plain text or with one of the previous keys are re-encrypted,
+// while values already encrypted with the current key are not changed, so this can be used to rotate keys and can be
+// run again safely. This function returns the number of changed values and will return an error if encryption is not
+// configured, a value uses an unknown key or the change fails.
+func (l *Linker) Encrypt() (int, error) {
+	if l.db == nil {
+		return 0, errNotConfigured
+	}
+	s, ok := l.db.(*sealed)
+	if !ok {
+		return 0, &errval{s: "encryption is not configured"}
+	}
+	return s.rewrite(func(v string) (string, error) {
+		if len(v) == 0 || strings.HasPrefix(v, sealPrefix+s.id+":") {
+			return v, nil
+		}
+		u, err := s.decrypt(v)
+		if err != nil {
+			return "", err
+		}
+		return s.encrypt(u)
+	})
+}
+func aead(s string) (string, cipher.AEAD, error) {
+	k, err := base64.StdEncoding.DecodeString(s)
+	if err != nil || len(k) != 32 {
+		return "", nil, &errval{s: "encryption key must be 32 bytes encoded as base64", e: err}
+	}
+	b, err := aes.NewCipher(k)
+	if err != nil {
+		return "", nil, &errval{s: "unable to create encryption cipher", e: err}
+	}
+	a, err := cipher.NewGCM(b)
+	if err != nil {
+		return "", nil, &errval{s: "unable to create encryption cipher", e: err}
+	}
+	h := sha256.Sum256(k)
+	return base64.RawURLEncoding.EncodeToString(h[:6]), a, nil
+}
+func (s *sealed) encrypt(v string) (string, error) {
+	a := s.keys[s.id]
+	n := make([]byte, a.NonceSize(), a.NonceSize()+len(v)+a.Overhead())
+	if _, err := crypto.Read(n); err != nil {
+		return "", &errval{s: "unable to encrypt value", e: err}
+	}
+	return sealPrefix + s.id + ":" + base64.RawURLEncoding.EncodeToString(a.Seal(n, n, []byte(v), nil)), nil
+}
+func (s *sealed) decrypt(v string) (string, error) {
+	if !strings.HasPrefix(v, sealPrefix) {
+		return v, nil
+	}
+	i := strings.IndexByte(v[len(sealPrefix):], ':')
+	if i <= 0 {
+		return "", &errval{s: "encrypted value is invalid"}
+	}
+	a, ok := s.keys[v[len(sealPrefix):len(sealPrefix)+i]]
+	if !ok {
+		return "", &errval{s: `encryption key "` + v[len(sealPrefix):len(sealPrefix)+i] + `" is not configured`}
+	}
+	b, err := base64.RawURLEncoding.DecodeString(v[len(sealPrefix)+i+1:])
+	if err != nil || len(b) < a.NonceSize() {
+		return "", &errval{s: "encrypted value is invalid", e: err}
+	}
+	o, err := a.Open(nil, b[:a.NonceSize()], b[a.NonceSize():], nil)
+	if err != nil {
+		return "", &errval{s: "unable to decrypt value", e: err}
+	}
+	return string(o), nil
+}
+func (s *sealed) resize(n, u int) error {
+	// Encrypted URLs also store the prefix, key ID, nonce and tag and are encoded as base64.
+	return s.store.resize(n, len(sealPrefix)+9+((u+s.keys[s.id].NonceSize()+s.keys[s.id].Overhead())*4+2)/3)
+}
+func (s *sealed) links(v []Link) ([]Link, error) {
+	var err error
+	for i := range v {
+		if v[i].URL, err = s.decrypt(v[i].URL); err != nil {
+			return nil, err
+		}
+		if v[i].Key, err = s.decrypt(v[i].Key); err != nil {
+			return nil, err
+		}
+		if v[i].App, err = s.decrypt(v[i].App); err != nil {
+			return nil, err
+		}
+		if v[i].Rollout != nil {
+			r := *v[i].Rollout
+			if r.From, err = s.decrypt(r.From); err != nil {
+				return nil, err
+			}
+			v[i].Rollout = &r
+		}
+		if len(v[i].Schedule) > 0 {
+			w := append([]Schedule(nil), v[i].Schedule...)
+			for x := range w {
+				if w[x].URL, err = s.decrypt(w[x].URL); err != nil {
+					return nil, err
+				}
+			}
+			v[i].Schedule = w
+		}
+	}
+	return v, nil
+}
+func (s *sealed) add(n, u string) error {
+	v, err := s.encrypt(u)
+	if err != nil {
+		return err
+	}
+	return s.store.add(n, v)
+}
+func (s *sealed) claim(n, u, o string, q int) error {
+	v, err := s.encrypt(u)
+	if err != nil {
+		return err
+	}
+	return s.store.claim(n, v, o, q)
+}
+func (s *sealed) list() ([]Link, error) {
+	v, err := s.store.list()
+	if err != nil {
+		return nil, err
+	}
+	return s.links(v)
+}
+func (s *sealed) filter(x context.Context, f filter) ([]Link, error) {
+	v, err := s.store.filter(x, f)
+	if err != nil {
+		return nil, err
+	}
+	return s.links(v)
+}
+func (s *sealed) update(n, u string) error {
+	v, err := s.encrypt(u)
+	if err != nil {
+		return err
+	}
+	return s.store.update(n, v)
+}
+func (s *sealed) setRollout(n string, r *Rollout) error {
+	if r == nil {
+		return s.store.setRollout(n, r)
+	}
+	v, err := s.encrypt(r.From)
+	if err != nil {
+		return err
+	}
+	return s.store.setRollout(n, &Rollout{Start: r.Start, From: v, Ramp: r.Ramp, Percent: r.Percent})
+}
+func (s *sealed) setApp(n, a string) error {
+	if len(a) == 0 {
+		return s.store.setApp(n, a)
+	}
+	v, err := s.encrypt(a)
+	if err != nil {
+		return err
+	}
+	return s.store.setApp(n, v)
+}
+func (s *sealed) setSchedule(n string, v []Schedule) error {
+	w := make([]Schedule, len(v))
+	for i := range v {
+		u, err := s.encrypt(v[i].URL)
+		if err != nil {
+			return err
+		}
+		w[i], w[i].URL = v[i], u
+	}
+	return s.store.setSchedule(n, w)
+}
+func (s *sealed) setKey(n, k string) error {
+	if len(k) == 0 {
+		return s.store.setKey(n, k)
+	}
+	v, err := s.encrypt(k)
+	if err != nil {
+		return err
+	}
+	return s.store.setKey(n, v)
+}
+func (s *sealed) history(n string) ([]Version, error) {
+	v, err := s.store.history(n)
+	if err != nil {
+		return nil, err
+	}
+	for i := range v {
+		if v[i].URL, err = s.decrypt(v[i].URL); err != nil {
+			return nil, err
+		}
+	}
+	return v, nil
+}
+func (s *sealed) top(x context.Context, n int) ([]Link, error) {
+	v, err := s.store.top(x, n)
+	if err != nil {
+		return nil, err
+	}
+	return s.links(v)
+}
+func (s *sealed) search(_ context.Context, q string, n int) ([]Link, error) {
+	// Encrypted URLs can not be matched by the database, so every link is decrypted and matched here instead.
+	v, err := s.list()
+	if err != nil {
+		return nil, err
+	}
+	return match(v, q, n), nil
+}
+func (s *sealed) recent(x context.Context, n int) ([]Link, error) {
+	v, err := s.store.recent(x, n)
+	if err != nil {
+		return nil, err
+	}
+	return s.links(v)
+}
+func (s *sealed) get(x context.Context, n string) (record, error) {
+	r, err := s.store.get(x, n)
+	if err != nil {
+		return r, err
+	}
+	if r.url, err = s.decrypt(r.url); err != nil {
+		return r, err
+	}
+	if r.roll != nil {
+		v := *r.roll
+		if v.From, err = s.decrypt(v.From); err != nil {
+			return r, err
+		}
+		r.roll = &v
+	}
+	if r.app, err = s.decrypt(r.app); err != nil {
+		return r, err
+	}
+	if len(r.sched) > 0 {
+		w := append([]window(nil), r.sched...)
+		for i := range w {
+			if w[i].url, err = s.decrypt(w[i].url); err != nil {
+				return r, err
+			}
+		}
+		r.sched = w
+	}
+	r.key, err = s.decrypt(r.key)
+	return r, err
+}
+func (s *sealed) usage(x context.Context, f, t time.Time) ([]usage, error) {
+	v, err := s.store.usage(x, f, t)
+	if err != nil {
+		return nil, err
+	}
+	for i := range v {
+		if v[i].url, err = s.decrypt(v[i].url); err != nil {
+			return nil, err
+		}
+	}
+	return v, nil
+}
+func (s *sealed) popular(x context.Context, d time.Time, n int) ([]Link, error) {
+	v, err := s.store.popular(x, d, n)
+	if err != nil {
+		return nil, err
+	}
+	return s.links(v)
+}
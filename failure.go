@@ -0,0 +1,69 @@
+// failure.go
+// URL Shortener with MySQL database.
+//
+// Copyright (C) 2020 iDigitalFlame
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+//
+
+package linker
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+type failure struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+	Status  int    `json:"status"`
+}
+
+var (
+	failMethod       = failure{"method_not_allowed", "The request method is not allowed.", http.StatusMethodNotAllowed}
+	failNotFound     = failure{"not_found", "The requested page was not found.", http.StatusNotFound}
+	failUnauthorized = failure{"unauthorized", "The request is not authorized.", http.StatusUnauthorized}
+	failTooLarge     = failure{"too_large", "The request body is too large.", http.StatusRequestEntityTooLarge}
+	failLookup       = failure{"lookup_failed", "The redirect could not be loaded.", http.StatusInternalServerError}
+	failInternal     = failure{"internal", "The request could not be completed.", http.StatusInternalServerError}
+	failUnavailable  = failure{"unavailable", "The service is temporarily unavailable.", http.StatusServiceUnavailable}
+)
+
+func (f failure) write(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	if strings.Contains(r.Header.Get("Accept"), "application/json") {
+		f.json(w)
+		return
+	}
+	t := strconv.Itoa(f.Status) + " " + http.StatusText(f.Status)
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(f.Status)
+	w.Write([]byte(
+		`<!DOCTYPE html><html><head><meta charset="utf-8"><meta name="robots" content="noindex, nofollow"><title>` + t +
+			`</title></head><body><h1>` + t + `</h1><p>` + f.Message + `</p><p><code>` + f.Code + `</code></p></body></html>`,
+	))
+}
+func (f failure) json(w http.ResponseWriter) {
+	b, _ := json.Marshal(struct {
+		Error failure `json:"error"`
+	}{f})
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(f.Status)
+	w.Write(b)
+}
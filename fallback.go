@@ -0,0 +1,183 @@
+// fallback.go
+// URL Shortener with MySQL database.
+//
+// Copyright (C) 2020 iDigitalFlame
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+//
+
+package linker
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+const placeholder = "{path}"
+
+type urls []string
+type target struct {
+	url  string
+	down uint32
+}
+type fallback struct {
+	urls  []*target
+	hosts map[string][]*target
+	check time.Duration
+}
+type fallbackConfig struct {
+	Hosts map[string]urls `json:"hosts"`
+	Check duration        `json:"check"`
+}
+
+func (u *urls) UnmarshalJSON(b []byte) error {
+	if len(b) > 0 && b[0] == '"' {
+		var s string
+		if err := json.Unmarshal(b, &s); err != nil {
+			return err
+		}
+		if len(s) > 0 {
+			*u = urls{s}
+		}
+		return nil
+	}
+	var v []string
+	if err := json.Unmarshal(b, &v); err != nil {
+		return err
+	}
+	*u = v
+	return nil
+}
+func targets(v urls) ([]*target, error) {
+	if len(v) == 0 {
+		return nil, nil
+	}
+	r := make([]*target, 0, len(v))
+	for i := range v {
+		u, err := url.Parse(v[i])
+		if err != nil {
+			return nil, &errval{s: `unable to parse default URL "` + v[i] + `"`, e: err}
+		}
+		if !u.IsAbs() {
+			u.Scheme = "https"
+		}
+		r = append(r, &target{url: strings.Replace(u.String(), "%7Bpath%7D", placeholder, -1)})
+	}
+	return r, nil
+}
+func (f *fallback) load(d urls, c fallbackConfig) error {
+	var err error
+	if f.urls, err = targets(d); err != nil {
+		return err
+	}
+	if len(f.urls) == 0 {
+		f.urls = []*target{{url: defaultURL}}
+	}
+	if len(c.Hosts) > 0 {
+		f.hosts = make(map[string][]*target, len(c.Hosts))
+		for h, v := range c.Hosts {
+			t, err := targets(v)
+			if err != nil {
+				return err
+			}
+			if len(t) > 0 {
+				f.hosts[strings.ToLower(h)] = t
+			}
+		}
+	}
+	f.check = time.Duration(c.Check)
+	return nil
+}
+func first(v []*target) string {
+	for i := range v {
+		if atomic.LoadUint32(&v[i].down) == 0 {
+			return v[i].url
+		}
+	}
+	return v[0].url
+}
+func (f *fallback) get(r *http.Request) string {
+	if f.hosts != nil {
+		h := r.Host
+		if v, _, err := net.SplitHostPort(h); err == nil {
+			h = v
+		}
+		if v, ok := f.hosts[strings.ToLower(h)]; ok {
+			return first(v)
+		}
+	}
+	return first(f.urls)
+}
+func (f *fallback) watch(x context.Context) {
+	if f.check <= 0 {
+		return
+	}
+	f.probe(x)
+	t := time.NewTicker(f.check)
+	for {
+		select {
+		case <-t.C:
+			f.probe(x)
+		case <-x.Done():
+			t.Stop()
+			return
+		}
+	}
+}
+func (f *fallback) probe(x context.Context) {
+	c := http.Client{
+		Timeout:       defaultTimeout,
+		CheckRedirect: func(_ *http.Request, _ []*http.Request) error { return http.ErrUseLastResponse },
+	}
+	p := func(v []*target) {
+		if len(v) < 2 {
+			return
+		}
+		for i := range v {
+			var d uint32 = 1
+			u := strings.Replace(v[i].url, placeholder, "", -1)
+			if q, err := http.NewRequestWithContext(x, http.MethodHead, u, nil); err == nil {
+				if r, err := c.Do(q); err == nil {
+					if r.Body.Close(); r.StatusCode < 500 {
+						d = 0
+					}
+				}
+			}
+			atomic.StoreUint32(&v[i].down, d)
+		}
+	}
+	p(f.urls)
+	for _, v := range f.hosts {
+		p(v)
+	}
+}
+func (l *Linker) missing(w http.ResponseWriter, r *http.Request) {
+	u := l.def.get(r)
+	if i := strings.Index(u, placeholder); i >= 0 {
+		p := strings.TrimPrefix(r.URL.Path, "/")
+		if q := strings.IndexByte(u, '?'); q >= 0 && q < i {
+			p = url.QueryEscape(p)
+		} else {
+			p = url.PathEscape(p)
+		}
+		u = strings.Replace(u, placeholder, p, -1)
+	}
+	http.Redirect(w, r, u, http.StatusTemporaryRedirect)
+}
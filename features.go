@@ -0,0 +1,51 @@
+// features.go
+// URL Shortener with MySQL database.
+//
+// Copyright (C) 2020 iDigitalFlame
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+//
+
+package linker
+
+import "encoding/json"
+
+// optional is the list of the optional subsystems that can be turned off in the "features" config section.
+var optional = [...]string{"stats", "api", "claim", "search", "popular", "feed", "previews", "apps"}
+
+type features map[string]bool
+
+func (f features) enabled(n string) bool {
+	v, ok := f[n]
+	return !ok || v
+}
+func (f *features) UnmarshalJSON(b []byte) error {
+	var m map[string]bool
+	if err := json.Unmarshal(b, &m); err != nil {
+		return err
+	}
+	for k := range m {
+		var ok bool
+		for i := range optional {
+			if ok = k == optional[i]; ok {
+				break
+			}
+		}
+		if !ok {
+			return &errval{s: `unknown feature "` + k + `"`}
+		}
+	}
+	*f = m
+	return nil
+}
@@ -0,0 +1,192 @@
+// feed.go
+// URL Shortener with MySQL database.
+//
+// Copyright (C) 2020 iDigitalFlame
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+//
+
+package linker
+
+import (
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const defaultFeedTitle = "Linker"
+
+type feed struct {
+	path  string
+	title string
+	base  string
+	limit int
+}
+type feedConfig struct {
+	Path  string `json:"path"`
+	Base  string `json:"base"`
+	Title string `json:"title"`
+	Limit uint16 `json:"limit"`
+}
+type rssFeed struct {
+	XMLName xml.Name   `xml:"rss"`
+	Version string     `xml:"version,attr"`
+	Channel rssChannel `xml:"channel"`
+}
+type rssChannel struct {
+	Title       string    `xml:"title"`
+	Link        string    `xml:"link"`
+	Description string    `xml:"description"`
+	Items       []rssItem `xml:"item"`
+}
+type rssItem struct {
+	Title       string `xml:"title"`
+	Link        string `xml:"link"`
+	GUID        string `xml:"guid"`
+	Description string `xml:"description"`
+	Date        string `xml:"pubDate,omitempty"`
+}
+type jsonFeed struct {
+	Version string     `json:"version"`
+	Title   string     `json:"title"`
+	Home    string     `json:"home_page_url"`
+	URL     string     `json:"feed_url"`
+	Items   []jsonItem `json:"items"`
+}
+type jsonItem struct {
+	Date    *time.Time `json:"date_published,omitempty"`
+	ID      string     `json:"id"`
+	URL     string     `json:"url"`
+	Link    string     `json:"external_url"`
+	Title   string     `json:"title"`
+	Summary string     `json:"summary,omitempty"`
+	Text    string     `json:"content_text"`
+}
+
+func (f *feed) load(c feedConfig) error {
+	if len(c.Path) == 0 {
+		return nil
+	}
+	if c.Path[0] != '/' || len(c.Path) == 1 {
+		return &errval{s: `invalid feed path "` + c.Path + `"`}
+	}
+	if f.path, f.title, f.limit = c.Path, c.Title, int(c.Limit); len(f.title) == 0 {
+		f.title = defaultFeedTitle
+	}
+	if f.limit == 0 {
+		f.limit = defaultSearchLimit
+	}
+	if f.base = c.Base; len(f.base) > 0 && !strings.HasSuffix(f.base, "/") {
+		f.base += "/"
+	}
+	return nil
+}
+
+// Recent will return up to the supplied number of the most recently added redirects, with the newest first.
+// Redirects with a signing key or referrers are not included. This function will return an error if the lookup
+// fails.
+func (l *Linker) Recent(n int) ([]Link, error) {
+	if l.db == nil {
+		return nil, errNotConfigured
+	}
+	if n <= 0 {
+		return nil, nil
+	}
+	x := l.ctx
+	if x == nil {
+		x = context.Background()
+	}
+	v, err := l.db.recent(x, n)
+	if err != nil {
+		return nil, err
+	}
+	return visible(v), nil
+}
+func (f *feed) root(r *http.Request) string {
+	if len(f.base) > 0 {
+		return f.base
+	}
+	s := "http"
+	if r.TLS != nil || strings.EqualFold(r.Header.Get("X-Forwarded-Proto"), "https") {
+		s = "https"
+	}
+	return s + "://" + r.Host + "/"
+}
+func (l *Linker) feed(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	l.lock.RLock()
+	c := l.news
+	l.lock.RUnlock()
+	v, err := l.Recent(c.limit)
+	if err != nil {
+		l.report.error("Unable to list recent names", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	var (
+		b []byte
+		h = c.root(r)
+		t = "application/rss+xml; charset=utf-8"
+	)
+	if r.URL.Query().Get("format") == "json" || strings.Contains(r.Header.Get("Accept"), "json") {
+		f := jsonFeed{
+			Version: "https://jsonfeed.org/version/1.1", Title: c.title, Home: h,
+			URL: h + strings.TrimPrefix(c.path, "/") + "?format=json", Items: make([]jsonItem, 0, len(v)),
+		}
+		for i := range v {
+			e := jsonItem{
+				ID: h + v[i].Name, URL: h + v[i].Name, Link: v[i].URL, Title: v[i].Name, Text: v[i].URL, Date: v[i].Created,
+			}
+			if v[i].Meta != nil {
+				e.Title, e.Summary = v[i].Meta.Title, v[i].Meta.Description
+			}
+			f.Items = append(f.Items, e)
+		}
+		t = "application/feed+json"
+		b, err = json.Marshal(f)
+	} else {
+		f := rssFeed{Version: "2.0", Channel: rssChannel{
+			Title: c.title, Link: h, Description: "Recently added redirects", Items: make([]rssItem, 0, len(v)),
+		}}
+		for i := range v {
+			e := rssItem{Title: v[i].Name, Link: h + v[i].Name, GUID: h + v[i].Name, Description: v[i].URL}
+			if v[i].Meta != nil {
+				e.Title = v[i].Meta.Title
+				if len(v[i].Meta.Description) > 0 {
+					e.Description = v[i].Meta.Description + " (" + v[i].URL + ")"
+				}
+			}
+			if v[i].Created != nil {
+				e.Date = v[i].Created.UTC().Format(time.RFC1123Z)
+			}
+			f.Channel.Items = append(f.Channel.Items, e)
+		}
+		if b, err = xml.Marshal(f); err == nil {
+			b = append([]byte(xml.Header), b...)
+		}
+	}
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", t)
+	w.WriteHeader(http.StatusOK)
+	w.Write(b)
+}
@@ -0,0 +1,149 @@
+// filter.go
+// URL Shortener with MySQL database.
+//
+// Copyright (C) 2020 iDigitalFlame
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+//
+
+package linker
+
+import (
+	"strings"
+)
+
+// fields is the list of Links table columns that can be used in a filter, keyed by the name used by filters. Any
+// other column name is rejected by the builder, so a column name never comes from user input.
+var fields = map[string]string{
+	"name": "LinkName", "hits": "LinkHits", "owner": "LinkOwner", "created": "LinkCreated",
+}
+
+// operators is the list of the comparisons that can be used in a filter.
+var operators = map[string]struct{}{
+	"=": {}, "<>": {}, "<": {}, "<=": {}, ">": {}, ">=": {}, "LIKE": {},
+}
+
+// escape escapes the LIKE wildcards in a value, so it is only matched as text.
+var escape = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+// builder is a small builder for SELECT statements that filter the Links table. Columns and operators must be in
+// the fields and operators lists and every value is passed as a statement argument, so filters never add user input
+// to the statement text. The first invalid column or operator is returned by build.
+type builder struct {
+	err   error
+	args  []interface{}
+	where []string
+	order string
+	limit int
+}
+
+// filter is a set of conditions used to select links. Empty values are ignored, so the zero value selects every
+// link. New list filters should add a field here and a condition in query and match.
+type filter struct {
+	owner  string
+	prefix string
+	limit  int
+}
+
+func (b *builder) top(n int) *builder {
+	if n > 0 {
+		b.limit = n
+	}
+	return b
+}
+func (b *builder) sort(f string, d bool) *builder {
+	c, err := field(f)
+	if err != nil {
+		if b.err == nil {
+			b.err = err
+		}
+		return b
+	}
+	if b.order = c; d {
+		b.order += " DESC"
+	}
+	return b
+}
+func (b *builder) is(f, o string, v interface{}) *builder {
+	c, err := field(f)
+	if err == nil {
+		if _, ok := operators[o]; !ok {
+			err = &errval{s: `invalid filter operator "` + o + `"`}
+		}
+	}
+	if err != nil {
+		if b.err == nil {
+			b.err = err
+		}
+		return b
+	}
+	b.where, b.args = append(b.where, c+" "+o+" ?"), append(b.args, v)
+	return b
+}
+func (b *builder) build(s string) (string, []interface{}, error) {
+	if b.err != nil {
+		return "", nil, b.err
+	}
+	var q strings.Builder
+	q.WriteString(s)
+	if len(b.where) > 0 {
+		q.WriteString(" WHERE " + strings.Join(b.where, " AND "))
+	}
+	if len(b.order) > 0 {
+		q.WriteString(" ORDER BY " + b.order)
+	}
+	if b.limit > 0 {
+		q.WriteString(" LIMIT ?")
+		return q.String(), append(b.args, b.limit), nil
+	}
+	return q.String(), b.args, nil
+}
+func field(f string) (string, error) {
+	c, ok := fields[f]
+	if !ok {
+		return "", &errval{s: `invalid filter column "` + f + `"`}
+	}
+	return c, nil
+}
+func (f filter) match(v Link) bool {
+	if len(f.owner) > 0 && v.Owner != f.owner {
+		return false
+	}
+	if len(f.prefix) > 0 && !strings.HasPrefix(v.Name, f.prefix) {
+		return false
+	}
+	return true
+}
+func (f filter) apply(v []Link) []Link {
+	var r []Link
+	for i := range v {
+		if !f.match(v[i]) {
+			continue
+		}
+		if r = append(r, v[i]); f.limit > 0 && len(r) >= f.limit {
+			break
+		}
+	}
+	return r
+}
+func (f filter) query() (string, []interface{}, error) {
+	var b builder
+	if len(f.owner) > 0 {
+		b.is("owner", "=", f.owner)
+	}
+	if len(f.prefix) > 0 {
+		b.is("name", "LIKE", escape.Replace(f.prefix)+"%")
+	}
+	return b.sort("name", false).top(f.limit).build(sqlList)
+}
@@ -0,0 +1,129 @@
+// filter_test.go
+// URL Shortener with MySQL database.
+//
+// Copyright (C) 2020 iDigitalFlame
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+//
+
+package linker
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestBuilder(t *testing.T) {
+	v := [...]struct {
+		name  string
+		build func(*builder) *builder
+		query string
+		err   string
+		args  []interface{}
+	}{
+		{"empty", func(b *builder) *builder { return b }, "SELECT", "", nil},
+		{
+			"where", func(b *builder) *builder { return b.is("owner", "=", "bob").is("hits", ">=", 5) },
+			"SELECT WHERE LinkOwner = ? AND LinkHits >= ?", "", []interface{}{"bob", 5},
+		},
+		{
+			"sort", func(b *builder) *builder { return b.sort("created", true) },
+			"SELECT ORDER BY LinkCreated DESC", "", nil,
+		},
+		{
+			"limit", func(b *builder) *builder { return b.is("name", "LIKE", "a%").sort("name", false).top(10) },
+			"SELECT WHERE LinkName LIKE ? ORDER BY LinkName LIMIT ?", "", []interface{}{"a%", 10},
+		},
+		{"zero limit", func(b *builder) *builder { return b.top(0) }, "SELECT", "", nil},
+		{
+			"invalid column", func(b *builder) *builder { return b.is("LinkURL", "=", "x") },
+			"", `invalid filter column "LinkURL"`, nil,
+		},
+		{
+			"invalid sort column", func(b *builder) *builder { return b.sort("name; DROP TABLE Links", false) },
+			"", `invalid filter column "name; DROP TABLE Links"`, nil,
+		},
+		{
+			"invalid operator", func(b *builder) *builder { return b.is("name", "= ? OR 1 =", "x") },
+			"", `invalid filter operator "= ? OR 1 ="`, nil,
+		},
+		{
+			"lower case operator", func(b *builder) *builder { return b.is("name", "like", "x") },
+			"", `invalid filter operator "like"`, nil,
+		},
+		{
+			"first error wins", func(b *builder) *builder { return b.is("nope", "=", 1).is("name", "!", 1).sort("bad", false) },
+			"", `invalid filter column "nope"`, nil,
+		},
+		{
+			"error after valid", func(b *builder) *builder { return b.is("name", "=", "a").sort("bad", false).top(5) },
+			"", `invalid filter column "bad"`, nil,
+		},
+	}
+	for _, c := range v {
+		t.Run(c.name, func(t *testing.T) {
+			q, a, err := c.build(new(builder)).build("SELECT")
+			if len(c.err) > 0 {
+				if err == nil || err.Error() != c.err {
+					t.Fatalf("error is %v, expected %q", err, c.err)
+				}
+				if len(q) > 0 || a != nil {
+					t.Fatalf("statement %q with %v was returned with an error", q, a)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if q != c.query {
+				t.Fatalf("statement is %q, expected %q", q, c.query)
+			}
+			if !reflect.DeepEqual(a, c.args) {
+				t.Fatalf("arguments are %#v, expected %#v", a, c.args)
+			}
+		})
+	}
+}
+func TestFilter(t *testing.T) {
+	v := [...]struct {
+		filter filter
+		query  string
+		args   []interface{}
+	}{
+		{filter{}, sqlList + " ORDER BY LinkName", nil},
+		{filter{owner: "bob"}, sqlList + " WHERE LinkOwner = ? ORDER BY LinkName", []interface{}{"bob"}},
+		{filter{prefix: "go"}, sqlList + " WHERE LinkName LIKE ? ORDER BY LinkName", []interface{}{"go%"}},
+		{filter{prefix: `a%b_c\`}, sqlList + " WHERE LinkName LIKE ? ORDER BY LinkName", []interface{}{`a\%b\_c\\%`}},
+		{
+			filter{owner: "bob", prefix: "x", limit: 3},
+			sqlList + " WHERE LinkOwner = ? AND LinkName LIKE ? ORDER BY LinkName LIMIT ?", []interface{}{"bob", "x%", 3},
+		},
+	}
+	for _, c := range v {
+		q, a, err := c.filter.query()
+		if err != nil {
+			t.Fatalf("query(%+v) returned an error: %s", c.filter, err)
+		}
+		if q != c.query || !reflect.DeepEqual(a, c.args) {
+			t.Errorf("query(%+v) is %q with %#v, expected %q with %#v", c.filter, q, a, c.query, c.args)
+		}
+	}
+	l := []Link{{Name: "a%b"}, {Name: "axb", Owner: "bob"}, {Name: "a_b", Owner: "bob"}, {Name: "b"}}
+	if r := (filter{prefix: "a%"}).apply(l); len(r) != 1 || r[0].Name != "a%b" {
+		t.Errorf("prefix %q matched %v, expected only %q", "a%", r, "a%b")
+	}
+	if r := (filter{owner: "bob", limit: 1}).apply(l); len(r) != 1 || r[0].Name != "axb" {
+		t.Errorf("owner %q with a limit matched %v, expected only %q", "bob", r, "axb")
+	}
+}
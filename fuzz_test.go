@@ -0,0 +1,111 @@
+// fuzz_test.go
+// URL Shortener with MySQL database.
+//
+// Copyright (C) 2020 iDigitalFlame
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+//
+
+package linker
+
+import (
+	"net/url"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func FuzzValidName(f *testing.F) {
+	for _, s := range [...]string{"foo", "Foo-Bar_9", "", "foo/bar", "foo bar", "f[o]o", "`", "{", "\xff"} {
+		f.Add(s)
+	}
+	r := regexp.MustCompile(`^[a-zA-Z0-9_-]+$`)
+	f.Fuzz(func(t *testing.T, s string) {
+		if v, e := validName(s), r.MatchString(s); v != e {
+			t.Fatalf("validName(%q) is %t, expected %t", s, v, e)
+		}
+	})
+}
+func FuzzRequest(f *testing.F) {
+	for _, s := range [...]string{
+		"/foo", "/foo/", "/foo/bar", "/foo%2Fbar", "/foo%252Fbar", "//foo//bar//", "/%66oo/x?y=1", "/foo?a=1&a=2",
+	} {
+		f.Add(s, false)
+		f.Add(s, true)
+	}
+	const b = "https://example.com/base?a=1#frag"
+	f.Fuzz(func(t *testing.T, p string, s bool) {
+		u, err := url.ParseRequestURI(p)
+		if err != nil {
+			return
+		}
+		n, e := request(u, s)
+		if len(n) == 0 {
+			if len(e) > 0 {
+				t.Fatalf("request(%q) has extra data %q without a name", p, e)
+			}
+			return
+		}
+		if !validName(n) {
+			t.Fatalf("request(%q) returned the invalid name %q", p, n)
+		}
+		if !s && (e == "/" || strings.Contains(e, "//")) {
+			t.Fatalf("request(%q) returned the unclean extra data %q", p, e)
+		}
+		if len(u.RawQuery) > 0 {
+			e = e + "?" + u.RawQuery
+		}
+		v, ok := (&view{}).extend(b, e)
+		if !ok {
+			return
+		}
+		r, err := url.Parse(v)
+		if err != nil {
+			t.Fatalf("extend(%q) returned the invalid URL %q: %s", e, v, err)
+		}
+		if r.Scheme != "https" || r.Host != "example.com" || r.User != nil {
+			t.Fatalf("extend(%q) returned the URL %q with a different host", e, v)
+		}
+		if !strings.HasSuffix(v, "#frag") || !strings.Contains(v, "a=1") {
+			t.Fatalf("extend(%q) returned the URL %q without the target query or fragment", e, v)
+		}
+		if j := join(b, e); j != v {
+			t.Fatalf("extend(%q) returned %q, but join returned %q", e, v, j)
+		}
+	})
+}
+func FuzzNormalize(f *testing.F) {
+	for _, s := range [...]string{
+		"HTTPS://Example.COM:443/a/../b?utm_source=x&q=1", "http://example.com:80", "https://bücher.example/ä?ö=1",
+		"http://[::1]:8080/x", "mailto:user@example.com", "https://example.com/a/./b/?fbclid=1#frag", "example.com/x",
+	} {
+		f.Add(s)
+	}
+	var l Linker
+	l.norm.load(normalizeConfig{Enabled: true, Tracking: true, Params: []string{"ref"}})
+	f.Fuzz(func(t *testing.T, s string) {
+		// A stored URL is parsed again when it is added to another redirect or imported, which must not change it.
+		u, err := l.parse(s)
+		if err != nil {
+			return
+		}
+		v, err := l.parse(u)
+		if err != nil {
+			t.Fatalf("parse(%q) returned %q, which can not be parsed again: %s", s, u, err)
+		}
+		if v != u {
+			t.Fatalf("parse(%q) is %q, but parsing it again is %q", s, u, v)
+		}
+	})
+}
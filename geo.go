@@ -0,0 +1,188 @@
+// geo.go
+// URL Shortener with MySQL database.
+//
+// Copyright (C) 2020 iDigitalFlame
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+//
+
+package linker
+
+import (
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/oschwald/maxminddb-golang"
+)
+
+type geo struct {
+	db     *maxminddb.Reader
+	allow  map[string]struct{}
+	deny   map[string]struct{}
+	header string
+	page   []byte
+	status int
+}
+type geoRecord struct {
+	Country struct {
+		Code string `maxminddb:"iso_code"`
+	} `maxminddb:"country"`
+}
+type geoConfig struct {
+	Page     string   `json:"page"`
+	Allow    []string `json:"allow"`
+	Deny     []string `json:"deny"`
+	Header   string   `json:"header"`
+	Database string   `json:"database"`
+	Status   uint16   `json:"status"`
+}
+
+// SetCountries will change the list of country rules of the redirect with the supplied name. Each rule is a two
+// letter country code that is allowed, or a code with a "!" prefix (such as "!RU") that is denied. When the list
+// has an allowed code, requests from any other country (including requests with an unknown country) are blocked
+// like the global geo rules, which also provide the country of the request. An empty list removes the rules. This
+// function will return an error if the change fails, a code is not valid or the name does not exist.
+func (l *Linker) SetCountries(n string, v []string) error {
+	if l.db == nil {
+		return errNotConfigured
+	}
+	if !validName(n) {
+		return &errval{s: `name "` + n + `" contains invalid characters`}
+	}
+	r := make([]string, 0, len(v))
+	for i := range v {
+		s := strings.ToUpper(strings.TrimSpace(v[i]))
+		if len(s) == 0 {
+			continue
+		}
+		if c := strings.TrimPrefix(s, "!"); len(c) != 2 || c[0] < 'A' || c[0] > 'Z' || c[1] < 'A' || c[1] > 'Z' {
+			return &errval{s: `invalid country code "` + v[i] + `"`}
+		}
+		r = append(r, s)
+	}
+	if len(r) == 0 {
+		r = nil
+	}
+	if err := l.db.setCountries(n, r); err != nil {
+		return err
+	}
+	l.cache.remove(n)
+	return nil
+}
+func set(v []string) map[string]struct{} {
+	if len(v) == 0 {
+		return nil
+	}
+	m := make(map[string]struct{}, len(v))
+	for i := range v {
+		m[strings.ToUpper(strings.TrimSpace(v[i]))] = struct{}{}
+	}
+	return m
+}
+func (g *geo) load(c geoConfig) error {
+	if len(c.Header) == 0 && len(c.Database) == 0 {
+		return nil
+	}
+	if g.header, g.status = c.Header, int(c.Status); g.status == 0 {
+		g.status = http.StatusUnavailableForLegalReasons
+	}
+	if g.status < 400 || g.status > 599 {
+		return &errval{s: "geo blocking status must be an HTTP error status"}
+	}
+	g.allow, g.deny = set(c.Allow), set(c.Deny)
+	if len(c.Page) > 0 {
+		b, err := ioutil.ReadFile(c.Page)
+		if err != nil {
+			return &errval{s: `unable to read geo blocking page "` + c.Page + `"`, e: err}
+		}
+		g.page = b
+	}
+	if len(c.Database) == 0 {
+		return nil
+	}
+	// The database is read into memory instead of being mapped, so a Reload does not have to wait for requests
+	// still using the previous database before closing it.
+	b, err := ioutil.ReadFile(c.Database)
+	if err != nil {
+		return &errval{s: `unable to read GeoIP database "` + c.Database + `"`, e: err}
+	}
+	if g.db, err = maxminddb.FromBytes(b); err != nil {
+		return &errval{s: `unable to parse GeoIP database "` + c.Database + `"`, e: err}
+	}
+	return nil
+}
+
+// country returns the two letter country code of the request. The country header is only read from requests sent
+// by a trusted proxy, as any client could set it, and the GeoIP database is used for the client address otherwise.
+func (g *geo) country(r *http.Request, p proxies, a string) string {
+	if len(g.header) > 0 && p.trusted(r) {
+		if c := strings.TrimSpace(r.Header.Get(g.header)); len(c) > 0 {
+			return strings.ToUpper(c)
+		}
+	}
+	if g.db == nil {
+		return ""
+	}
+	x := net.ParseIP(a)
+	if x == nil {
+		return ""
+	}
+	var v geoRecord
+	if err := g.db.Lookup(x, &v); err != nil {
+		return ""
+	}
+	return v.Country.Code
+}
+func (g *geo) write(w http.ResponseWriter) {
+	s := g.status
+	if s == 0 {
+		s = http.StatusUnavailableForLegalReasons
+	}
+	if len(g.page) == 0 {
+		w.WriteHeader(s)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(s)
+	w.Write(g.page)
+}
+func (g *geo) blocked(w http.ResponseWriter, c string) bool {
+	if len(g.header) == 0 && g.db == nil {
+		return false
+	}
+	if _, ok := g.deny[c]; !ok {
+		if _, ok = g.allow[c]; ok || g.allow == nil {
+			return false
+		}
+	}
+	g.write(w)
+	return true
+}
+func permitted(v []string, c string) bool {
+	var a, ok bool
+	for i := range v {
+		if v[i][0] == '!' {
+			if v[i][1:] == c {
+				return false
+			}
+			continue
+		}
+		if a = true; v[i] == c {
+			ok = true
+		}
+	}
+	return ok || !a
+}
@@ -0,0 +1,177 @@
+// geo_test.go
+// URL Shortener with MySQL database.
+//
+// Copyright (C) 2020 iDigitalFlame
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+//
+
+package linker
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+)
+
+// geoDatabase returns a MaxMind DB with a single IPv4 search tree node, which maps every address with the first
+// bit unset (0.0.0.0/1) to the country "DE" and has no data for the other addresses.
+func geoDatabase() []byte {
+	b := []byte{0, 0, 17, 0, 0, 1}
+	b = append(b, make([]byte, 16)...)
+	b = append(b, 0xE1, 0x47)
+	b = append(b, "country"...)
+	b = append(b, 0xE1, 0x48)
+	b = append(b, "iso_code"...)
+	b = append(b, 0x42, 'D', 'E')
+	b = append(b, "\xAB\xCD\xEFMaxMind.com"...)
+	b = append(b, 0xE4, 0x4A)
+	b = append(b, "node_count"...)
+	b = append(b, 0xC1, 1, 0x4B)
+	b = append(b, "record_size"...)
+	b = append(b, 0xA1, 24, 0x4A)
+	b = append(b, "ip_version"...)
+	b = append(b, 0xA1, 4, 0x5B)
+	b = append(b, "binary_format_major_version"...)
+	return append(b, 0xA1, 2)
+}
+
+func TestGeo(t *testing.T) {
+	var g geo
+	if err := g.load(geoConfig{Header: "CF-IPCountry", Allow: []string{"us"}, Deny: []string{"ca"}}); err != nil {
+		t.Fatalf("unable to load geo rules: %s", err)
+	}
+	p, err := trust([]string{"10.0.0.0/8"})
+	if err != nil {
+		t.Fatalf("unable to parse proxies: %s", err)
+	}
+	v := [...]struct {
+		name, remote, country string
+		blocked               bool
+	}{
+		{"allowed from proxy", "10.0.0.1:1234", "US", false},
+		{"denied from proxy", "10.0.0.1:1234", "CA", true},
+		{"not allowed from proxy", "10.0.0.1:1234", "DE", true},
+		{"missing header from proxy", "10.0.0.1:1234", "", true},
+		{"spoofed header", "192.0.2.1:1234", "US", true},
+	}
+	for _, c := range v {
+		r := httptest.NewRequest(http.MethodGet, "/foo", nil)
+		if r.RemoteAddr = c.remote; len(c.country) > 0 {
+			r.Header.Set("CF-IPCountry", c.country)
+		}
+		w := httptest.NewRecorder()
+		if b := g.blocked(w, g.country(r, p, address(r))); b != c.blocked {
+			t.Errorf("%s: blocked is %t, expected %t", c.name, b, c.blocked)
+		}
+		if c.blocked && w.Code != http.StatusUnavailableForLegalReasons {
+			t.Errorf("%s: status is %d, expected %d", c.name, w.Code, http.StatusUnavailableForLegalReasons)
+		}
+	}
+}
+func TestGeoDatabase(t *testing.T) {
+	f := filepath.Join(t.TempDir(), "country.mmdb")
+	if err := ioutil.WriteFile(f, geoDatabase(), 0600); err != nil {
+		t.Fatalf("unable to write database: %s", err)
+	}
+	var g geo
+	if err := g.load(geoConfig{Header: "CF-IPCountry", Database: f, Deny: []string{"de"}}); err != nil {
+		t.Fatalf("unable to load geo rules: %s", err)
+	}
+	p, err := trust([]string{"10.0.0.0/8"})
+	if err != nil {
+		t.Fatalf("unable to parse proxies: %s", err)
+	}
+	v := [...]struct {
+		name, remote, header, country string
+	}{
+		{"database", "192.0.2.1:1234", "", ""},
+		{"database match", "2.0.0.1:1234", "", "DE"},
+		{"spoofed header", "192.0.2.1:1234", "DE", ""},
+		{"untrusted header with database match", "2.0.0.1:1234", "US", "DE"},
+		{"proxy header", "10.0.0.1:1234", "us", "US"},
+		{"proxy without header", "10.0.0.1:1234", "", "DE"},
+		{"IPv6 address", "[2001:db8::1]:1234", "", ""},
+	}
+	for _, c := range v {
+		r := httptest.NewRequest(http.MethodGet, "/foo", nil)
+		if r.RemoteAddr = c.remote; len(c.header) > 0 {
+			r.Header.Set("CF-IPCountry", c.header)
+		}
+		if n := g.country(r, p, address(r)); n != c.country {
+			t.Errorf("%s: country is %q, expected %q", c.name, n, c.country)
+		}
+	}
+	if err := g.load(geoConfig{Database: filepath.Join(filepath.Dir(f), "missing.mmdb")}); err == nil {
+		t.Error("loading a missing database did not return an error")
+	}
+}
+func TestPermitted(t *testing.T) {
+	v := [...]struct {
+		rules   []string
+		country string
+		ok      bool
+	}{
+		{[]string{"US"}, "US", true},
+		{[]string{"US"}, "CA", false},
+		{[]string{"US"}, "", false},
+		{[]string{"!RU"}, "RU", false},
+		{[]string{"!RU"}, "US", true},
+		{[]string{"!RU"}, "", true},
+		{[]string{"US", "!US"}, "US", false},
+		{[]string{"US", "CA", "!RU"}, "CA", true},
+	}
+	for _, c := range v {
+		if ok := permitted(c.rules, c.country); ok != c.ok {
+			t.Errorf("permitted(%v, %q) is %t, expected %t", c.rules, c.country, ok, c.ok)
+		}
+	}
+}
+func TestCountries(t *testing.T) {
+	d := &memory{links: map[string]record{
+		"us":   {url: "https://example.com/us", geo: []string{"US"}},
+		"open": {url: "https://example.com/open", geo: []string{"!RU"}},
+	}}
+	l := newTest(t, d, `{"proxies": ["10.0.0.0/8"], "geo": {"header": "CF-IPCountry", "status": 403}}`)
+	v := [...]struct {
+		path, country string
+		status        int
+	}{
+		{"/us", "US", http.StatusTemporaryRedirect},
+		{"/us", "CA", http.StatusForbidden},
+		{"/us", "", http.StatusForbidden},
+		{"/open", "CA", http.StatusTemporaryRedirect},
+		{"/open", "RU", http.StatusForbidden},
+	}
+	h := l.Handler()
+	for _, c := range v {
+		r := httptest.NewRequest(http.MethodGet, c.path, nil)
+		r.RemoteAddr = "10.0.0.1:1234"
+		r.Header.Set("User-Agent", "Mozilla/5.0")
+		if len(c.country) > 0 {
+			r.Header.Set("CF-IPCountry", c.country)
+		}
+		w := httptest.NewRecorder()
+		if h.ServeHTTP(w, r); w.Code != c.status {
+			t.Errorf("%s from %q: status is %d, expected %d", c.path, c.country, w.Code, c.status)
+		}
+	}
+	for _, s := range [...]string{"USA", "U1", "!", "!!US"} {
+		if err := l.SetCountries("us", []string{s}); err == nil {
+			t.Errorf("invalid country code %q was accepted", s)
+		}
+	}
+}
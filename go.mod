@@ -1,5 +1,17 @@
 module github.com/iDigitalFlame/linker
 
-go 1.13
+go 1.18
 
-require github.com/go-sql-driver/mysql v1.5.0
+require (
+	github.com/DATA-DOG/go-sqlmock v1.5.0
+	github.com/go-sql-driver/mysql v1.5.0
+	github.com/oschwald/maxminddb-golang v1.8.0
+	go.etcd.io/bbolt v1.3.5
+	golang.org/x/net v0.0.0-20201021035429-f5854403a974
+	golang.org/x/sync v0.0.0-20201020160332-67f06af15bc9
+)
+
+require (
+	golang.org/x/sys v0.0.0-20200930185726-fdedc70b468f // indirect
+	golang.org/x/text v0.3.3 // indirect
+)
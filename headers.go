@@ -0,0 +1,99 @@
+// headers.go
+// URL Shortener with MySQL database.
+//
+// Copyright (C) 2020 iDigitalFlame
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+//
+
+package linker
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"golang.org/x/net/http/httpguts"
+)
+
+// reserved is a list of the response headers that are set by the handler (or the HTTP server) and cannot be
+// changed by the headers of a redirect.
+var reserved = [...]string{
+	"Connection", "Content-Encoding", "Content-Length", "Content-Type", "Date", "Keep-Alive", "Location", "Te",
+	"Trailer", "Transfer-Encoding", "Upgrade",
+}
+
+// SetHeaders will change the extra response headers sent with the redirect with the supplied name (such as
+// "X-Robots-Tag" or "Cache-Control"). Header names are not case sensitive and headers used by the redirect itself
+// (such as "Location") cannot be set. An empty map removes all extra headers. This function will return an error
+// if the change fails, a header is invalid or the name does not exist.
+func (l *Linker) SetHeaders(n string, h map[string]string) error {
+	if l.db == nil {
+		return errNotConfigured
+	}
+	if !validName(n) {
+		return &errval{s: `name "` + n + `" contains invalid characters`}
+	}
+	var v map[string]string
+	for k, s := range h {
+		c := http.CanonicalHeaderKey(strings.TrimSpace(k))
+		if !httpguts.ValidHeaderFieldName(c) {
+			return &errval{s: `header name "` + k + `" is not valid`}
+		}
+		for i := range reserved {
+			if c == reserved[i] {
+				return &errval{s: `header "` + c + `" cannot be changed`}
+			}
+		}
+		if s = strings.TrimSpace(s); !httpguts.ValidHeaderFieldValue(s) {
+			return &errval{s: `header "` + c + `" value contains invalid characters`}
+		}
+		if c == "Referrer-Policy" {
+			var err error
+			if s, err = policy(s); err != nil {
+				return err
+			}
+		}
+		if v == nil {
+			v = make(map[string]string, len(h))
+		}
+		v[c] = s
+	}
+	if err := l.db.setHeaders(n, v); err != nil {
+		return err
+	}
+	l.cache.remove(n)
+	return nil
+}
+func encodeHeaders(h map[string]string) sql.NullString {
+	if len(h) == 0 {
+		return sql.NullString{}
+	}
+	b, err := json.Marshal(h)
+	if err != nil {
+		return sql.NullString{}
+	}
+	return sql.NullString{String: string(b), Valid: true}
+}
+func decodeHeaders(s string) map[string]string {
+	if len(s) == 0 {
+		return nil
+	}
+	var v map[string]string
+	if json.Unmarshal([]byte(s), &v) != nil {
+		return nil
+	}
+	return v
+}
@@ -0,0 +1,93 @@
+// history.go
+// URL Shortener with MySQL database.
+//
+// Copyright (C) 2020 iDigitalFlame
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+//
+
+package linker
+
+import "time"
+
+// Version is a struct that represents a previous destination URL of a redirect name. Versions are created
+// each time a redirect is updated and can be used to Rollback the redirect to a prior URL.
+type Version struct {
+	Time time.Time `json:"time"`
+	URL  string    `json:"url"`
+	ID   uint64    `json:"id"`
+}
+
+// History will return the list of previous URLs for the supplied redirect name, ordered from newest to
+// oldest. This function returns an error if there an error reading from the database.
+func (l *Linker) History(n string) ([]Version, error) {
+	if l.db == nil {
+		return nil, errNotConfigured
+	}
+	if !validName(n) {
+		return nil, &errval{s: `name "` + n + `" contains invalid characters`}
+	}
+	return l.db.history(n)
+}
+
+// Update will attempt to change the URL of the redirect with the name of the first string to the URL provided
+// in the second string argument. The previous URL is kept in the redirect history and any Rollout of the redirect
+// is stopped. This function will return an error if the update fails or the name does not exist.
+func (l *Linker) Update(n, u string) error {
+	return l.update(n, u, nil)
+}
+func (l *Linker) update(n, u string, r *Rollout) error {
+	if l.db == nil {
+		return errNotConfigured
+	}
+	if !validName(n) {
+		return &errval{s: `name "` + n + `" contains invalid characters`}
+	}
+	p, err := l.target(n, u)
+	if err != nil {
+		return err
+	}
+	if err = l.max.check("", p); err != nil {
+		return err
+	}
+	if err = l.db.setRollout(n, r); err != nil {
+		return err
+	}
+	if err = l.db.update(n, p); err != nil {
+		return err
+	}
+	l.cache.remove(n)
+	return nil
+}
+
+// Rollback will attempt to change the URL of the redirect with the supplied name back to the URL that was
+// recorded with the supplied history ID. The current URL is kept in the redirect history, so a Rollback can
+// be reverted, and any Rollout of the redirect is stopped. This function will return an error if the rollback
+// fails or the history ID does not exist.
+func (l *Linker) Rollback(n string, v uint64) error {
+	if l.db == nil {
+		return errNotConfigured
+	}
+	if !validName(n) {
+		return &errval{s: `name "` + n + `" contains invalid characters`}
+	}
+	if err := l.db.rollback(n, v); err != nil {
+		return err
+	}
+	if err := l.db.setRollout(n, nil); err != nil {
+		return err
+	}
+	l.cache.remove(n)
+	return nil
+}
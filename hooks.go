@@ -0,0 +1,64 @@
+// hooks.go
+// URL Shortener with MySQL database.
+//
+// Copyright (C) 2020 iDigitalFlame
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+//
+
+package linker
+
+import "net/http"
+
+type hooks struct {
+	hit  []func(Link, *http.Request)
+	miss []func(string, *http.Request)
+	fail []func(error, *http.Request)
+}
+
+// OnHit will add a function that is called for each request that is redirected. The Link contains the redirect
+// name and the destination URL. Hook functions are called by the redirect handler, so they should not block.
+// This function must be called before the Handler or Listen functions to take effect.
+func (l *Linker) OnHit(f func(Link, *http.Request)) {
+	l.hooks.hit = append(l.hooks.hit, f)
+}
+
+// OnMiss will add a function that is called for each request for a redirect name that does not exist. Hook
+// functions are called by the redirect handler, so they should not block. This function must be called before the
+// Handler or Listen functions to take effect.
+func (l *Linker) OnMiss(f func(string, *http.Request)) {
+	l.hooks.miss = append(l.hooks.miss, f)
+}
+
+// OnError will add a function that is called for each request that fails due to an error, such as a database
+// error. Hook functions are called by the redirect handler, so they should not block. This function must be called
+// before the Handler or Listen functions to take effect.
+func (l *Linker) OnError(f func(error, *http.Request)) {
+	l.hooks.fail = append(l.hooks.fail, f)
+}
+func (h *hooks) onHit(v Link, r *http.Request) {
+	for i := range h.hit {
+		h.hit[i](v, r)
+	}
+}
+func (h *hooks) onMiss(n string, r *http.Request) {
+	for i := range h.miss {
+		h.miss[i](n, r)
+	}
+}
+func (h *hooks) onError(err error, r *http.Request) {
+	for i := range h.fail {
+		h.fail[i](err, r)
+	}
+}
@@ -0,0 +1,363 @@
+// import.go
+// URL Shortener with MySQL database.
+//
+// Copyright (C) 2020 iDigitalFlame
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+//
+
+package linker
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"strconv"
+	"strings"
+)
+
+// yourls is the default column order of the YOURLS "yourls_url" table, used when an INSERT statement does not
+// list the column names.
+var yourls = [...]string{"keyword", "url", "title", "timestamp", "ip", "clicks"}
+
+// importNames, importShort, importURLs and importHits are the (normalized) CSV header names used to find the
+// name, short URL, destination URL and hit count columns of exports from other URL shorteners (such as Shlink
+// and Bitly) and Linker itself.
+var (
+	importNames = [...]string{"short code", "shortcode", "keyword", "name", "slug"}
+	importShort = [...]string{"short url", "short link", "shorturl", "bitlink", "link"}
+	importURLs  = [...]string{"long url", "longurl", "original url", "long link", "destination", "url"}
+	importHits  = [...]string{"visits", "visits count", "visitscount", "clicks", "total clicks", "hits"}
+)
+
+// ReadImport will read a list of redirects exported from another URL shortener from the supplied Reader. YOURLS
+// SQL dumps, CSV exports with a header row (such as the Shlink and Bitly exports) and the Linker JSON and CSV
+// list output are supported and detected automatically. Hit counts are kept when the export contains them. This
+// function will return an error if the data is not in any of the supported formats.
+func ReadImport(r io.Reader) ([]Link, error) {
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, &errval{s: "unable to read import data", e: err}
+	}
+	switch b = bytes.TrimSpace(b); {
+	case len(b) == 0:
+		return nil, nil
+	case b[0] == '[':
+		var v []Link
+		if err = json.Unmarshal(b, &v); err != nil {
+			return nil, &errval{s: "unable to parse JSON import data", e: err}
+		}
+		return v, nil
+	case index(string(b), "insert into") >= 0:
+		return readSQL(string(b))
+	}
+	return readCSV(bytes.NewReader(b))
+}
+
+// Import will add the supplied redirects, such as the ones returned by ReadImport, and return the number of
+// redirects added. Redirects with a name that already exists are skipped. The hit counts of added redirects
+// are kept. This function will return an error if adding any redirect fails, which stops the import.
+func (l *Linker) Import(v []Link) (int, error) {
+	if l.db == nil {
+		return 0, errNotConfigured
+	}
+	var (
+		c int
+		h = make(map[string]uint64)
+	)
+	for i := range v {
+		if _, err := l.db.get(context.Background(), v[i].Name); err == nil {
+			continue
+		}
+		if err := l.Add(v[i].Name, v[i].URL); err != nil {
+			return c, &errval{s: `unable to import "` + v[i].Name + `"`, e: err}
+		}
+		if c++; v[i].Append != nil {
+			if err := l.SetAppend(v[i].Name, v[i].Append); err != nil {
+				return c, &errval{s: `unable to import "` + v[i].Name + `"`, e: err}
+			}
+		}
+		if v[i].Refresh != nil {
+			if err := l.SetRefresh(v[i].Name, v[i].Refresh); err != nil {
+				return c, &errval{s: `unable to import "` + v[i].Name + `"`, e: err}
+			}
+		}
+		if len(v[i].App) > 0 {
+			if err := l.SetApp(v[i].Name, v[i].App); err != nil {
+				return c, &errval{s: `unable to import "` + v[i].Name + `"`, e: err}
+			}
+		}
+		if len(v[i].Key) > 0 {
+			if err := l.SetKey(v[i].Name, v[i].Key); err != nil {
+				return c, &errval{s: `unable to import "` + v[i].Name + `"`, e: err}
+			}
+		}
+		if len(v[i].Referrers) > 0 {
+			if err := l.SetReferrers(v[i].Name, v[i].Referrers); err != nil {
+				return c, &errval{s: `unable to import "` + v[i].Name + `"`, e: err}
+			}
+		}
+		if len(v[i].Countries) > 0 {
+			if err := l.SetCountries(v[i].Name, v[i].Countries); err != nil {
+				return c, &errval{s: `unable to import "` + v[i].Name + `"`, e: err}
+			}
+		}
+		if len(v[i].Owner) > 0 {
+			if err := l.SetOwner(v[i].Name, v[i].Owner); err != nil {
+				return c, &errval{s: `unable to import "` + v[i].Name + `"`, e: err}
+			}
+		}
+		if len(v[i].Schedule) > 0 {
+			if err := l.SetSchedule(v[i].Name, v[i].Schedule); err != nil {
+				return c, &errval{s: `unable to import "` + v[i].Name + `"`, e: err}
+			}
+		}
+		if len(v[i].Headers) > 0 {
+			if err := l.SetHeaders(v[i].Name, v[i].Headers); err != nil {
+				return c, &errval{s: `unable to import "` + v[i].Name + `"`, e: err}
+			}
+		}
+		if v[i].Meta != nil {
+			if err := l.SetMeta(v[i].Name, v[i].Meta); err != nil {
+				return c, &errval{s: `unable to import "` + v[i].Name + `"`, e: err}
+			}
+		}
+		if v[i].Hits > 0 {
+			h[v[i].Name] = v[i].Hits
+		}
+	}
+	if len(h) > 0 {
+		if err := l.db.hits(context.Background(), h); err != nil {
+			return c, err
+		}
+	}
+	return c, nil
+}
+func index(s, p string) int {
+	for i := 0; i+len(p) <= len(s); i++ {
+		if strings.EqualFold(s[i:i+len(p)], p) {
+			return i
+		}
+	}
+	return -1
+}
+func space(s string) string {
+	return strings.TrimLeft(s, " \t\r\n")
+}
+func short(s string) string {
+	if i := strings.IndexAny(s, "?#"); i >= 0 {
+		s = s[:i]
+	}
+	if s = strings.TrimRight(s, "/"); len(s) == 0 {
+		return s
+	}
+	return s[strings.LastIndexByte(s, '/')+1:]
+}
+func column(h []string, n []string) int {
+	for i := range n {
+		for x := range h {
+			if h[x] == n[i] {
+				return x
+			}
+		}
+	}
+	return -1
+}
+func readSQL(s string) ([]Link, error) {
+	var v []Link
+	for {
+		i := index(s, "insert into")
+		if i < 0 {
+			break
+		}
+		s = space(s[i+11:])
+		var t string
+		if len(s) > 0 && s[0] == '`' {
+			if i = strings.IndexByte(s[1:], '`'); i < 0 {
+				return nil, &errval{s: "invalid SQL import data"}
+			}
+			t, s = s[1:i+1], s[i+2:]
+		} else {
+			if i = strings.IndexAny(s, " \t\r\n("); i < 0 {
+				return nil, &errval{s: "invalid SQL import data"}
+			}
+			t, s = s[:i], s[i:]
+		}
+		c := yourls[:]
+		if s = space(s); len(s) > 0 && s[0] == '(' {
+			if i = strings.IndexByte(s, ')'); i < 0 {
+				return nil, &errval{s: "invalid SQL import data"}
+			}
+			c = strings.Split(s[1:i], ",")
+			for x := range c {
+				c[x] = strings.ToLower(strings.Trim(strings.TrimSpace(c[x]), "`"))
+			}
+			s = space(s[i+1:])
+		}
+		if len(s) < 6 || !strings.EqualFold(s[:6], "values") {
+			continue
+		}
+		var (
+			r   [][]string
+			err error
+		)
+		if r, s, err = values(s[6:]); err != nil {
+			return nil, err
+		}
+		if !strings.HasSuffix(strings.ToLower(t), "url") {
+			continue
+		}
+		k, u, h := column(c, []string{"keyword"}), column(c, []string{"url"}), column(c, []string{"clicks"})
+		if k < 0 || u < 0 {
+			continue
+		}
+		for x := range r {
+			if k >= len(r[x]) || u >= len(r[x]) {
+				return nil, &errval{s: "invalid SQL import data"}
+			}
+			e := Link{Name: r[x][k], URL: r[x][u]}
+			if h >= 0 && h < len(r[x]) {
+				e.Hits, _ = strconv.ParseUint(r[x][h], 10, 64)
+			}
+			v = append(v, e)
+		}
+	}
+	return v, nil
+}
+func readCSV(r io.Reader) ([]Link, error) {
+	c := csv.NewReader(r)
+	c.FieldsPerRecord, c.LazyQuotes, c.TrimLeadingSpace = -1, true, true
+	h, err := c.Read()
+	if err != nil {
+		return nil, &errval{s: "unable to parse CSV import data", e: err}
+	}
+	for i := range h {
+		h[i] = strings.ToLower(strings.TrimSpace(strings.NewReplacer("_", " ", "-", " ").Replace(h[i])))
+	}
+	var (
+		n, s = column(h, importNames[:]), column(h, importShort[:])
+		u, k = column(h, importURLs[:]), column(h, importHits[:])
+	)
+	if u < 0 || (n < 0 && s < 0) {
+		return nil, &errval{s: "CSV import data does not contain a name and URL column"}
+	}
+	var v []Link
+	for {
+		r, err := c.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, &errval{s: "unable to parse CSV import data", e: err}
+		}
+		if u >= len(r) {
+			continue
+		}
+		var e Link
+		if n >= 0 && n < len(r) {
+			e.Name = r[n]
+		}
+		if len(e.Name) == 0 && s >= 0 && s < len(r) {
+			e.Name = short(r[s])
+		}
+		if e.URL = r[u]; len(e.Name) == 0 || len(e.URL) == 0 {
+			continue
+		}
+		if k >= 0 && k < len(r) {
+			e.Hits, _ = strconv.ParseUint(strings.TrimSpace(r[k]), 10, 64)
+		}
+		v = append(v, e)
+	}
+	return v, nil
+}
+func values(s string) ([][]string, string, error) {
+	var r [][]string
+	for {
+		if s = space(s); len(s) == 0 || s[0] != '(' {
+			return nil, s, &errval{s: "invalid SQL import data"}
+		}
+		var e []string
+		for s = s[1:]; ; {
+			var (
+				v   string
+				err error
+			)
+			if v, s, err = value(space(s)); err != nil {
+				return nil, s, err
+			}
+			if e, s = append(e, v), space(s); len(s) == 0 {
+				return nil, s, &errval{s: "invalid SQL import data"}
+			}
+			if s[0] == ')' {
+				s = s[1:]
+				break
+			}
+			if s[0] != ',' {
+				return nil, s, &errval{s: "invalid SQL import data"}
+			}
+			s = s[1:]
+		}
+		if r, s = append(r, e), space(s); len(s) == 0 || s[0] != ',' {
+			return r, s, nil
+		}
+		s = s[1:]
+	}
+}
+func value(s string) (string, string, error) {
+	if len(s) == 0 {
+		return "", s, &errval{s: "invalid SQL import data"}
+	}
+	if s[0] != '\'' && s[0] != '"' {
+		i := strings.IndexAny(s, ",)")
+		if i < 0 {
+			return "", s, &errval{s: "invalid SQL import data"}
+		}
+		if v := strings.TrimSpace(s[:i]); !strings.EqualFold(v, "null") {
+			return v, s[i:], nil
+		}
+		return "", s[i:], nil
+	}
+	var (
+		b strings.Builder
+		q = s[0]
+	)
+	for i := 1; i < len(s); i++ {
+		switch {
+		case s[i] == '\\' && i+1 < len(s):
+			switch i++; s[i] {
+			case 'n':
+				b.WriteByte('\n')
+			case 'r':
+				b.WriteByte('\r')
+			case 't':
+				b.WriteByte('\t')
+			case '0':
+				b.WriteByte(0)
+			default:
+				b.WriteByte(s[i])
+			}
+		case s[i] == q && i+1 < len(s) && s[i+1] == q:
+			b.WriteByte(q)
+			i++
+		case s[i] == q:
+			return b.String(), s[i+1:], nil
+		default:
+			b.WriteByte(s[i])
+		}
+	}
+	return "", s, &errval{s: "invalid SQL import data"}
+}
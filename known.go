@@ -0,0 +1,114 @@
+// known.go
+// URL Shortener with MySQL database.
+//
+// Copyright (C) 2020 iDigitalFlame
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+//
+
+package linker
+
+import (
+	"bytes"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const knownPrefix = "/.well-known/"
+
+type known struct {
+	docs map[string]document
+	dir  string
+}
+type document struct {
+	mod  time.Time
+	kind string
+	data []byte
+}
+type knownConfig struct {
+	Dir       string                    `json:"dir"`
+	Documents map[string]documentConfig `json:"documents"`
+}
+type documentConfig struct {
+	Type    string `json:"type"`
+	File    string `json:"file"`
+	Content string `json:"content"`
+}
+
+func (k *known) load(c knownConfig) error {
+	if k.dir = c.Dir; len(c.Documents) == 0 {
+		return nil
+	}
+	k.docs = make(map[string]document, len(c.Documents))
+	for n, v := range c.Documents {
+		d := document{kind: v.Type, data: []byte(v.Content), mod: time.Now()}
+		if len(v.File) > 0 {
+			b, err := ioutil.ReadFile(v.File)
+			if err != nil {
+				return &errval{s: `unable to read well known document "` + v.File + `"`, e: err}
+			}
+			d.data = b
+			if i, err := os.Stat(v.File); err == nil {
+				d.mod = i.ModTime()
+			}
+		}
+		if len(d.kind) == 0 {
+			switch n = strings.Trim(n, "/"); {
+			case n == "apple-app-site-association":
+				d.kind = "application/json"
+			case strings.HasSuffix(n, ".txt"):
+				d.kind = "text/plain; charset=utf-8"
+			default:
+				if d.kind = mime.TypeByExtension(path.Ext(n)); len(d.kind) == 0 {
+					d.kind = "text/plain; charset=utf-8"
+				}
+			}
+		}
+		k.docs["/"+strings.Trim(n, "/")] = d
+	}
+	return nil
+}
+func (k *known) serve(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.NotFound(w, r)
+		return
+	}
+	n := path.Clean("/" + strings.TrimPrefix(r.URL.Path, knownPrefix))
+	if d, ok := k.docs[n]; ok {
+		w.Header().Set("Content-Type", d.kind)
+		http.ServeContent(w, r, n, d.mod, bytes.NewReader(d.data))
+		return
+	}
+	if len(k.dir) == 0 || n == "/" {
+		http.NotFound(w, r)
+		return
+	}
+	f, err := os.Open(filepath.Join(k.dir, filepath.FromSlash(n)))
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	if i, err := f.Stat(); err == nil && !i.IsDir() {
+		http.ServeContent(w, r, i.Name(), i.ModTime(), f)
+	} else {
+		http.NotFound(w, r)
+	}
+	f.Close()
+}
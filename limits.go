@@ -0,0 +1,71 @@
+// limits.go
+// URL Shortener with MySQL database.
+//
+// Copyright (C) 2020 iDigitalFlame
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+//
+
+package linker
+
+import "strconv"
+
+const (
+	defaultNameLimit = 64
+	defaultURLLimit  = 1024
+)
+
+// LengthError is an error returned when a name or URL is longer than the length limit in the "limits" config.
+// Length and Limit are counted in bytes.
+type LengthError struct {
+	Field  string
+	Length int
+	Limit  int
+}
+type limits struct {
+	name, url int
+}
+type limitsConfig struct {
+	Name uint32 `json:"name"`
+	URL  uint32 `json:"url"`
+}
+
+func (e *LengthError) Error() string {
+	return e.Field + " is " + strconv.Itoa(e.Length) + " bytes, which is longer than the limit of " + strconv.Itoa(e.Limit)
+}
+func (v *limits) load(c limitsConfig) error {
+	if v.name, v.url = int(c.Name), int(c.URL); v.name == 0 {
+		v.name = defaultNameLimit
+	}
+	if v.url == 0 {
+		v.url = defaultURLLimit
+	}
+	// MySQL indexes names with up to 4 bytes per character and stores URLs in at most a TEXT column.
+	if v.name > 255 {
+		return &errval{s: "name length limit cannot be larger than 255"}
+	}
+	if v.url > 32768 {
+		return &errval{s: "URL length limit cannot be larger than 32768"}
+	}
+	return nil
+}
+func (v limits) check(n, u string) error {
+	if len(n) > v.name {
+		return &LengthError{Field: "name", Length: len(n), Limit: v.name}
+	}
+	if len(u) > v.url {
+		return &LengthError{Field: "URL", Length: len(u), Limit: v.url}
+	}
+	return nil
+}
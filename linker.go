@@ -20,25 +20,27 @@
 package linker
 
 import (
+	"bytes"
 	"context"
 	"crypto/tls"
 	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"html"
-	"io/ioutil"
 	"net"
 	"net/http"
 	"net/url"
 	"os"
 	"os/signal"
 	"regexp"
+	"runtime/debug"
+	"strconv"
 	"strings"
+	"sync"
 	"syscall"
 	"time"
 
-	// Import for the Golang MySQL driver
-	_ "github.com/go-sql-driver/mysql"
+	"golang.org/x/sync/singleflight"
 )
 
 // Defaults is a string representation of the default configuration for Linker. This can be used in a JSON file
@@ -46,45 +48,246 @@ import (
 const Defaults = `{
     "key": "",
     "cert": "",
+    "tls": {
+        "min_version": "1.2",
+        "ciphers": [],
+        "curves": [],
+        "fips": false
+    },
     "listen": "0.0.0.0:80",
-    "timeout": 5,
+    "timeout": {
+        "read": "5s",
+        "idle": "5s",
+        "write": "5s",
+        "header": "5s",
+        "lookup": "2s",
+        "handler": "0s",
+        "drain": "0s",
+        "shutdown": "5s"
+    },
+    "max_body": 4096,
+    "max_header": 16384,
     "default": "https://duckduckgo.com",
+    "fallback": {
+        "check": "0s",
+        "hosts": {}
+    },
+    "static": {},
+    "strict": false,
+    "append": true,
+    "slashes": "lenient",
+    "refresh": {
+        "enabled": false,
+        "delay": 0,
+        "notice": ""
+    },
+    "referrer_policy": "",
+    "allow_hosts": [],
+    "proxies": [],
+    "features": {
+        "stats": true,
+        "api": true,
+        "claim": true,
+        "search": true,
+        "popular": true,
+        "feed": true,
+        "previews": true,
+        "apps": true
+    },
+    "cache": {
+        "ttl": "0s",
+        "warm": 0,
+        "limit": 16384,
+        "missing": "0s",
+        "budget": "0s"
+    },
+    "normalize": {
+        "enabled": true,
+        "tracking": false,
+        "params": []
+    },
+    "stats": {
+        "enabled": true,
+        "interval": "30s",
+        "bots": false,
+        "uniques": false,
+        "dnt": false,
+        "retention": "0s"
+    },
+    "alerts": {
+        "threshold": 0,
+        "factor": 0,
+        "webhook": "",
+        "disable": false
+    },
+    "error_reporting": {
+        "dsn": "",
+        "rollbar": "",
+        "environment": "",
+        "sample": 0
+    },
+    "api": {
+        "path": "/api/v1",
+        "token": ""
+    },
+    "well_known": {
+        "dir": "",
+        "documents": {}
+    },
+    "signing": {
+        "key": "",
+        "param": "sig",
+        "required": false
+    },
+    "geo": {
+        "header": "",
+        "database": "",
+        "allow": [],
+        "deny": [],
+        "status": 451,
+        "page": ""
+    },
+    "claim": {
+        "path": "",
+        "header": "X-Forwarded-User",
+        "secret": "",
+        "reserved": [],
+        "quota": 0
+    },
+    "recycle": {
+        "cooldown": "0s",
+        "owner": false
+    },
+    "search": {
+        "path": "",
+        "header": "",
+        "limit": 25
+    },
+    "popular": {
+        "path": "",
+        "header": "",
+        "limit": 25
+    },
+    "feed": {
+        "path": "",
+        "base": "",
+        "title": "Linker",
+        "limit": 25
+    },
+    "crawlers": {
+        "action": "redirect",
+        "agents": []
+    },
+    "bots": {
+        "block": "0s",
+        "filter": false,
+        "traps": [],
+        "agents": []
+    },
+    "breaker": {
+        "cooldown": "30s",
+        "threshold": 5,
+        "redirect": false
+    },
+    "limits": {
+        "name": 64,
+        "url": 1024
+    },
+    "encryption": {
+        "key": "",
+        "previous": []
+    },
     "db": {
+        "driver": "mysql",
+        "file": "",
         "name": "linker",
         "server": "tcp(localhost:3306)",
         "username": "linker_user",
-        "password": "password"
+        "password": "password",
+        "dsn": "",
+        "params": {},
+        "ca": "",
+        "cert": "",
+        "key": "",
+        "retry": {
+            "attempts": 3,
+            "backoff": "25ms",
+            "max_backoff": "1s"
+        },
+        "slow_query": "250ms"
     }
 }
 `
 
 const (
-	sqlGet     = `SELECT LinkURL FROM Links WHERE LinkName = ?`
-	sqlAdd     = `INSERT INTO Links(LinkName, LinkURL) VALUES(?, ?)`
-	sqlList    = `SELECT LinkName, LinkURL FROM Links`
-	sqlDelete  = `DELETE FROM Links WHERE LinkName = ?`
-	sqlPrepare = `CREATE TABLE IF NOT EXISTS Links (LinkID BIGINT(64) NOT NULL PRIMARY KEY AUTO_INCREMENT,
-		LinkName VARCHAR(64) NOT NULL UNIQUE, LinkURL VARCHAR(1024) NOT NULL)`
-
 	defaultURL     = `https://duckduckgo.com`
 	defaultFile    = `/etc/linker.conf`
 	defaultTimeout = 5 * time.Second
+	defaultLookup  = 30 * time.Second
+	maxTimeout     = time.Hour
+	defaultBody    = 4096
+	defaultHeader  = 16384
 )
 
 var (
-	regCheckURL      = regexp.MustCompile(`(^\/[a-zA-Z0-9]+)`)
+	regCheckURL      = regexp.MustCompile(`^/[a-zA-Z0-9_-]+`)
 	errNotConfigured = &errval{s: "database is not loaded or configured"}
+	timeoutNames     = [...]string{"read", "idle", "write", "header", "shutdown", "lookup", "handler", "drain"}
 )
 
 // Linker is a struct that contains the web service and SQL queries that support the Linker URL shortener.
 type Linker struct {
-	db     *sql.DB
-	ctx    context.Context
-	get    *sql.Stmt
-	url    string
-	key    string
-	cert   string
-	cancel context.CancelFunc
+	db        store
+	ctx       context.Context
+	body      int64
+	wait      time.Duration
+	lookup    time.Duration
+	delay     time.Duration
+	grace     time.Duration
+	quit      chan struct{}
+	key       string
+	cert      string
+	file      string
+	rev       string
+	conf      config
+	lock      sync.RWMutex
+	policy    *tls.Config
+	max       limits
+	cancel    context.CancelFunc
+	brk       breaker
+	norm      normalizer
+	def       fallback
+	bots      bots
+	known     known
+	crawl     crawlers
+	sign      signer
+	geo       geo
+	claim     claim
+	recycle   recycler
+	find      search
+	rank      popular
+	news      feed
+	stats     stats
+	alerts    alerts
+	report    reporter
+	api       api
+	refresh   refresher
+	referrer  string
+	cache     cache
+	group     singleflight.Group
+	fail      bool
+	strict    bool
+	slash     bool
+	previews  bool
+	apps      bool
+	append    bool
+	hosts     map[string]struct{}
+	static    map[string]string
+	proxy     proxies
+	chain     []func(http.Handler) http.Handler
+	calls     []func(http.Handler) http.Handler
+	resolvers []Resolver
+	hooks     hooks
 	http.Server
 }
 type errval struct {
@@ -92,50 +295,119 @@ type errval struct {
 	s string
 }
 type config struct {
-	Database database `json:"db"`
-	Key      string   `json:"key"`
-	Cert     string   `json:"cert"`
-	Listen   string   `json:"listen"`
-	Default  string   `json:"default"`
-	Timeout  uint8    `json:"timeout"`
+	Database database          `json:"db"`
+	Crypt    encryptionConfig  `json:"encryption"`
+	Limits   limitsConfig      `json:"limits"`
+	Cache    cacheConfig       `json:"cache"`
+	Breaker  breakerConfig     `json:"breaker"`
+	Bots     botsConfig        `json:"bots"`
+	Known    knownConfig       `json:"well_known"`
+	Crawlers crawlersConfig    `json:"crawlers"`
+	Signing  signConfig        `json:"signing"`
+	Alerts   alertsConfig      `json:"alerts"`
+	Report   reportConfig      `json:"error_reporting"`
+	API      apiConfig         `json:"api"`
+	Geo      geoConfig         `json:"geo"`
+	Claim    claimConfig       `json:"claim"`
+	Recycle  recycleConfig     `json:"recycle"`
+	Search   searchConfig      `json:"search"`
+	Popular  popularConfig     `json:"popular"`
+	Feed     feedConfig        `json:"feed"`
+	Stats    statsConfig       `json:"stats"`
+	Normal   normalizeConfig   `json:"normalize"`
+	Fallback fallbackConfig    `json:"fallback"`
+	Refresh  refreshConfig     `json:"refresh"`
+	Referrer string            `json:"referrer_policy"`
+	Key      string            `json:"key"`
+	Cert     string            `json:"cert"`
+	TLS      tlsConfig         `json:"tls"`
+	Listen   string            `json:"listen"`
+	Default  urls              `json:"default"`
+	Static   map[string]string `json:"static"`
+	Strict   bool              `json:"strict"`
+	Append   *bool             `json:"append"`
+	Slashes  string            `json:"slashes"`
+	Hosts    []string          `json:"allow_hosts"`
+	Proxies  []string          `json:"proxies"`
+	Features features          `json:"features"`
+	Timeout  timeouts          `json:"timeout"`
+	Body     uint32            `json:"max_body"`
+	Header   uint32            `json:"max_header"`
+}
+type duration time.Duration
+type timeouts struct {
+	Read     duration `json:"read"`
+	Idle     duration `json:"idle"`
+	Write    duration `json:"write"`
+	Header   duration `json:"header"`
+	Lookup   duration `json:"lookup"`
+	Handler  duration `json:"handler"`
+	Drain    duration `json:"drain"`
+	Shutdown duration `json:"shutdown"`
+	set      uint8
 }
+
+// database is the "db" config section. For MySQL, the "server" value is the driver address, either a TCP address
+// (such as "tcp(localhost:3306)") or a local Unix socket (such as "unix(/var/run/mysqld/mysqld.sock)" or just the
+// absolute socket path). A socket connection uses the local server authentication and cannot use the TLS options.
 type database struct {
-	Name     string `json:"name"`
-	Server   string `json:"server"`
-	Username string `json:"username"`
-	Password string `json:"password"`
+	Params   map[string]string `json:"params"`
+	Driver   string            `json:"driver"`
+	File     string            `json:"file"`
+	Name     string            `json:"name"`
+	Server   string            `json:"server"`
+	Username string            `json:"username"`
+	Password string            `json:"password"`
+	DSN      string            `json:"dsn"`
+	CA       string            `json:"ca"`
+	Cert     string            `json:"cert"`
+	Key      string            `json:"key"`
+	Retry    retryConfig       `json:"retry"`
+	Slow     duration          `json:"slow_query"`
+}
+
+// Link is a struct that represents a single redirect name and the URL it redirects to.
+type Link struct {
+	Meta      *Meta             `json:"meta,omitempty"`
+	Created   *time.Time        `json:"created,omitempty"`
+	Referrers []string          `json:"referrers,omitempty"`
+	Countries []string          `json:"countries,omitempty"`
+	Schedule  []Schedule        `json:"schedule,omitempty"`
+	Headers   map[string]string `json:"headers,omitempty"`
+	Append    *bool             `json:"append,omitempty"`
+	Refresh   *bool             `json:"refresh,omitempty"`
+	Rollout   *Rollout          `json:"rollout,omitempty"`
+	Owner     string            `json:"owner,omitempty"`
+	App       string            `json:"app,omitempty"`
+	Key       string            `json:"key,omitempty"`
+	Name      string            `json:"name"`
+	URL       string            `json:"url"`
+	Hits      uint64            `json:"hits"`
 }
 
 // List will gather and print all the current link dataset. This function returns an error
 // if there an error reading from the database.
 func (l *Linker) List() error {
-	if l.db == nil {
-		return errNotConfigured
-	}
-	q, err := l.db.Prepare(sqlList)
+	v, err := l.Links()
 	if err != nil {
-		return &errval{s: "unable to prepare query statement", e: err}
-	}
-	r, err := q.Query()
-	if err != nil {
-		q.Close()
-		return &errval{s: "unable to execute query statement", e: err}
-	}
-	var n, u string
-	for os.Stdout.WriteString(expand("Name", 15) + "URL\n==============================================\n"); r.Next(); {
-		if err = r.Scan(&n, &u); err != nil {
-			break
-		}
-		os.Stdout.WriteString(expand(n, 15) + u + "\n")
+		return err
 	}
-	r.Close()
-	if q.Close(); err != nil {
-		return &errval{s: "unable to parse query statement results", e: err}
+	return Table.WriteLinks(os.Stdout, v)
+}
+
+// Links will gather and return all the current link dataset. This function returns an error
+// if there an error reading from the database.
+func (l *Linker) Links() ([]Link, error) {
+	if l.db == nil {
+		return nil, errNotConfigured
 	}
-	return nil
+	return l.db.list()
 }
 func validName(s string) bool {
-	for i := range s {
+	if len(s) == 0 {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
 		switch {
 		case s[i] == 45:
 		case s[i] == 95:
@@ -156,30 +428,115 @@ func (l *Linker) Close() error {
 	if l.db == nil {
 		return nil
 	}
-	if err := l.db.Close(); err != nil {
-		return &errval{s: "unable to close database", e: err}
+	var err error
+	if l.ctx != nil {
+		g := l.grace
+		if g <= 0 {
+			g = defaultTimeout
+		}
+		x, f := context.WithTimeout(context.Background(), g)
+		if err = l.Server.Shutdown(x); err != nil {
+			err = &errval{s: "unable to shutdown server", e: err}
+		}
+		f()
+		l.Server.Close()
+		l.cancel()
+		l.ctx, l.quit = nil, nil
+	}
+	c, d := context.WithTimeout(context.Background(), defaultTimeout)
+	if err := l.flush(c); err != nil {
+		l.report.error("Unable to save link hit counts", err)
+	}
+	d()
+	if x := l.db.close(); x != nil && err == nil {
+		err = &errval{s: "unable to close database", e: x}
 	}
-	if l.db = nil; l.get == nil {
+	l.db = nil
+	return err
+}
+func (d duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+func (d *duration) UnmarshalJSON(b []byte) error {
+	if len(b) > 0 && b[0] != '"' {
+		n, err := strconv.ParseUint(string(b), 10, 32)
+		if err != nil {
+			return &errval{s: `invalid duration value "` + string(b) + `"`, e: err}
+		}
+		*d = duration(time.Duration(n) * time.Second)
 		return nil
 	}
-	if err := l.get.Close(); err != nil {
-		return &errval{s: "unable to close get statement", e: err}
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return err
+	}
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return &errval{s: `invalid duration value "` + s + `"`, e: err}
 	}
-	l.get = nil
-	select {
-	case <-l.ctx.Done():
-	default:
+	if v < 0 {
+		return &errval{s: `duration value "` + s + `" must not be negative`}
 	}
-	l.cancel()
-	var (
-		x, f = context.WithTimeout(context.Background(), defaultTimeout)
-		err  = l.Server.Shutdown(x)
-	)
-	if f(); err != nil {
-		return &errval{s: "unable to shutdown server", e: err}
+	*d = duration(v)
+	return nil
+}
+func (t *timeouts) UnmarshalJSON(b []byte) error {
+	if len(b) > 0 && b[0] != '{' {
+		var d duration
+		if err := d.UnmarshalJSON(b); err != nil {
+			return err
+		}
+		t.Read, t.Idle, t.Write, t.Header, t.set = d, d, d, d, 0xF
+		return nil
+	}
+	var m map[string]json.RawMessage
+	if err := json.Unmarshal(b, &m); err != nil {
+		return err
 	}
-	l.ctx = nil
-	return l.Server.Close()
+	t.set = 0
+	for k := range m {
+		for i := range timeoutNames {
+			if strings.EqualFold(k, timeoutNames[i]) {
+				t.set |= 1 << i
+			}
+		}
+	}
+	type x timeouts
+	d := json.NewDecoder(bytes.NewReader(b))
+	d.DisallowUnknownFields()
+	return d.Decode((*x)(t))
+}
+
+// check validates the timeouts and fills in the defaults. Timeouts that were not set in the configuration are
+// changed to fit the ones that were, so only the values set by the user can fail the checks between timeouts.
+func (t *timeouts) check() error {
+	v := [...]*duration{&t.Read, &t.Idle, &t.Write, &t.Header, &t.Shutdown, &t.Lookup, &t.Handler, &t.Drain}
+	for i := range v {
+		if time.Duration(*v[i]) > maxTimeout {
+			return &errval{s: `timeout "` + timeoutNames[i] + `" must not be longer than ` + maxTimeout.String()}
+		}
+		if *v[i] == 0 && i < 5 {
+			*v[i], t.set = duration(defaultTimeout), t.set&^(1<<i)
+		}
+	}
+	if t.set&(1<<3) == 0 && t.Header > t.Read {
+		t.Header = t.Read
+	}
+	if t.set&(1<<2) == 0 && t.Handler > 0 && t.Handler >= t.Write {
+		t.Write = t.Handler + duration(defaultTimeout)
+	}
+	if t.set&(1<<5) == 0 && t.Handler > 0 && t.Lookup > t.Handler {
+		t.Lookup = t.Handler
+	}
+	switch {
+	case t.Header > t.Read:
+		return &errval{s: `timeout "header" must not be longer than the "read" timeout`}
+	case t.Handler > 0 && t.Handler >= t.Write:
+		return &errval{s: `timeout "handler" must be shorter than the "write" timeout`}
+	case t.Handler > 0 && t.Lookup > t.Handler:
+		return &errval{s: `timeout "lookup" must not be longer than the "handler" timeout`}
+	}
+	return nil
 }
 func (e errval) Error() string {
 	if e.e == nil {
@@ -187,34 +544,87 @@ func (e errval) Error() string {
 	}
 	return e.s + ": " + e.e.Error()
 }
+func (e errval) Unwrap() error {
+	return e.e
+}
 
 // Listen will start the listing session for Linker to redirect HTTP requests. This function will block until the
-// Close function is called or a SIGINT is received. This function will return an error if there is an issue
-// during the listener creation.
+// Close function is called or a SIGINT is received. A SIGHUP will reload the configuration file (see Reload). This
+// function will return an error if there is an issue during the listener creation.
 func (l *Linker) Listen() error {
-	if l.get != nil {
+	if l.db == nil {
+		return errNotConfigured
+	}
+	if l.ctx != nil {
 		return nil
 	}
-	var err error
-	l.ctx, l.cancel = context.WithCancel(context.Background())
-	if l.get, err = l.db.PrepareContext(l.ctx, sqlGet); err != nil {
-		return &errval{s: "unable to prepare get statement", e: err}
+	if v, err := l.db.verify(false); err != nil {
+		l.report.error("Unable to check the database", err)
+	} else {
+		for i := range v {
+			os.Stderr.WriteString("Database problem: " + v[i] + "!\n")
+		}
 	}
+	a, err := resolve(l.Server.Addr)
+	if err != nil {
+		return err
+	}
+	l.Server.Addr, l.quit = a, make(chan struct{}, 1)
+	os.Stderr.WriteString("Linker " + Info().String() + " listening on " + l.Server.Addr + "!\n")
+	l.start()
 	s := make(chan os.Signal, 1)
-	signal.Notify(s, syscall.SIGINT, syscall.SIGTERM, syscall.SIGQUIT)
+	signal.Notify(s, syscall.SIGINT, syscall.SIGTERM, syscall.SIGQUIT, syscall.SIGHUP)
 	go l.listen(&err)
-	select {
-	case <-s:
-	case <-l.ctx.Done():
+	for w := true; w; {
+		select {
+		case v := <-s:
+			if w = v == syscall.SIGHUP; w {
+				l.reloaded()
+			}
+		case <-l.quit:
+			w = false
+		case <-l.ctx.Done():
+			w = false
+		}
+	}
+	if l.ctx.Err() == nil {
+		l.drain(s)
 	}
 	signal.Stop(s)
 	close(s)
-	if l.cancel(); err != nil {
+	if err != nil && err != http.ErrServerClosed {
 		l.Close()
 		return err
 	}
 	return l.Close()
 }
+func (l *Linker) drain(s <-chan os.Signal) {
+	if l.delay <= 0 {
+		return
+	}
+	os.Stderr.WriteString("Linker is stopping in " + l.delay.String() + ", draining connections!\n")
+	l.Server.SetKeepAlivesEnabled(false)
+	t := time.NewTimer(l.delay)
+	select {
+	case <-t.C:
+	case <-s:
+	case <-l.ctx.Done():
+	}
+	t.Stop()
+}
+
+// Quit will stop the HTTP service started by the Listen function the same way as a SIGTERM signal, waiting for the
+// "drain" timeout before no longer accepting connections and then waiting for in-flight requests to finish. This
+// function does nothing if the HTTP service is not running.
+func (l *Linker) Quit() {
+	if l.quit == nil {
+		return
+	}
+	select {
+	case l.quit <- struct{}{}:
+	default:
+	}
+}
 func expand(s string, l int) string {
 	if len(s) >= l {
 		return s
@@ -226,29 +636,76 @@ func expand(s string, l int) string {
 	}
 	return string(b)
 }
+func (l *Linker) start() {
+	if l.ctx != nil {
+		return
+	}
+	l.ctx, l.cancel = context.WithCancel(context.Background())
+	if err := l.warm(l.ctx); err != nil {
+		l.report.error("Unable to warm the cache", err)
+	}
+	// The hit counts are replaced by each flush (including the one in Close), so they are only checked here.
+	if l.stats.hits != nil {
+		go l.count(l.ctx)
+	}
+	go l.def.watch(l.ctx)
+	if s, err := locate(l.file); err == nil && s.kind != sourceFile {
+		go s.watch(l.ctx, &l.report, l.rev, l.reloaded)
+	}
+}
 func (l *Linker) listen(err *error) {
-	l.Server.Handler.(*http.ServeMux).HandleFunc("/", l.serve)
+	l.Server.Handler.(*http.ServeMux).Handle("/", l.Handler())
 	if len(l.cert) == 0 || len(l.key) == 0 {
-		*err = l.Server.ListenAndServe()
-		l.cancel()
+		if *err = l.Server.ListenAndServe(); *err != http.ErrServerClosed {
+			l.cancel()
+		}
 		return
 	}
-	l.Server.TLSConfig = &tls.Config{
-		NextProtos: []string{"h2", "http/1.1"},
-		MinVersion: tls.VersionTLS12,
-		CipherSuites: []uint16{
-			tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384,
-			tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384,
-			tls.TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305,
-			tls.TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305,
-			tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256,
-			tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256,
-		},
-		CurvePreferences:         []tls.CurveID{tls.CurveP256, tls.X25519},
-		PreferServerCipherSuites: true,
-	}
-	*err = l.Server.ListenAndServeTLS(l.cert, l.key)
-	l.cancel()
+	l.Server.TLSConfig = l.policy
+	if *err = l.Server.ListenAndServeTLS(l.cert, l.key); *err != http.ErrServerClosed {
+		l.cancel()
+	}
+}
+
+// Handler will return the HTTP handler that Linker uses to redirect requests. This can be used to run Linker
+// inside another HTTP server (or a serverless adapter) instead of calling the Listen function. The handler reads
+// names from the request URL path, so it can be mounted under a prefix by using http.StripPrefix. The Close function
+// should be called once the handler is no longer used, so any pending hit counts are saved.
+func (l *Linker) Handler() http.Handler {
+	l.start()
+	s, a := l.wrap(http.HandlerFunc(l.serve), l.chain), l.wrap(http.HandlerFunc(l.called), l.calls)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		l.lock.RLock()
+		ok := len(l.api.token) > 0 && strings.HasPrefix(r.URL.Path, l.api.path+"/")
+		if l.lock.RUnlock(); ok {
+			a.ServeHTTP(w, r)
+			return
+		}
+		s.ServeHTTP(w, r)
+	})
+}
+
+// Use will add the supplied HTTP middleware functions to the redirect handler. Middleware runs in the order it was
+// added, with the first added middleware receiving the request first. Middleware added here is not used for the
+// management API (see UseAPI). This function must be called before the Handler or Listen functions to take effect.
+func (l *Linker) Use(m ...func(http.Handler) http.Handler) {
+	l.chain = append(l.chain, m...)
+}
+
+// UseAPI will add the supplied HTTP middleware functions to the management API handler, in the same order as Use.
+// Middleware added here is only used for requests under the "api" path and is not used for redirects. This function
+// must be called before the Handler or Listen functions to take effect.
+func (l *Linker) UseAPI(m ...func(http.Handler) http.Handler) {
+	l.calls = append(l.calls, m...)
+}
+func (l *Linker) wrap(h http.Handler, m []func(http.Handler) http.Handler) http.Handler {
+	if l.wait > 0 {
+		h = http.TimeoutHandler(h, l.wait, "")
+	}
+	for i := len(m) - 1; i >= 0; i-- {
+		h = m[i](h)
+	}
+	return h
 }
 
 // New creates a new Linker instance and attempts to gather the initial configuration from a JSON formatted file.
@@ -261,8 +718,31 @@ func New(s string) (*Linker, error) {
 	}
 	return l, nil
 }
-func (l *Linker) load(s string) error {
+
+// NewWithDB will create a Linker instance that uses the supplied MySQL database connection and the default
+// configuration (see Defaults) instead of reading a configuration file, which allows tests to supply their own
+// database (such as a mock database or a database in a test container). The tables are created in the database
+// when missing. The connection should be opened with the "parseTime=true" and "clientFoundRows=true" options. The
+// database is closed by the Close function.
+func NewWithDB(db *sql.DB) (*Linker, error) {
+	if db == nil {
+		return nil, errNotConfigured
+	}
 	var c config
+	if err := json.Unmarshal([]byte(Defaults), &c); err != nil {
+		return nil, &errval{s: "unable to parse the default configuration", e: err}
+	}
+	d, err := newMySQL(db, "the supplied database")
+	if err != nil {
+		return nil, err
+	}
+	l := &Linker{Server: http.Server{Handler: new(http.ServeMux)}}
+	if err = l.setup(c, d); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+func (l *Linker) load(s string) error {
 	if len(s) == 0 {
 		if v, ok := os.LookupEnv("LINKER_CONFIG"); ok {
 			s = v
@@ -270,79 +750,290 @@ func (l *Linker) load(s string) error {
 			s = defaultFile
 		}
 	}
-	b, err := ioutil.ReadFile(s)
+	c, v, err := read(s)
 	if err != nil {
-		return &errval{s: `unable to read file "` + s + `"`, e: err}
+		return err
 	}
-	if err = json.Unmarshal(b, &c); err != nil {
-		return &errval{s: `unable to parse file "` + s + `"`, e: err}
+	d, err := open(c.Database)
+	if err != nil {
+		return &errval{s: `file "` + s + `" does not contain a valid database configuration`, e: err}
 	}
-	if len(c.Database.Username) == 0 || len(c.Database.Server) == 0 || len(c.Database.Name) == 0 {
-		return &errval{s: `file "` + s + `" does not contain a valid database configuration`}
+	l.file, l.rev = s, v
+	return l.setup(c, d)
+}
+func read(s string) (config, string, error) {
+	var c config
+	f, err := locate(s)
+	if err != nil {
+		return c, "", err
 	}
-	if l.db, err = sql.Open("mysql", c.Database.Username+":"+c.Database.Password+"@"+c.Database.Server+"/"+c.Database.Name); err != nil {
-		return &errval{s: `unable to connect to database "` + c.Database.Name + `" on "` + c.Database.Server + `"`, e: err}
+	x, d := context.WithTimeout(context.Background(), defaultTimeout)
+	b, v, err := f.read(x)
+	if d(); err != nil {
+		return c, "", &errval{s: `unable to read file "` + s + `"`, e: err}
 	}
-	if err = l.db.Ping(); err != nil {
-		return &errval{s: `unable to connect to database "` + c.Database.Name + `" on "` + c.Database.Server + `"`, e: err}
+	j := json.NewDecoder(bytes.NewReader(b))
+	j.DisallowUnknownFields()
+	if err = j.Decode(&c); err == nil && j.More() {
+		err = &errval{s: "unexpected data after the end of the configuration"}
 	}
-	n, err := l.db.Prepare(sqlPrepare)
 	if err != nil {
-		l.db.Close()
-		return &errval{s: `unable to prepare the initial database table in "` + c.Database.Name + `" on "` + c.Database.Server + `"`, e: err}
-	}
-	_, err = n.Exec()
-	if n.Close(); err != nil {
-		l.db.Close()
-		return &errval{s: `unable to create the initial database table in "` + c.Database.Name + `" on "` + c.Database.Server + `"`, e: err}
+		return c, "", &errval{s: `unable to parse file "` + s + `"` + position(b, err), e: err}
 	}
-	if len(c.Default) > 0 {
-		u, err := url.Parse(c.Default)
-		if err != nil {
-			l.db.Close()
-			return &errval{s: `unable to parse default URL "` + c.Default + `"`, e: err}
-		}
-		if !u.IsAbs() {
-			u.Scheme = "https"
+	return c, v, nil
+}
+func position(b []byte, err error) string {
+	o := int64(-1)
+	switch e := err.(type) {
+	case *json.SyntaxError:
+		o = e.Offset
+	case *json.UnmarshalTypeError:
+		o = e.Offset
+	default:
+		s := err.Error()
+		if i := strings.Index(s, `unknown field "`); i >= 0 {
+			if n := s[i+14:]; strings.IndexByte(n[1:], '"') > 0 {
+				o = int64(bytes.Index(b, []byte(n[:strings.IndexByte(n[1:], '"')+2])))
+			}
 		}
-		l.url = u.String()
 	}
-	if len(l.url) == 0 {
-		l.url = defaultURL
+	if o < 0 || o > int64(len(b)) {
+		return ""
+	}
+	var (
+		l = bytes.Count(b[:o], []byte{'\n'}) + 1
+		c = o - int64(bytes.LastIndexByte(b[:o], '\n'))
+	)
+	return " at line " + strconv.Itoa(l) + ", column " + strconv.FormatInt(c, 10)
+}
+func (l *Linker) setup(c config, d store) error {
+	var err error
+	if l.db, err = seal(measure(retry(d, c.Database.Retry), c.Database.Slow), c.Crypt); err != nil {
+		d.close()
+		return err
+	}
+	if s, ok := d.(*snapshotDB); ok {
+		s.report = &l.report
+	}
+	if err = l.max.load(c.Limits); err != nil {
+		l.db.close()
+		return err
+	}
+	if err = l.db.resize(l.max.name, l.max.url); err != nil {
+		l.db.close()
+		return err
+	}
+	if err = l.def.load(c.Default, c.Fallback); err != nil {
+		l.db.close()
+		return err
+	}
+	if l.policy, err = c.TLS.config(); err != nil {
+		l.db.close()
+		return err
+	}
+	if l.Server.Addr, err = bind(c.Listen, len(c.Key) > 0 && len(c.Cert) > 0); err != nil {
+		l.db.close()
+		return err
 	}
-	l.Server.Addr = c.Listen
 	l.key, l.cert = c.Key, c.Cert
 	l.Server.BaseContext = l.context
-	l.Server.ReadTimeout = time.Second * time.Duration(c.Timeout)
-	l.Server.IdleTimeout = l.Server.ReadTimeout
-	l.Server.WriteTimeout, l.Server.ReadHeaderTimeout = l.Server.ReadTimeout, l.Server.ReadTimeout
+	if err = c.Timeout.check(); err != nil {
+		l.db.close()
+		return err
+	}
+	l.wait, l.lookup = time.Duration(c.Timeout.Handler), time.Duration(c.Timeout.Lookup)
+	l.delay, l.grace = time.Duration(c.Timeout.Drain), time.Duration(c.Timeout.Shutdown)
+	l.Server.ReadTimeout, l.Server.IdleTimeout = time.Duration(c.Timeout.Read), time.Duration(c.Timeout.Idle)
+	l.Server.WriteTimeout, l.Server.ReadHeaderTimeout = time.Duration(c.Timeout.Write), time.Duration(c.Timeout.Header)
+	if c.Cache.Missing > 0 || c.Cache.TTL > 0 || c.Cache.Budget > 0 {
+		if l.cache.limit = int(c.Cache.Limit); l.cache.limit == 0 {
+			l.cache.limit = defaultCacheLimit
+		}
+		l.cache.ttl, l.cache.warm = time.Duration(c.Cache.TTL), int(c.Cache.Warm)
+		l.cache.budget = time.Duration(c.Cache.Budget)
+		l.cache.missing, l.cache.entries = time.Duration(c.Cache.Missing), make(map[string]entry)
+	}
+	l.fail = c.Breaker.Redirect
+	l.norm.load(c.Normal)
+	l.bots.load(c.Bots)
+	if err = l.settings(c); err != nil {
+		l.db.close()
+		return err
+	}
+	if c.Features.enabled("stats") {
+		l.stats.load(c.Stats)
+	}
+	if r := time.Duration(c.Stats.Retention); r < 0 || (r > 0 && r < 24*time.Hour) {
+		l.db.close()
+		return &errval{s: `stats "retention" must be zero or at least one day`}
+	}
+	if c.Alerts.Threshold > 0 && l.stats.hits == nil {
+		l.db.close()
+		return &errval{s: `alerts can not be used when "stats" is disabled`}
+	}
+	l.alerts.load(c.Alerts)
+	l.alerts.report = &l.report
+	if err = l.report.load(c.Report); err != nil {
+		l.db.close()
+		return err
+	}
+	l.brk.max, l.brk.cool = c.Breaker.Threshold, time.Duration(c.Breaker.Cooldown)
+	if l.body, l.Server.MaxHeaderBytes = int64(c.Body), int(c.Header); l.body == 0 {
+		l.body = defaultBody
+	}
+	if l.Server.MaxHeaderBytes == 0 {
+		l.Server.MaxHeaderBytes = defaultHeader
+	}
+	l.conf = c
+	return nil
+}
+func (l *Linker) settings(c config) error {
+	l.strict, l.append = c.Strict, c.Append == nil || *c.Append
+	switch strings.ToLower(c.Slashes) {
+	case "", "lenient":
+		l.slash = false
+	case "strict":
+		l.slash = true
+	default:
+		return &errval{s: `invalid slashes mode "` + c.Slashes + `"`}
+	}
+	if l.hosts = nil; len(c.Hosts) > 0 {
+		l.hosts = make(map[string]struct{}, len(c.Hosts))
+		for i := range c.Hosts {
+			l.hosts[strings.ToLower(c.Hosts[i])] = struct{}{}
+		}
+	}
+	if l.static = nil; len(c.Static) > 0 {
+		l.static = make(map[string]string, len(c.Static))
+		for n, u := range c.Static {
+			if !validName(n) {
+				return &errval{s: `static name "` + n + `" contains invalid characters`}
+			}
+			p, err := l.parse(u)
+			if err != nil {
+				return err
+			}
+			l.static[n] = p
+		}
+	}
+	if err := l.known.load(c.Known); err != nil {
+		return err
+	}
+	if err := l.crawl.load(c.Crawlers); err != nil {
+		return err
+	}
+	if err := l.sign.load(c.Signing); err != nil {
+		return err
+	}
+	if err := l.geo.load(c.Geo); err != nil {
+		return err
+	}
+	if err := l.claim.load(c.Claim); err != nil {
+		return err
+	}
+	if err := l.recycle.load(c.Recycle); err != nil {
+		return err
+	}
+	if err := l.find.load(c.Search); err != nil {
+		return err
+	}
+	if err := l.rank.load(c.Popular); err != nil {
+		return err
+	}
+	if err := l.news.load(c.Feed); err != nil {
+		return err
+	}
+	if err := l.api.load(c.API); err != nil {
+		return err
+	}
+	if err := l.refresh.load(c.Refresh); err != nil {
+		return err
+	}
+	p, err := policy(c.Referrer)
+	if err != nil {
+		return err
+	}
+	l.referrer = p
+	if l.proxy, err = trust(c.Proxies); err != nil {
+		return err
+	}
+	if !c.Features.enabled("api") {
+		l.api.token = ""
+	}
+	if !c.Features.enabled("claim") {
+		l.claim.path = ""
+	}
+	if len(l.claim.path) > 0 && len(l.claim.secret) == 0 && len(l.proxy) == 0 {
+		os.Stderr.WriteString(`Claim page is disabled as "proxies" or the claim "secret" must be set to trust users!` + "\n")
+		l.claim.path = ""
+	}
+	if len(l.geo.header) > 0 && len(l.proxy) == 0 {
+		os.Stderr.WriteString(`Geo "header" is ignored as "proxies" must be set to trust it!` + "\n")
+		l.geo.header = ""
+	}
+	if len(l.find.path) > 0 && len(l.find.header) > 0 && len(l.proxy) == 0 {
+		os.Stderr.WriteString(`Search page is disabled as "proxies" must be set to trust its "header"!` + "\n")
+		l.find.path = ""
+	}
+	if len(l.rank.path) > 0 && len(l.rank.header) > 0 && len(l.proxy) == 0 {
+		os.Stderr.WriteString(`Popular page is disabled as "proxies" must be set to trust its "header"!` + "\n")
+		l.rank.path = ""
+	}
+	if !c.Features.enabled("search") {
+		l.find.path = ""
+	}
+	if !c.Features.enabled("popular") {
+		l.rank.path = ""
+	}
+	if !c.Features.enabled("feed") {
+		l.news.path = ""
+	}
+	l.previews, l.apps = c.Features.enabled("previews"), c.Features.enabled("apps")
 	return nil
 }
 
 // Add will attempt to add a redirect with the name of the first string to the URL provided in the second
-// string argument. This function will return an error if the add fails.
+// string argument. This function will return an error if the add fails or the name was deleted during the
+// configured recycle cooldown.
 func (l *Linker) Add(n, u string) error {
+	return l.add(n, u, "", 0)
+}
+func (l *Linker) add(n, u, o string, q int) error {
 	if l.db == nil {
 		return errNotConfigured
 	}
 	if !validName(n) {
 		return &errval{s: `name "` + n + `" contains invalid characters`}
 	}
-	p, err := url.Parse(strings.TrimSpace(u))
-	if err != nil {
-		return &errval{s: `invalid URL "` + u + `"`, e: err}
+	l.lock.RLock()
+	_, ok := l.static[n]
+	if l.lock.RUnlock(); ok {
+		return &errval{s: `name "` + n + `" is a static redirect in the configuration`}
 	}
-	if !p.IsAbs() {
-		p.Scheme = "https"
+	switch m, err := l.recycled(context.Background(), n, o); {
+	case err != nil:
+		return err
+	case len(m) > 0:
+		return &errval{s: `name "` + n + `" ` + m}
 	}
-	q, err := l.db.Prepare(sqlAdd)
+	p, err := l.target(n, u)
 	if err != nil {
-		return &errval{s: "unable to prepare add statement", e: err}
+		return err
 	}
-	_, err = q.Exec(n, p.String())
-	if q.Close(); err != nil {
-		return &errval{s: "unable to execute add statement", e: err}
+	if err = l.max.check(n, p); err != nil {
+		return err
+	}
+	// Claimed names are added with their owner in one transaction, so the quota can not be passed by claiming
+	// names at the same time.
+	if len(o) > 0 {
+		err = l.db.claim(n, p, o, q)
+	} else {
+		err = l.db.add(n, p)
+	}
+	if err != nil {
+		return err
 	}
+	l.cache.remove(n)
 	return nil
 }
 
@@ -355,55 +1046,379 @@ func (l *Linker) Delete(n string) error {
 	if !validName(n) {
 		return &errval{s: `name "` + n + `" contains invalid characters`}
 	}
-	q, err := l.db.Prepare(sqlDelete)
+	if err := l.db.delete(n); err != nil {
+		return err
+	}
+	l.cache.remove(n)
+	return nil
+}
+func (l *Linker) parse(u string) (string, error) {
+	if _, ok := aliased(strings.TrimSpace(u)); ok {
+		return "", &errval{s: `alias "` + u + `" can only be used as the URL of a mapping`}
+	}
+	p, err := url.Parse(strings.TrimSpace(u))
 	if err != nil {
-		return &errval{s: "unable to prepare delete statement", e: err}
+		return "", &errval{s: `invalid URL "` + u + `"`, e: err}
+	}
+	// A URL without a scheme (such as "example.com/path") is parsed as a path, so it is parsed again with a scheme
+	// or normalizing it would add a slash in front of the host name.
+	if !p.IsAbs() && len(p.Host) == 0 && len(p.Opaque) == 0 && !strings.HasPrefix(p.Path, "/") {
+		if p, err = url.Parse("https://" + strings.TrimSpace(u)); err != nil {
+			return "", &errval{s: `invalid URL "` + u + `"`, e: err}
+		}
 	}
-	_, err = q.Exec(n)
-	if q.Close(); err != nil {
-		return &errval{s: "unable to execute delete statement", e: err}
+	if !p.IsAbs() {
+		p.Scheme = "https"
 	}
+	// The query is kept as it was sent, so spaces are escaped or they would be trimmed when the URL is read again.
+	p.RawQuery = strings.Replace(p.RawQuery, " ", "%20", -1)
+	if err = punycode(p); err != nil {
+		return "", err
+	}
+	if p, err = l.norm.normalize(p); err != nil {
+		return "", err
+	}
+	return p.String(), nil
+}
+
+// SetAppend will change whether any extra path and query data in a request is added to the URL of the redirect
+// with the supplied name. A nil value will reset the redirect to use the "append" config value. This function
+// will return an error if the change fails or the name does not exist.
+func (l *Linker) SetAppend(n string, a *bool) error {
+	if l.db == nil {
+		return errNotConfigured
+	}
+	if !validName(n) {
+		return &errval{s: `name "` + n + `" contains invalid characters`}
+	}
+	if err := l.db.setAppend(n, a); err != nil {
+		return err
+	}
+	l.cache.remove(n)
 	return nil
 }
 func (l *Linker) context(_ net.Listener) context.Context {
 	return l.ctx
 }
-func (l *Linker) serve(w http.ResponseWriter, r *http.Request) {
-	defer func() {
-		if err := recover(); err != nil {
-			os.Stderr.WriteString("HTTP function recovered from a panic: ")
-			fmt.Fprintln(os.Stderr, err)
+func (l *Linker) query(n string) (interface{}, error) {
+	// The lookup is shared by every request waiting for the name, so it is not stopped when one of them is
+	// cancelled, but it is always bounded (by "lookup" or defaultLookup) so it can not run forever.
+	x, t := l.ctx, l.lookup
+	if x == nil {
+		x = context.Background()
+	}
+	if t <= 0 {
+		t = defaultLookup
+	}
+	x, f := context.WithTimeout(x, t)
+	v, err := l.db.get(x, n)
+	f()
+	switch l.brk.report(err); {
+	case err == nil:
+		l.cache.set(n, v, l.cache.ttl)
+	case err == sql.ErrNoRows:
+		l.cache.set(n, record{}, l.cache.missing)
+	}
+	return v, err
+}
+func (l *Linker) fetch(x context.Context, n string) (record, error) {
+	if v, ok := l.cache.get(n); ok {
+		if len(v.url) == 0 {
+			return v, sql.ErrNoRows
 		}
-	}()
-	if r.Body.Close(); len(r.RequestURI) <= 1 {
-		http.Redirect(w, r, l.url, http.StatusTemporaryRedirect)
-		return
+		return v, nil
+	}
+	if !l.brk.allow() {
+		return record{}, errBreakerOpen
 	}
 	var (
-		s = html.EscapeString(r.RequestURI)
-		p = regCheckURL.FindStringIndex(s)
+		c    = l.group.DoChan(n, func() (interface{}, error) { return l.query(n) })
+		s, o = l.cache.last(n)
+		t    <-chan time.Time
 	)
-	if p == nil || p[0] != 0 || p[1] <= 1 {
-		http.Redirect(w, r, l.url, http.StatusTemporaryRedirect)
+	if o {
+		b := time.NewTimer(l.cache.budget)
+		defer b.Stop()
+		t = b.C
+	}
+	select {
+	case r := <-c:
+		if r.Err != nil {
+			return record{}, r.Err
+		}
+		return r.Val.(record), nil
+	case <-t:
+		l.cache.lock.Lock()
+		l.cache.stale++
+		l.cache.lock.Unlock()
+		return s, nil
+	case <-x.Done():
+		return record{}, x.Err()
+	}
+}
+func (l *Linker) recovered(w http.ResponseWriter, r *http.Request) {
+	err := recover()
+	if err == nil {
+		return
+	}
+	if err == http.ErrAbortHandler {
+		panic(err)
+	}
+	s := debug.Stack()
+	os.Stderr.WriteString("HTTP function recovered from a panic: ")
+	fmt.Fprintln(os.Stderr, err)
+	os.Stderr.Write(s)
+	l.report.panic(r, err, s)
+	failInternal.write(w, r)
+}
+func (l *Linker) serve(w http.ResponseWriter, r *http.Request) {
+	defer l.recovered(w, r)
+	l.lock.RLock()
+	// The settings are copied so the lock is not held while waiting on the database, which would also block a Reload.
+	s := l.current()
+	if l.lock.RUnlock(); len(s.claim) > 0 && r.URL.Path == s.claim {
+		l.claimed(w, r)
+		return
+	}
+	if r.Body.Close(); r.ContentLength > l.body {
+		failTooLarge.write(w, r)
+		return
+	}
+	if strings.HasPrefix(r.URL.Path, knownPrefix) {
+		s.known.serve(w, r)
+		return
+	}
+	a := s.proxy.client(r)
+	if l.bots.deny(r, a) {
+		failNotFound.write(w, r)
+		return
+	}
+	g := s.geo.country(r, s.proxy, a)
+	if s.geo.blocked(w, g) {
+		return
+	}
+	if len(s.find) > 0 && r.URL.Path == s.find {
+		l.searched(w, r)
+		return
+	}
+	if len(s.rank) > 0 && r.URL.Path == s.rank {
+		l.ranked(w, r)
+		return
+	}
+	if len(s.news) > 0 && r.URL.Path == s.news {
+		l.feed(w, r)
+		return
+	}
+	c := s.crawl.crawler(r)
+	if c && s.crawl.action == crawlBlock {
+		failNotFound.write(w, r)
+		return
+	}
+	k, e := request(r.URL, s.slash)
+	if len(k) == 0 {
+		l.missing(w, r)
+		return
+	}
+	x, o, ok := l.before(r, k)
+	if !ok || l.alerts.blocked(x) {
+		l.missing(w, r)
+		return
+	}
+	v := record{url: o}
+	if len(o) == 0 {
+		v.url = s.static[x]
+	}
+	if len(v.url) == 0 {
+		var err error
+		if v, err = l.fetch(r.Context(), x); err == nil {
+			v, err = l.chase(r.Context(), v)
+		}
+		if err != nil {
+			if err == sql.ErrNoRows {
+				l.hooks.onMiss(x, r)
+				l.missing(w, r)
+				return
+			}
+			if errors.Is(err, context.Canceled) {
+				if r.Context().Err() == nil {
+					failUnavailable.write(w, r)
+				}
+				return
+			}
+			if err == errAliasLoop {
+				l.report.error(`Unable to resolve alias "`+x+`"`, err)
+				l.missing(w, r)
+				return
+			}
+			if l.hooks.onError(err, r); err == errBreakerOpen && l.fail {
+				l.missing(w, r)
+				return
+			}
+			if err == errBreakerOpen {
+				w.Header().Set("Retry-After", strconv.Itoa(int(l.brk.cool/time.Second)))
+				failUnavailable.write(w, r)
+				return
+			}
+			failLookup.write(w, r)
+			l.report.error("HTTP function received an error", err)
+			return
+		}
+	}
+	if len(v.url) == 0 {
+		l.hooks.onMiss(x, r)
+		l.missing(w, r)
+		return
+	}
+	if len(v.refs) > 0 && !referred(r, v.refs) {
+		failNotFound.write(w, r)
+		return
+	}
+	if len(v.geo) > 0 && !permitted(v.geo, g) {
+		s.geo.write(w)
 		return
 	}
-	n, x := "", s[1:p[1]]
-	if err := l.get.QueryRowContext(l.ctx, x).Scan(&n); err != nil {
-		if err == sql.ErrNoRows {
-			http.Redirect(w, r, l.url, http.StatusTemporaryRedirect)
+	if len(v.key) > 0 || s.sign.required {
+		if !s.sign.verify(v.key, x, r.URL.Query().Get(s.sign.param)) {
+			l.missing(w, r)
 			return
 		}
-		w.WriteHeader(http.StatusInternalServerError)
-		w.Write([]byte(`Could not fetch requested URL "` + x + `"`))
-		os.Stderr.WriteString("HTTP function received an error: " + err.Error() + "!\n")
+		r.URL.RawQuery = strip(r.URL.RawQuery, s.sign.param)
+	}
+	if v.url, ok = l.after(r, x, v.url); !ok {
+		l.missing(w, r)
 		return
 	}
-	if len(n) == 0 {
-		http.Redirect(w, r, l.url, http.StatusTemporaryRedirect)
+	n := location(v.url)
+	if len(r.URL.RawQuery) > 0 {
+		e = e + "?" + r.URL.RawQuery
+	}
+	if len(e) > 0 {
+		switch {
+		case (v.append.Valid && v.append.Bool) || (!v.append.Valid && s.append && !s.strict):
+			if n, ok = s.extend(n, e); !ok {
+				l.missing(w, r)
+				return
+			}
+		case s.strict:
+			l.missing(w, r)
+			return
+		}
+	}
+	if l.stats.bots || !l.bots.bot(r) {
+		l.stats.add(x, a, r)
+	}
+	l.hooks.onHit(Link{Name: x, URL: n}, r)
+	if len(s.referrer) > 0 {
+		w.Header().Set("Referrer-Policy", s.referrer)
+	}
+	for k, h := range v.heads {
+		w.Header().Set(k, h)
+	}
+	if s.previews && v.meta != nil && social(r) {
+		preview(w, v.meta, n)
 		return
 	}
-	if p[1] < len(s) {
-		n = n + s[p[1]:]
+	if c {
+		noindex(w, n)
+		return
+	}
+	if s.apps && len(v.app) > 0 && mobile(r) {
+		interstitial(w, v.app, n)
+		return
+	}
+	if (v.refresh.Valid && v.refresh.Bool) || (!v.refresh.Valid && s.refresh.on) {
+		s.refresh.write(w, n)
+		return
 	}
 	http.Redirect(w, r, n, http.StatusTemporaryRedirect)
 }
+func request(u *url.URL, s bool) (string, string) {
+	d, p := u.Path, u.EscapedPath()
+	for !s && len(d) > 1 && d[1] == '/' && len(p) > 1 && p[1] == '/' {
+		d, p = d[1:], p[1:]
+	}
+	n := regCheckURL.FindString(d)
+	if len(n) <= 1 {
+		return "", ""
+	}
+	i := 1
+	if len(p) == 0 || p[0] != '/' {
+		return "", ""
+	}
+	for c := 1; c < len(n); c++ {
+		switch {
+		case i >= len(p):
+			return "", ""
+		case p[i] == '%':
+			i += 3
+		default:
+			i++
+		}
+	}
+	if i > len(p) {
+		return "", ""
+	}
+	if s {
+		return n[1:], p[i:]
+	}
+	e := p[i:]
+	for strings.Contains(e, "//") {
+		e = strings.Replace(e, "//", "/", -1)
+	}
+	if e == "/" {
+		return n[1:], ""
+	}
+	return n[1:], e
+}
+func (s *view) extend(u, x string) (string, bool) {
+	if len(x) == 0 {
+		return u, true
+	}
+	if x[0] != '/' && x[0] != '?' {
+		return "", false
+	}
+	for i := 0; i < len(x); i++ {
+		if x[i] == '\\' || x[i] < 0x21 || x[i] == 0x7F {
+			return "", false
+		}
+	}
+	b, err := url.Parse(u)
+	if err != nil {
+		return "", false
+	}
+	n := join(u, x)
+	r, err := url.Parse(n)
+	if err != nil || r.Scheme != b.Scheme || r.User.String() != b.User.String() {
+		return "", false
+	}
+	if !strings.EqualFold(r.Host, b.Host) {
+		if _, ok := s.hosts[strings.ToLower(r.Hostname())]; !ok {
+			return "", false
+		}
+	}
+	return n, true
+}
+func join(u, x string) string {
+	var f, q, v string
+	if i := strings.IndexByte(u, '#'); i >= 0 {
+		u, f = u[:i], u[i:]
+	}
+	if i := strings.IndexByte(u, '?'); i >= 0 {
+		u, q = u[:i], u[i+1:]
+	}
+	if i := strings.IndexByte(x, '?'); i >= 0 {
+		x, v = x[:i], x[i+1:]
+	}
+	if len(x) > 0 && x[0] == '/' && len(u) > 0 && u[len(u)-1] == '/' {
+		x = x[1:]
+	}
+	switch u = u + x; {
+	case len(q) > 0 && len(v) > 0:
+		u = u + "?" + q + "&" + v
+	case len(q) > 0:
+		u = u + "?" + q
+	case len(v) > 0:
+		u = u + "?" + v
+	}
+	return u + f
+}
@@ -0,0 +1,640 @@
+// linker_test.go
+// URL Shortener with MySQL database.
+//
+// Copyright (C) 2020 iDigitalFlame
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+//
+
+package linker
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+// memory is a store that keeps redirects in a map, so the handler can be tested without a database. Every
+// method that is not used by the handler or by Add and Delete panics through the nil embedded store.
+type memory struct {
+	store
+	links map[string]record
+	fail  map[string]error
+}
+
+func (*memory) close() error {
+	return nil
+}
+func (*memory) resize(_, _ int) error {
+	return nil
+}
+func (*memory) hits(_ context.Context, _ map[string]uint64) error {
+	return nil
+}
+func (*memory) daily(_ context.Context, _ time.Time, _, _ map[string]uint64) error {
+	return nil
+}
+func (m *memory) add(n, u string) error {
+	if _, ok := m.links[n]; ok {
+		return &errval{s: `name "` + n + `" already exists`}
+	}
+	if m.links == nil {
+		m.links = make(map[string]record)
+	}
+	m.links[n] = record{url: u}
+	return nil
+}
+func (m *memory) delete(n string) error {
+	delete(m.links, n)
+	return nil
+}
+func (m *memory) get(_ context.Context, n string) (record, error) {
+	if err, ok := m.fail[n]; ok {
+		return record{}, err
+	}
+	v, ok := m.links[n]
+	if !ok {
+		return record{}, sql.ErrNoRows
+	}
+	return v, nil
+}
+
+// flaky is a memory database that fails to save hit counts while err is set.
+type flaky struct {
+	*memoryDB
+	err error
+}
+
+func (f *flaky) hits(x context.Context, h map[string]uint64) error {
+	if f.err != nil {
+		return f.err
+	}
+	return f.memoryDB.hits(x, h)
+}
+
+// newTest returns a Linker that uses the supplied store, with the default configuration changed by the JSON
+// object in s.
+func newTest(t *testing.T, d store, s string) *Linker {
+	t.Helper()
+	l := &Linker{Server: http.Server{Handler: new(http.ServeMux)}}
+	if err := l.setup(testConfig(t, s), d); err != nil {
+		t.Fatalf("unable to setup Linker: %s", err)
+	}
+	t.Cleanup(func() { l.Close() })
+	return l
+}
+func testConfig(t *testing.T, s string) config {
+	t.Helper()
+	var c config
+	if err := json.Unmarshal([]byte(Defaults), &c); err != nil {
+		t.Fatalf("unable to parse the default configuration: %s", err)
+	}
+	if len(s) > 0 {
+		if err := json.Unmarshal([]byte(s), &c); err != nil {
+			t.Fatalf("unable to parse the test configuration: %s", err)
+		}
+	}
+	return c
+}
+func TestServe(t *testing.T) {
+	d := &memory{
+		links: map[string]record{"foo": {url: "https://example.com/foo"}, "q": {url: "https://example.com/q?a=1"}},
+		fail:  map[string]error{"broken": errors.New("database is down")},
+	}
+	h := newTest(t, d, `{"default": "https://example.com/missing"}`).Handler()
+	v := [...]struct {
+		name, path, location string
+		status               int
+	}{
+		{"redirect", "/foo", "https://example.com/foo", http.StatusTemporaryRedirect},
+		{"redirect with path", "/foo/bar", "https://example.com/foo/bar", http.StatusTemporaryRedirect},
+		{"redirect with query", "/q?b=2", "https://example.com/q?a=1&b=2", http.StatusTemporaryRedirect},
+		{"missing", "/nope", "https://example.com/missing", http.StatusTemporaryRedirect},
+		{"empty", "/", "https://example.com/missing", http.StatusTemporaryRedirect},
+		{"invalid extra data", "/foo%2Fbar", "https://example.com/missing", http.StatusTemporaryRedirect},
+		{"lookup error", "/broken", "", http.StatusInternalServerError},
+	}
+	for _, c := range v {
+		t.Run(c.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, c.path, nil)
+			r.Header.Set("User-Agent", "Mozilla/5.0")
+			w := httptest.NewRecorder()
+			if h.ServeHTTP(w, r); w.Code != c.status {
+				t.Fatalf("status is %d, expected %d", w.Code, c.status)
+			}
+			if l := w.Header().Get("Location"); l != c.location {
+				t.Fatalf("location is %q, expected %q", l, c.location)
+			}
+		})
+	}
+}
+func TestAPI(t *testing.T) {
+	d := &memory{links: map[string]record{"api": {url: "https://example.com/api"}}}
+	h := newTest(t, d, `{"api": {"token": "sekret"}}`).Handler()
+	v := [...]struct {
+		name, method, path, auth string
+		status                   int
+	}{
+		{"no token", http.MethodGet, "/api/v1/version", "", http.StatusUnauthorized},
+		{"wrong token", http.MethodGet, "/api/v1/version", "Bearer wrong", http.StatusUnauthorized},
+		{"wrong scheme", http.MethodGet, "/api/v1/version", "Basic sekret", http.StatusUnauthorized},
+		{"version", http.MethodGet, "/api/v1/version", "Bearer sekret", http.StatusOK},
+		{"lower case scheme", http.MethodGet, "/api/v1/version", "bearer sekret", http.StatusOK},
+		{"wrong method", http.MethodPost, "/api/v1/version", "Bearer sekret", http.StatusMethodNotAllowed},
+		{"unknown call", http.MethodGet, "/api/v1/nope", "Bearer sekret", http.StatusNotFound},
+		{"quit without listen", http.MethodPost, "/api/v1/quit", "Bearer sekret", http.StatusConflict},
+		{"alerts", http.MethodGet, "/api/v1/alerts", "Bearer sekret", http.StatusOK},
+		{"unblock not disabled", http.MethodDelete, "/api/v1/alerts?name=api", "Bearer sekret", http.StatusNotFound},
+		{"name below the path", http.MethodGet, "/api", "", http.StatusTemporaryRedirect},
+	}
+	for _, c := range v {
+		t.Run(c.name, func(t *testing.T) {
+			r := httptest.NewRequest(c.method, c.path, nil)
+			if len(c.auth) > 0 {
+				r.Header.Set("Authorization", c.auth)
+			}
+			r.Header.Set("User-Agent", "Mozilla/5.0")
+			w := httptest.NewRecorder()
+			if h.ServeHTTP(w, r); w.Code != c.status {
+				t.Fatalf("status is %d, expected %d", w.Code, c.status)
+			}
+			if c.status == http.StatusUnauthorized && len(w.Header().Get("WWW-Authenticate")) == 0 {
+				t.Fatal("missing WWW-Authenticate header")
+			}
+		})
+	}
+}
+func TestRequest(t *testing.T) {
+	v := [...]struct {
+		path, name, extra string
+		strict            bool
+	}{
+		{"/foo", "foo", "", false},
+		{"/foo/", "foo", "", false},
+		{"/foo/", "foo", "/", true},
+		{"/foo//", "foo", "", false},
+		{"/foo//", "foo", "//", true},
+		{"/foo/bar/", "foo", "/bar/", false},
+		{"//foo//bar//", "foo", "/bar/", false},
+		{"//foo//bar//", "", "", true},
+		{"/%66oo/x", "foo", "/x", false},
+		{"/foo%2Fbar", "foo", "%2Fbar", false},
+		{"/foo%2Fbar", "foo", "%2Fbar", true},
+		{"/foo%2fbar", "foo", "%2fbar", false},
+		{"/foo%2fbar", "foo", "%2fbar", true},
+		{"/foo%252Fbar", "foo", "%252Fbar", false},
+		{"/foo%252Fbar", "foo", "%252Fbar", true},
+		{"/foo/bar%2Fbaz", "foo", "/bar%2Fbaz", false},
+		{"/foo/%2F", "foo", "/%2F", false},
+		{"/foo%2F/", "foo", "%2F/", false},
+		{"/", "", "", false},
+	}
+	for _, c := range v {
+		u, err := url.ParseRequestURI(c.path)
+		if err != nil {
+			t.Fatalf("unable to parse %q: %s", c.path, err)
+		}
+		if n, e := request(u, c.strict); n != c.name || e != c.extra {
+			t.Errorf("request(%q, %t) is (%q, %q), expected (%q, %q)", c.path, c.strict, n, e, c.name, c.extra)
+		}
+	}
+}
+func TestExtend(t *testing.T) {
+	var s view
+	v := [...]struct {
+		url, extra, result string
+		ok                 bool
+	}{
+		{"https://example.com/a", "", "https://example.com/a", true},
+		{"https://example.com/a", "/b", "https://example.com/a/b", true},
+		{"https://example.com/a/", "/b", "https://example.com/a/b", true},
+		{"https://example.com/a#frag", "/b", "https://example.com/a/b#frag", true},
+		{"https://example.com/a#frag", "?x=1", "https://example.com/a?x=1#frag", true},
+		{"https://example.com/a#frag", "/b?x=1", "https://example.com/a/b?x=1#frag", true},
+		{"https://example.com/a?a=1", "?a=2", "https://example.com/a?a=1&a=2", true},
+		{"https://example.com/a?a=1#f", "/b?c=2", "https://example.com/a/b?a=1&c=2#f", true},
+		{"https://example.com/a?a=1", "?", "https://example.com/a?a=1", true},
+		{"https://example.com/a", "?", "https://example.com/a", true},
+		{"https://example.com/a?", "?b=1", "https://example.com/a?b=1", true},
+		{"https://example.com/a?", "/b", "https://example.com/a/b", true},
+		{"https://example.com", "@evil.com", "", false},
+		{"https://example.com", "/b\\c", "", false},
+		{"https://example.com", "/b c", "", false},
+		{"https://example.com", "/b\x7F", "", false},
+		{"https://user@example.com", "/b", "https://user@example.com/b", true},
+		{"https://example.com:8443", "/b", "https://example.com:8443/b", true},
+	}
+	for _, c := range v {
+		r, ok := s.extend(c.url, c.extra)
+		if r != c.result || ok != c.ok {
+			t.Errorf("extend(%q, %q) is (%q, %t), expected (%q, %t)", c.url, c.extra, r, ok, c.result, c.ok)
+		}
+	}
+	x := [...]struct{ url, extra, result string }{
+		{"https://example.com/a#frag", "/b?x=1", "https://example.com/a/b?x=1#frag"},
+		{"https://example.com/a?a=1", "?a=2", "https://example.com/a?a=1&a=2"},
+		{"https://example.com/a?", "", "https://example.com/a"},
+		{"https://example.com/a?a=1#f", "", "https://example.com/a?a=1#f"},
+		{"https://example.com/a/", "/", "https://example.com/a/"},
+	}
+	for _, c := range x {
+		if r := join(c.url, c.extra); r != c.result {
+			t.Errorf("join(%q, %q) is %q, expected %q", c.url, c.extra, r, c.result)
+		}
+	}
+}
+func TestAlias(t *testing.T) {
+	d := &memory{links: map[string]record{
+		"target": {url: "https://example.com/target", key: "secret", refs: []string{"target.com"}},
+		"alias":  {url: aliasPrefix + "target", refs: []string{"example.org"}, heads: map[string]string{"X-A": "1"}},
+	}}
+	h := newTest(t, d, `{"default": "https://example.com/missing"}`).Handler()
+	v := [...]struct {
+		name, path, referer, location string
+	}{
+		{"target without signature", "/target", "https://target.com/", "https://example.com/missing"},
+		{"alias referrer", "/alias", "https://example.org/", "https://example.com/target"},
+		{"target referrer on alias", "/alias", "https://target.com/", ""},
+	}
+	for _, c := range v {
+		t.Run(c.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, c.path, nil)
+			r.Header.Set("User-Agent", "Mozilla/5.0")
+			r.Header.Set("Referer", c.referer)
+			w := httptest.NewRecorder()
+			if h.ServeHTTP(w, r); w.Header().Get("Location") != c.location {
+				t.Fatalf("location is %q, expected %q", w.Header().Get("Location"), c.location)
+			}
+			if len(c.location) > 0 && c.path == "/alias" && w.Header().Get("X-A") != "1" {
+				t.Fatal("alias headers were not written")
+			}
+		})
+	}
+}
+func TestParse(t *testing.T) {
+	var l Linker
+	l.norm.load(normalizeConfig{Enabled: true})
+	v := [...]struct{ url, result string }{
+		{"example.com/foo", "https://example.com/foo"},
+		{"Example.COM", "https://example.com"},
+		{"example.com/a/../b?q=1", "https://example.com/b?q=1"},
+		{"//example.com/foo", "https://example.com/foo"},
+		{"http://example.com:80/foo", "http://example.com/foo"},
+		{" https://example.com/ ", "https://example.com/"},
+	}
+	for _, c := range v {
+		if r, err := l.parse(c.url); err != nil || r != c.result {
+			t.Errorf("parse(%q) is (%q, %v), expected %q", c.url, r, err, c.result)
+		}
+	}
+}
+func TestAddDelete(t *testing.T) {
+	d := new(memory)
+	l := newTest(t, d, `{"default": "https://example.com/missing"}`)
+	if err := l.Add("foo", "https://example.com/foo"); err != nil {
+		t.Fatalf("unable to add link: %s", err)
+	}
+	if err := l.Add("foo", "https://example.com/bar"); err == nil {
+		t.Fatal("duplicate name was added")
+	}
+	if err := l.Add("a b", "https://example.com/foo"); err == nil {
+		t.Fatal("invalid name was added")
+	}
+	if r := d.links["foo"]; r.url != "https://example.com/foo" {
+		t.Fatalf("stored URL is %q, expected %q", r.url, "https://example.com/foo")
+	}
+	if err := l.Delete("foo"); err != nil {
+		t.Fatalf("unable to delete link: %s", err)
+	}
+	if err := l.Delete("foo"); err != nil {
+		t.Fatalf("delete of a missing link failed: %s", err)
+	}
+	if _, ok := d.links["foo"]; ok {
+		t.Fatal("link was not deleted")
+	}
+}
+func TestSearchPage(t *testing.T) {
+	l := newTest(t, openMemory(), `{"proxies": ["10.0.0.0/8"], "search": {"path": "/search", "header": "X-User"}}`)
+	if err := l.Add("docs", "https://example.com/docs"); err != nil {
+		t.Fatalf("unable to add link: %s", err)
+	}
+	if err := l.SetHeaders("docs", map[string]string{"X-Internal": "secret"}); err != nil {
+		t.Fatalf("unable to update link: %s", err)
+	}
+	h := l.Handler()
+	v := [...]struct {
+		name, remote, user string
+		status             int
+	}{
+		{"trusted proxy", "10.0.0.1:1234", "alice", http.StatusOK},
+		{"trusted proxy without user", "10.0.0.1:1234", "", http.StatusUnauthorized},
+		{"forged user header", "192.0.2.1:1234", "alice", http.StatusForbidden},
+	}
+	for _, c := range v {
+		t.Run(c.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/search?q=docs", nil)
+			if r.RemoteAddr = c.remote; len(c.user) > 0 {
+				r.Header.Set("X-User", c.user)
+			}
+			r.Header.Set("Accept", "application/json")
+			r.Header.Set("User-Agent", "Mozilla/5.0")
+			w := httptest.NewRecorder()
+			if h.ServeHTTP(w, r); w.Code != c.status {
+				t.Fatalf("status is %d, expected %d", w.Code, c.status)
+			}
+			if c.status != http.StatusOK {
+				return
+			}
+			var o []map[string]interface{}
+			if err := json.Unmarshal(w.Body.Bytes(), &o); err != nil {
+				t.Fatalf("unable to read results: %s", err)
+			}
+			if len(o) != 1 || o[0]["name"] != "docs" || o[0]["url"] != "https://example.com/docs" {
+				t.Fatalf("results are %v, expected the docs link", o)
+			}
+			if _, ok := o[0]["headers"]; ok {
+				t.Fatal("results include the link headers")
+			}
+		})
+	}
+}
+func TestPopularPage(t *testing.T) {
+	l := newTest(t, openMemory(), `{"proxies": ["10.0.0.0/8"], "popular": {"path": "/popular", "header": "X-User"}}`)
+	if err := l.Add("docs", "https://example.com/docs"); err != nil {
+		t.Fatalf("unable to add link: %s", err)
+	}
+	if err := l.SetHeaders("docs", map[string]string{"X-Internal": "secret"}); err != nil {
+		t.Fatalf("unable to update link: %s", err)
+	}
+	h := l.Handler()
+	v := [...]struct {
+		name, remote, user string
+		status             int
+	}{
+		{"trusted proxy", "10.0.0.1:1234", "alice", http.StatusOK},
+		{"trusted proxy without user", "10.0.0.1:1234", "", http.StatusUnauthorized},
+		{"forged user header", "192.0.2.1:1234", "alice", http.StatusForbidden},
+	}
+	for _, c := range v {
+		t.Run(c.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/popular?days=0", nil)
+			if r.RemoteAddr = c.remote; len(c.user) > 0 {
+				r.Header.Set("X-User", c.user)
+			}
+			r.Header.Set("Accept", "application/json")
+			r.Header.Set("User-Agent", "Mozilla/5.0")
+			w := httptest.NewRecorder()
+			if h.ServeHTTP(w, r); w.Code != c.status {
+				t.Fatalf("status is %d, expected %d", w.Code, c.status)
+			}
+			if c.status != http.StatusOK {
+				return
+			}
+			if b := w.Body.String(); b != `[{"name":"docs","url":"https://example.com/docs","hits":0}]` {
+				t.Fatalf("results are %s, expected only the public fields of the docs link", b)
+			}
+		})
+	}
+}
+func TestTimeouts(t *testing.T) {
+	v := [...]struct {
+		name, config         string
+		header, write, check time.Duration
+		fail                 bool
+	}{
+		{"defaults", `{}`, 5 * time.Second, 5 * time.Second, 2 * time.Second, false},
+		{"short read", `{"timeout": {"read": "2s"}}`, 2 * time.Second, 5 * time.Second, 2 * time.Second, false},
+		{"header set", `{"timeout": {"read": "2s", "header": "1s"}}`, time.Second, 5 * time.Second, 2 * time.Second, false},
+		{"long handler", `{"timeout": {"handler": "10s"}}`, 5 * time.Second, 15 * time.Second, 2 * time.Second, false},
+		{"short handler", `{"timeout": {"handler": "1s"}}`, 5 * time.Second, 5 * time.Second, time.Second, false},
+		{"zero header", `{"timeout": {"read": "2s", "header": 0}}`, 2 * time.Second, 5 * time.Second, 2 * time.Second, false},
+		{"single value", `{"timeout": "2s"}`, 2 * time.Second, 2 * time.Second, 2 * time.Second, false},
+		{"header longer than read", `{"timeout": {"read": "2s", "header": "3s"}}`, 0, 0, 0, true},
+		{"handler longer than write", `{"timeout": {"write": "5s", "handler": "10s"}}`, 0, 0, 0, true},
+		{"lookup longer than handler", `{"timeout": {"lookup": "3s", "handler": "1s"}}`, 0, 0, 0, true},
+		{"too long", `{"timeout": {"idle": "2h"}}`, 0, 0, 0, true},
+	}
+	for _, c := range v {
+		t.Run(c.name, func(t *testing.T) {
+			x := testConfig(t, c.config)
+			err := x.Timeout.check()
+			if c.fail {
+				if err == nil {
+					t.Fatal("invalid timeouts were accepted")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("timeouts were rejected: %s", err)
+			}
+			if h := time.Duration(x.Timeout.Header); h != c.header {
+				t.Fatalf("header timeout is %s, expected %s", h, c.header)
+			}
+			if w := time.Duration(x.Timeout.Write); w != c.write {
+				t.Fatalf("write timeout is %s, expected %s", w, c.write)
+			}
+			if l := time.Duration(x.Timeout.Lookup); l != c.check {
+				t.Fatalf("lookup timeout is %s, expected %s", l, c.check)
+			}
+		})
+	}
+}
+func TestAlerts(t *testing.T) {
+	x := testConfig(t, `{"stats": {"enabled": false}, "alerts": {"threshold": 2}}`)
+	if err := new(Linker).setup(x, openMemory()); err == nil {
+		t.Fatal("alerts were accepted with stats disabled")
+	}
+	l := newTest(t, openMemory(), `{"default": "https://example.com/none", "alerts": {"threshold": 2, "disable": true}}`)
+	if err := l.Add("foo", "https://example.com/foo"); err != nil {
+		t.Fatalf("unable to add link: %s", err)
+	}
+	h := l.Handler()
+	get := func() string {
+		r := httptest.NewRequest(http.MethodGet, "/foo", nil)
+		r.Header.Set("User-Agent", "Mozilla/5.0")
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		return w.Header().Get("Location")
+	}
+	get()
+	get()
+	if err := l.flush(context.Background()); err != nil {
+		t.Fatalf("unable to save hits: %s", err)
+	}
+	if v := l.Blocked(); len(v) != 1 || v[0] != "foo" {
+		t.Fatalf("blocked names are %v, expected [foo]", v)
+	}
+	if u := get(); u != "https://example.com/none" {
+		t.Fatalf("disabled name redirected to %q", u)
+	}
+	if !l.Unblock("foo") || l.Unblock("foo") {
+		t.Fatal("unable to unblock the disabled name once")
+	}
+	if u := get(); u != "https://example.com/foo" {
+		t.Fatalf("unblocked name redirected to %q", u)
+	}
+	for i := 0; i < 20 && len(l.alerts.average) > 0; i++ {
+		l.alerts.check(nil)
+	}
+	if len(l.alerts.average) > 0 {
+		t.Fatal("the average of an idle name was not removed")
+	}
+}
+func TestBotsPreview(t *testing.T) {
+	d := &memory{links: map[string]record{
+		"foo": {url: "https://example.com/foo", meta: &Meta{Title: "Foo"}},
+	}}
+	h := newTest(t, d, `{"bots": {"filter": true}}`).Handler()
+	v := [...]struct {
+		name, agent string
+		status      int
+	}{
+		{"browser", "Mozilla/5.0", http.StatusTemporaryRedirect},
+		{"preview crawler", "facebookexternalhit/1.1", http.StatusOK},
+		{"other bot", "curl/8.0", http.StatusNotFound},
+	}
+	for _, c := range v {
+		t.Run(c.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/foo", nil)
+			r.Header.Set("User-Agent", c.agent)
+			w := httptest.NewRecorder()
+			if h.ServeHTTP(w, r); w.Code != c.status {
+				t.Fatalf("status is %d, expected %d", w.Code, c.status)
+			}
+		})
+	}
+}
+func TestFlush(t *testing.T) {
+	d := &flaky{memoryDB: openMemory(), err: errors.New("database is down")}
+	l := newTest(t, d, `{"stats": {"enabled": true, "uniques": true}}`)
+	if err := l.Add("foo", "https://example.com/foo"); err != nil {
+		t.Fatalf("unable to add link: %s", err)
+	}
+	n := today()
+	y := n.AddDate(0, 0, -1)
+	// Hits counted before midnight are in the previous day bucket when the next hit is counted.
+	l.stats.date, l.stats.hits["foo"], l.stats.visits["foo"] = y, 3, 2
+	r := httptest.NewRequest(http.MethodGet, "/foo", nil)
+	l.stats.add("foo", "192.0.2.1", r)
+	l.stats.add("foo", "192.0.2.1", r)
+	if err := l.flush(context.Background()); err == nil {
+		t.Fatal("flush did not fail")
+	}
+	if len(l.stats.past) != 1 || l.stats.past[0].visits["foo"] != 2 || l.stats.visits["foo"] != 1 {
+		t.Fatalf("unique counts were not restored: %v %v", l.stats.past, l.stats.visits)
+	}
+	d.err = nil
+	if err := l.flush(context.Background()); err != nil {
+		t.Fatalf("unable to save hits: %s", err)
+	}
+	v, err := d.visits(context.Background(), "foo", y)
+	if err != nil {
+		t.Fatalf("unable to read visits: %s", err)
+	}
+	e := []Day{{Date: n, Hits: 2, Uniques: 1}, {Date: y, Hits: 3, Uniques: 2}}
+	if len(v) != len(e) || v[0] != e[0] || v[1] != e[1] {
+		t.Fatalf("visits are %v, expected %v", v, e)
+	}
+}
+func TestEncryption(t *testing.T) {
+	d := openMemory()
+	l := newTest(t, d, `{"encryption": {"key": "AAECAwQFBgcICQoLDA0ODxAREhMUFRYXGBkaGxwdHh8="}}`)
+	if err := l.Add("foo", "https://example.com/foo"); err != nil {
+		t.Fatalf("unable to add link: %s", err)
+	}
+	if err := l.SetApp("foo", "myapp://foo"); err != nil {
+		t.Fatalf("unable to set app URL: %s", err)
+	}
+	w := []Schedule{{Start: "00:00", End: "00:00", URL: "https://example.com/always"}}
+	if err := l.SetSchedule("foo", w); err != nil {
+		t.Fatalf("unable to set schedule: %s", err)
+	}
+	e := d.links["foo"]
+	for _, v := range [...]string{e.URL, e.App, e.Schedule[0].URL} {
+		if !strings.HasPrefix(v, sealPrefix) {
+			t.Fatalf("value %q is stored as plain text", v)
+		}
+	}
+	r, err := l.db.get(context.Background(), "foo")
+	if err != nil {
+		t.Fatalf("unable to get link: %s", err)
+	}
+	if r.url != "https://example.com/foo" || r.app != "myapp://foo" || r.sched[0].url != "https://example.com/always" {
+		t.Fatalf("decrypted record has %q, %q and %q", r.url, r.app, r.sched[0].url)
+	}
+	if v, err := l.Search("example.com/foo", 10); err != nil || len(v) != 1 || v[0].App != "myapp://foo" {
+		t.Fatalf("search returned %v, %v", v, err)
+	}
+	d.links["bar"] = boltLink{URL: "https://example.com/bar", App: "myapp://bar", Schedule: w, ID: 2}
+	if n, err := l.Encrypt(); err != nil || n != 3 {
+		t.Fatalf("Encrypt changed %d values (%v), expected 3", n, err)
+	}
+	if e = d.links["bar"]; !strings.HasPrefix(e.App, sealPrefix) || !strings.HasPrefix(e.Schedule[0].URL, sealPrefix) {
+		t.Fatal("Encrypt did not encrypt the app and schedule URLs")
+	}
+}
+func TestCache(t *testing.T) {
+	c := cache{entries: make(map[string]entry), limit: 2}
+	c.set("a", record{url: "https://example.com/a"}, time.Minute)
+	c.set("b", record{url: "https://example.com/b"}, time.Hour)
+	c.set("c", record{url: "https://example.com/c"}, time.Hour)
+	if _, ok := c.get("c"); !ok {
+		t.Fatal("new name was not cached when the cache was full")
+	}
+	if _, ok := c.get("a"); ok {
+		t.Fatal("the name closest to expiring was not replaced")
+	}
+	c.set("b", record{url: "https://example.com/d"}, time.Hour)
+	if r, ok := c.get("b"); !ok || r.url != "https://example.com/d" || len(c.entries) != 2 {
+		t.Fatalf("cached name was not updated in a full cache: %v (%d entries)", r.url, len(c.entries))
+	}
+}
+func TestStatsPrivacy(t *testing.T) {
+	d := openMemory()
+	l := newTest(t, d, `{"stats": {"enabled": true, "uniques": true, "dnt": true, "retention": "48h"}}`)
+	if err := l.Add("foo", "https://example.com/foo"); err != nil {
+		t.Fatalf("unable to add link: %s", err)
+	}
+	r := httptest.NewRequest(http.MethodGet, "/foo", nil)
+	r.Header.Set("Sec-GPC", "1")
+	l.stats.add("foo", "192.0.2.1", r)
+	if l.stats.hits["foo"] != 1 || l.stats.visits["foo"] != 0 {
+		t.Fatalf("opted out request was counted as %d hits and %d visitors", l.stats.hits["foo"], l.stats.visits["foo"])
+	}
+	n := today()
+	if err := d.daily(context.Background(), n.AddDate(0, 0, -3), map[string]uint64{"foo": 5}, nil); err != nil {
+		t.Fatalf("unable to save daily hits: %s", err)
+	}
+	if err := l.flush(context.Background()); err != nil {
+		t.Fatalf("unable to save hits: %s", err)
+	}
+	if err := l.db.purge(context.Background(), n.Add(-l.stats.retain)); err != nil {
+		t.Fatalf("unable to purge daily hits: %s", err)
+	}
+	v, err := d.visits(context.Background(), "foo", n.AddDate(0, 0, -7))
+	if err != nil || len(v) != 1 || !v[0].Date.Equal(n) {
+		t.Fatalf("visits after purge are %v (%v), expected only today", v, err)
+	}
+	x := testConfig(t, `{"stats": {"retention": "1h"}}`)
+	if err := new(Linker).setup(x, openMemory()); err == nil {
+		t.Fatal("retention shorter than a day was accepted")
+	}
+}
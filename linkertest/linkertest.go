@@ -0,0 +1,95 @@
+// linkertest.go
+// URL Shortener with MySQL database.
+//
+// Copyright (C) 2020 iDigitalFlame
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+//
+
+// Package linkertest provides a Linker test server for integration tests of projects that use Linker.
+package linkertest
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/iDigitalFlame/linker"
+)
+
+// DefaultURL is the default URL of every Server, which requests for missing names are redirected to.
+const DefaultURL = "https://example.com/missing"
+
+// Server is a struct that contains a Linker instance using a memory database and an HTTP test server running its
+// redirect handler. The Linker can be used to add or change mappings while the test runs.
+type Server struct {
+	*httptest.Server
+	Linker *linker.Linker
+}
+
+// NewServer will create and start a Server with a new empty memory database, with the supplied redirects added to
+// it. The test fails if the Server cannot be started. The Server is closed when the test and its subtests are done.
+func NewServer(t testing.TB, v ...linker.Link) *Server {
+	t.Helper()
+	c, err := json.Marshal(map[string]interface{}{
+		"default": DefaultURL,
+		"stats":   map[string]interface{}{"enabled": true, "bots": true},
+		"db":      map[string]string{"driver": "memory"},
+	})
+	p := filepath.Join(t.TempDir(), "linker.conf")
+	if err == nil {
+		err = ioutil.WriteFile(p, c, 0600)
+	}
+	if err != nil {
+		t.Fatalf("linkertest: unable to write configuration: %s", err)
+	}
+	l, err := linker.New(p)
+	if err != nil {
+		t.Fatalf("linkertest: unable to create Linker: %s", err)
+	}
+	if len(v) > 0 {
+		if _, err = l.Import(v); err != nil {
+			l.Close()
+			t.Fatalf("linkertest: unable to add redirects: %s", err)
+		}
+	}
+	s := &Server{Server: httptest.NewServer(l.Handler()), Linker: l}
+	t.Cleanup(s.Close)
+	return s
+}
+
+// Close will stop the Server and close the Linker instance. It is called when the test is done, but it can be
+// called before that to stop the Server early.
+func (s *Server) Close() {
+	s.Server.Close()
+	s.Linker.Close()
+}
+
+// Get will request the supplied path (such as "/name") from the Server without following redirects, so the
+// redirect status and "Location" header can be checked. The test fails if the request fails.
+func (s *Server) Get(t testing.TB, p string) *http.Response {
+	t.Helper()
+	c := *s.Client()
+	c.CheckRedirect = func(_ *http.Request, _ []*http.Request) error {
+		return http.ErrUseLastResponse
+	}
+	r, err := c.Get(s.URL + p)
+	if err != nil {
+		t.Fatalf("linkertest: unable to request %q: %s", p, err)
+	}
+	return r
+}
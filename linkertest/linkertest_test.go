@@ -0,0 +1,55 @@
+// linkertest_test.go
+// URL Shortener with MySQL database.
+//
+// Copyright (C) 2020 iDigitalFlame
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+//
+
+package linkertest
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/iDigitalFlame/linker"
+)
+
+func TestServer(t *testing.T) {
+	s := NewServer(t, linker.Link{Name: "foo", URL: "https://example.com/foo"})
+	v := [...]struct {
+		path, location string
+	}{
+		{"/foo", "https://example.com/foo"},
+		{"/foo/bar", "https://example.com/foo/bar"},
+		{"/missing", DefaultURL},
+	}
+	for _, c := range v {
+		r := s.Get(t, c.path)
+		if r.Body.Close(); r.StatusCode != http.StatusTemporaryRedirect {
+			t.Fatalf("status of %q is %d, expected %d", c.path, r.StatusCode, http.StatusTemporaryRedirect)
+		}
+		if l := r.Header.Get("Location"); l != c.location {
+			t.Fatalf("location of %q is %q, expected %q", c.path, l, c.location)
+		}
+	}
+	if err := s.Linker.Add("bar", "https://example.com/bar"); err != nil {
+		t.Fatalf("unable to add link: %s", err)
+	}
+	r := s.Get(t, "/bar")
+	if r.Body.Close(); r.Header.Get("Location") != "https://example.com/bar" {
+		t.Fatalf("location of %q is %q, expected %q", "/bar", r.Header.Get("Location"), "https://example.com/bar")
+	}
+	s.Close()
+}
@@ -0,0 +1,109 @@
+// listen.go
+// URL Shortener with MySQL database.
+//
+// Copyright (C) 2020 iDigitalFlame
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+//
+
+package linker
+
+import (
+	"context"
+	"net"
+	"strconv"
+	"strings"
+)
+
+func bind(s string, t bool) (string, error) {
+	if len(s) == 0 {
+		s = "0.0.0.0"
+	}
+	h, p, err := net.SplitHostPort(s)
+	if err != nil {
+		switch {
+		case s == "::" || (len(s) > 2 && s[0] == '[' && s[len(s)-1] == ']' && net.ParseIP(s[1:len(s)-1]) != nil):
+			h = strings.Trim(s, "[]")
+		case strings.Count(s, ":") > 1:
+			return "", &errval{
+				s: `listen address "` + s + `" is not valid, IPv6 addresses must be in brackets (such as "[::1]:443")`,
+			}
+		case strings.IndexByte(s, ':') < 0:
+			h = s
+		default:
+			return "", &errval{s: `invalid listen address "` + s + `"`, e: err}
+		}
+		if p = "80"; t {
+			p = "443"
+		}
+	}
+	if len(p) == 0 {
+		return "", &errval{s: `listen address "` + s + `" is missing a port`}
+	}
+	if n, err := strconv.ParseUint(p, 10, 16); err != nil {
+		if _, err = net.LookupPort("tcp", p); err != nil {
+			return "", &errval{s: `listen address "` + s + `" has an invalid port "` + p + `"`}
+		}
+	} else if n > 65535 {
+		return "", &errval{s: `listen address "` + s + `" has an invalid port "` + p + `"`}
+	}
+	if len(h) > 0 && net.ParseIP(h) == nil {
+		if i := strings.IndexByte(h, '%'); i > 0 && net.ParseIP(h[:i]) != nil {
+			return net.JoinHostPort(h, p), nil
+		}
+		if !hostname(h) {
+			return "", &errval{s: `listen address "` + s + `" has an invalid host "` + h + `"`}
+		}
+	}
+	return net.JoinHostPort(h, p), nil
+}
+func hostname(s string) bool {
+	if s = strings.TrimSuffix(s, "."); len(s) == 0 || len(s) > 253 {
+		return false
+	}
+	for _, v := range strings.Split(s, ".") {
+		if len(v) == 0 || len(v) > 63 || v[0] == '-' || v[len(v)-1] == '-' {
+			return false
+		}
+		for i := 0; i < len(v); i++ {
+			switch c := v[i]; {
+			case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9', c == '-':
+			default:
+				return false
+			}
+		}
+	}
+	return true
+}
+func resolve(s string) (string, error) {
+	h, p, err := net.SplitHostPort(s)
+	if err != nil || len(h) == 0 || net.ParseIP(h) != nil || strings.IndexByte(h, '%') > 0 {
+		return s, err
+	}
+	x, f := context.WithTimeout(context.Background(), defaultTimeout)
+	v, err := net.DefaultResolver.LookupIPAddr(x, h)
+	if f(); err != nil {
+		return "", &errval{s: `unable to resolve listen host "` + h + `"`, e: err}
+	}
+	// Use the first IPv4 address when the name has several addresses, so the address that is bound is predictable.
+	for i := range v {
+		if v[i].IP.To4() != nil {
+			return net.JoinHostPort(v[i].IP.String(), p), nil
+		}
+	}
+	if len(v) == 0 {
+		return "", &errval{s: `listen host "` + h + `" does not have any addresses`}
+	}
+	return net.JoinHostPort(v[0].String(), p), nil
+}
@@ -0,0 +1,422 @@
+// memory.go
+// URL Shortener with MySQL database.
+//
+// Copyright (C) 2020 iDigitalFlame
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+//
+
+package linker
+
+import (
+	"context"
+	"database/sql"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// memoryDB is a store that keeps every mapping, history entry and daily hit count in memory. Nothing is saved, so
+// it is only useful for tests and short lived instances that are filled by an import when started.
+type memoryDB struct {
+	lock     sync.RWMutex
+	links    map[string]boltLink
+	days     map[string]map[string][2]uint64
+	versions map[string][]Version
+	removed  map[string]boltDeleted
+	id, ver  uint64
+}
+
+func openMemory() *memoryDB {
+	return &memoryDB{
+		links:    make(map[string]boltLink),
+		days:     make(map[string]map[string][2]uint64),
+		versions: make(map[string][]Version),
+		removed:  make(map[string]boltDeleted),
+	}
+}
+func (*memoryDB) close() error {
+	return nil
+}
+func (m *memoryDB) add(n, u string) error {
+	return m.claim(n, u, "", 0)
+}
+func (m *memoryDB) claim(n, u, o string, q int) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	if _, ok := m.links[n]; ok {
+		return &errval{s: `name "` + n + `" already exists`}
+	}
+	if q > 0 {
+		var (
+			c int
+			f = filter{owner: o}
+		)
+		for k, e := range m.links {
+			if f.match(e.link(k)) {
+				c++
+			}
+		}
+		if c >= q {
+			return errQuota
+		}
+	}
+	m.id++
+	c := time.Now()
+	m.links[n] = boltLink{URL: u, Owner: o, ID: m.id, Created: &c}
+	return nil
+}
+func (m *memoryDB) list() ([]Link, error) {
+	m.lock.RLock()
+	v := make([]Link, 0, len(m.links))
+	for n, e := range m.links {
+		v = append(v, e.link(n))
+	}
+	m.lock.RUnlock()
+	sort.Slice(v, func(i, j int) bool { return v[i].Name < v[j].Name })
+	return v, nil
+}
+func (m *memoryDB) filter(_ context.Context, f filter) ([]Link, error) {
+	v, _ := m.list()
+	return f.apply(v), nil
+}
+func (m *memoryDB) delete(n string) error {
+	m.lock.Lock()
+	if e, ok := m.links[n]; ok {
+		m.removed[n] = boltDeleted{Date: time.Now().UTC(), Owner: e.Owner}
+	}
+	delete(m.links, n)
+	delete(m.versions, n)
+	delete(m.days, n)
+	m.lock.Unlock()
+	return nil
+}
+func (m *memoryDB) deleted(_ context.Context, n string) (time.Time, string, error) {
+	m.lock.RLock()
+	e, ok := m.removed[n]
+	if m.lock.RUnlock(); !ok {
+		return time.Time{}, "", sql.ErrNoRows
+	}
+	return e.Date, e.Owner, nil
+}
+func (m *memoryDB) update(n, u string) error {
+	m.lock.Lock()
+	err := m.replace(n, u)
+	m.lock.Unlock()
+	return err
+}
+func (m *memoryDB) replace(n, u string) error {
+	e, ok := m.links[n]
+	if !ok {
+		return &errval{s: `name "` + n + `" does not exist`}
+	}
+	m.ver++
+	m.versions[n] = append(m.versions[n], Version{ID: m.ver, URL: e.URL, Time: time.Now()})
+	e.URL = u
+	m.links[n] = e
+	return nil
+}
+func (m *memoryDB) set(n string, f func(*boltLink)) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	e, ok := m.links[n]
+	if !ok {
+		return &errval{s: `name "` + n + `" does not exist`}
+	}
+	f(&e)
+	m.links[n] = e
+	return nil
+}
+func (m *memoryDB) history(n string) ([]Version, error) {
+	m.lock.RLock()
+	h := m.versions[n]
+	v := make([]Version, len(h))
+	for i := range h {
+		v[len(h)-1-i] = h[i]
+	}
+	m.lock.RUnlock()
+	return v, nil
+}
+func (m *memoryDB) rollback(n string, v uint64) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	for _, h := range m.versions[n] {
+		if h.ID == v {
+			return m.replace(n, h.URL)
+		}
+	}
+	return &errval{s: `history ID "` + strconv.FormatUint(v, 10) + `" for name "` + n + `" does not exist`}
+}
+func (m *memoryDB) setAppend(n string, a *bool) error {
+	return m.set(n, func(e *boltLink) { e.Append = a })
+}
+func (m *memoryDB) setRefresh(n string, a *bool) error {
+	return m.set(n, func(e *boltLink) { e.Refresh = a })
+}
+func (m *memoryDB) setRollout(n string, r *Rollout) error {
+	return m.set(n, func(e *boltLink) { e.Rollout = r })
+}
+func (m *memoryDB) setApp(n, a string) error {
+	return m.set(n, func(e *boltLink) { e.App = a })
+}
+func (m *memoryDB) setMeta(n string, v *Meta) error {
+	return m.set(n, func(e *boltLink) { e.Meta = v })
+}
+func (m *memoryDB) setKey(n, v string) error {
+	return m.set(n, func(e *boltLink) { e.Key = v })
+}
+func (m *memoryDB) setReferrers(n string, v []string) error {
+	return m.set(n, func(e *boltLink) { e.Referrers = v })
+}
+func (m *memoryDB) setCountries(n string, v []string) error {
+	return m.set(n, func(e *boltLink) { e.Countries = v })
+}
+func (m *memoryDB) setSchedule(n string, v []Schedule) error {
+	return m.set(n, func(e *boltLink) { e.Schedule = v })
+}
+func (m *memoryDB) setHeaders(n string, v map[string]string) error {
+	return m.set(n, func(e *boltLink) { e.Headers = v })
+}
+func (m *memoryDB) setOwner(n, v string) error {
+	return m.set(n, func(e *boltLink) { e.Owner = v })
+}
+func (m *memoryDB) ordered() ([]Link, []uint64) {
+	m.lock.RLock()
+	v, o := make([]Link, 0, len(m.links)), make([]uint64, 0, len(m.links))
+	for n, e := range m.links {
+		v, o = append(v, e.link(n)), append(o, e.ID)
+	}
+	m.lock.RUnlock()
+	return v, o
+}
+func (m *memoryDB) top(_ context.Context, n int) ([]Link, error) {
+	v, o := m.ordered()
+	if sort.Sort(byHits{v: v, o: o}); len(v) > n {
+		v = v[:n]
+	}
+	return v, nil
+}
+func (m *memoryDB) search(_ context.Context, q string, n int) ([]Link, error) {
+	v, _ := m.list()
+	return match(v, q, n), nil
+}
+func (m *memoryDB) recent(_ context.Context, n int) ([]Link, error) {
+	v, o := m.ordered()
+	if sort.Sort(byID{byHits{v: v, o: o}}); len(v) > n {
+		v = v[:n]
+	}
+	return v, nil
+}
+func (m *memoryDB) get(_ context.Context, n string) (record, error) {
+	m.lock.RLock()
+	e, ok := m.links[n]
+	if m.lock.RUnlock(); !ok {
+		return record{}, sql.ErrNoRows
+	}
+	return e.link(n).record(), nil
+}
+func (m *memoryDB) hits(_ context.Context, h map[string]uint64) error {
+	m.lock.Lock()
+	for n, c := range h {
+		if e, ok := m.links[n]; ok {
+			e.Hits += c
+			m.links[n] = e
+		}
+	}
+	m.lock.Unlock()
+	return nil
+}
+func (m *memoryDB) daily(_ context.Context, d time.Time, h, u map[string]uint64) error {
+	s := d.UTC().Format(dateFormat)
+	m.lock.Lock()
+	for n, c := range h {
+		if _, ok := m.links[n]; !ok {
+			continue
+		}
+		e := m.days[n]
+		if e == nil {
+			e = make(map[string][2]uint64)
+			m.days[n] = e
+		}
+		v := e[s]
+		v[0], v[1] = v[0]+c, v[1]+u[n]
+		e[s] = v
+	}
+	m.lock.Unlock()
+	return nil
+}
+func (m *memoryDB) visits(_ context.Context, n string, d time.Time) ([]Day, error) {
+	var (
+		v []Day
+		s = d.UTC().Format(dateFormat)
+	)
+	m.lock.RLock()
+	for k, c := range m.days[n] {
+		if k < s {
+			continue
+		}
+		if r, err := time.Parse(dateFormat, k); err == nil {
+			v = append(v, Day{Date: r, Hits: c[0], Uniques: c[1]})
+		}
+	}
+	m.lock.RUnlock()
+	sort.Slice(v, func(i, j int) bool { return v[i].Date.After(v[j].Date) })
+	return v, nil
+}
+func (m *memoryDB) usage(_ context.Context, f, t time.Time) ([]usage, error) {
+	var (
+		v    []usage
+		s, e = f.UTC().Format(dateFormat), t.UTC().Format(dateFormat)
+	)
+	m.lock.RLock()
+	for n, d := range m.days {
+		u := usage{name: n, url: m.links[n].URL}
+		for k, c := range d {
+			if k >= s && k <= e {
+				u.hits, u.uniques = u.hits+c[0], u.uniques+c[1]
+			}
+		}
+		if u.hits > 0 {
+			v = append(v, u)
+		}
+	}
+	m.lock.RUnlock()
+	return v, nil
+}
+func (m *memoryDB) rewrite(f func(string) (string, error)) (int, error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	var (
+		c int
+		e = make(map[string]boltLink, len(m.links))
+		h = make(map[string][]Version, len(m.versions))
+	)
+	for n, r := range m.links {
+		u, err := f(r.URL)
+		if err != nil {
+			return 0, wrap("unable to rewrite link values", err)
+		}
+		if u != r.URL {
+			r.URL = u
+			c++
+		}
+		if len(r.Key) > 0 {
+			if u, err = f(r.Key); err != nil {
+				return 0, wrap("unable to rewrite link values", err)
+			}
+			if u != r.Key {
+				r.Key = u
+				c++
+			}
+		}
+		if len(r.App) > 0 {
+			if u, err = f(r.App); err != nil {
+				return 0, wrap("unable to rewrite link values", err)
+			}
+			if u != r.App {
+				r.App = u
+				c++
+			}
+		}
+		if len(r.Schedule) > 0 {
+			s := encodeSchedule(r.Schedule).String
+			if u, err = rescheduled(f)(s); err != nil {
+				return 0, wrap("unable to rewrite link values", err)
+			}
+			if u != s {
+				r.Schedule = decodeSchedule(u)
+				c++
+			}
+		}
+		if r.Rollout != nil && len(r.Rollout.From) > 0 {
+			if u, err = f(r.Rollout.From); err != nil {
+				return 0, wrap("unable to rewrite link values", err)
+			}
+			if u != r.Rollout.From {
+				r.Rollout = &Rollout{Start: r.Rollout.Start, From: u, Ramp: r.Rollout.Ramp, Percent: r.Rollout.Percent}
+				c++
+			}
+		}
+		e[n] = r
+	}
+	for n, r := range m.versions {
+		v := make([]Version, len(r))
+		for i := range r {
+			u, err := f(r[i].URL)
+			if err != nil {
+				return 0, wrap("unable to rewrite link values", err)
+			}
+			if v[i] = r[i]; u != r[i].URL {
+				v[i].URL = u
+				c++
+			}
+		}
+		h[n] = v
+	}
+	m.links, m.versions = e, h
+	return c, nil
+}
+func (*memoryDB) verify(_ bool) ([]string, error) {
+	return nil, nil
+}
+func (*memoryDB) resize(_, _ int) error {
+	return nil
+}
+func (m *memoryDB) popular(_ context.Context, d time.Time, n int) ([]Link, error) {
+	var (
+		v []Link
+		s = d.UTC().Format(dateFormat)
+	)
+	m.lock.RLock()
+	for k, e := range m.days {
+		r := m.links[k].link(k)
+		r.Hits = 0
+		for i, c := range e {
+			if i >= s {
+				r.Hits += c[0]
+			}
+		}
+		if r.Hits > 0 {
+			v = append(v, r)
+		}
+	}
+	m.lock.RUnlock()
+	sort.Slice(v, func(i, j int) bool {
+		if v[i].Hits == v[j].Hits {
+			return v[i].Name < v[j].Name
+		}
+		return v[i].Hits > v[j].Hits
+	})
+	if len(v) > n {
+		v = v[:n]
+	}
+	return v, nil
+}
+func (m *memoryDB) purge(_ context.Context, d time.Time) error {
+	s := d.UTC().Format(dateFormat)
+	m.lock.Lock()
+	for n, e := range m.days {
+		for k := range e {
+			if k < s {
+				delete(e, k)
+			}
+		}
+		if len(e) == 0 {
+			delete(m.days, n)
+		}
+	}
+	m.lock.Unlock()
+	return nil
+}
@@ -0,0 +1,125 @@
+// meta.go
+// URL Shortener with MySQL database.
+//
+// Copyright (C) 2020 iDigitalFlame
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+//
+
+package linker
+
+import (
+	"database/sql"
+	"encoding/json"
+	"html"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+var socials = [...]string{
+	"facebookexternalhit", "facebot", "twitterbot", "linkedinbot", "slackbot", "discordbot", "whatsapp",
+	"telegrambot", "skypeuripreview", "pinterest", "redditbot", "embedly", "vkshare", "iframely", "mastodon",
+}
+
+// Meta is a struct that contains the OpenGraph title, description and image URL of a redirect. Social media
+// crawlers requesting a redirect with Meta get a page with this metadata instead of a redirect, so shared links
+// show a preview.
+type Meta struct {
+	Title       string `json:"title"`
+	Description string `json:"description,omitempty"`
+	Image       string `json:"image,omitempty"`
+}
+
+// SetMeta will change the OpenGraph metadata of the redirect with the supplied name. A nil value will remove the
+// metadata. This function will return an error if the change fails, the image URL is invalid or the name does
+// not exist.
+func (l *Linker) SetMeta(n string, m *Meta) error {
+	if l.db == nil {
+		return errNotConfigured
+	}
+	if !validName(n) {
+		return &errval{s: `name "` + n + `" contains invalid characters`}
+	}
+	if m != nil {
+		v := *m
+		if m = &v; len(m.Title) == 0 {
+			return &errval{s: "metadata title cannot be empty"}
+		}
+		if len(m.Image) > 0 {
+			u, err := url.Parse(m.Image)
+			if err != nil || (u.Scheme != "http" && u.Scheme != "https") || len(u.Host) == 0 {
+				return &errval{s: `invalid image URL "` + m.Image + `"`, e: err}
+			}
+			m.Image = u.String()
+		}
+	}
+	if err := l.db.setMeta(n, m); err != nil {
+		return err
+	}
+	l.cache.remove(n)
+	return nil
+}
+func (m *Meta) encode() sql.NullString {
+	if m == nil {
+		return sql.NullString{}
+	}
+	b, err := json.Marshal(m)
+	if err != nil {
+		return sql.NullString{}
+	}
+	return sql.NullString{String: string(b), Valid: true}
+}
+func social(r *http.Request) bool {
+	a := strings.ToLower(r.UserAgent())
+	for i := range socials {
+		if strings.Contains(a, socials[i]) {
+			return true
+		}
+	}
+	return false
+}
+func decodeMeta(s string) *Meta {
+	if len(s) == 0 {
+		return nil
+	}
+	var m Meta
+	if json.Unmarshal([]byte(s), &m) != nil || len(m.Title) == 0 {
+		return nil
+	}
+	return &m
+}
+func preview(w http.ResponseWriter, m *Meta, u string) {
+	var (
+		b strings.Builder
+		c = "summary"
+		t = html.EscapeString(m.Title)
+	)
+	u = html.EscapeString(u)
+	b.WriteString(`<!DOCTYPE html><html><head><meta charset="utf-8"><title>` + t + `</title>`)
+	b.WriteString(`<meta property="og:title" content="` + t + `"><meta property="og:url" content="` + u + `">`)
+	if len(m.Description) > 0 {
+		d := html.EscapeString(m.Description)
+		b.WriteString(`<meta name="description" content="` + d + `"><meta property="og:description" content="` + d + `">`)
+	}
+	if len(m.Image) > 0 {
+		c = "summary_large_image"
+		b.WriteString(`<meta property="og:image" content="` + html.EscapeString(m.Image) + `">`)
+	}
+	b.WriteString(`<meta name="twitter:card" content="` + c + `"><meta http-equiv="refresh" content="0;url=` + u + `">`)
+	b.WriteString(`</head><body><a href="` + u + `">` + t + `</a></body></html>`)
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(b.String()))
+}
@@ -0,0 +1,1021 @@
+// mysql.go
+// URL Shortener with MySQL database.
+//
+// Copyright (C) 2020 iDigitalFlame
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+//
+
+package linker
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"database/sql"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+const (
+	sqlGet    = `SELECT LinkURL, LinkAppend, LinkApp, LinkMeta, LinkKey, LinkReferrers, LinkSchedule, LinkHeaders, LinkRefresh, LinkRollout, LinkCountries FROM Links WHERE LinkName = ?`
+	sqlAdd    = `INSERT INTO Links(LinkName, LinkURL, LinkCreated) VALUES(?, ?, CURRENT_TIMESTAMP)`
+	sqlClaim  = `INSERT INTO Links(LinkName, LinkURL, LinkOwner, LinkCreated) VALUES(?, ?, ?, CURRENT_TIMESTAMP)`
+	sqlOwned  = `SELECT COUNT(*) FROM Links WHERE LinkOwner = ? FOR UPDATE`
+	sqlTop    = `SELECT LinkName, LinkURL, LinkAppend, LinkHits, LinkApp, LinkMeta, LinkKey, LinkReferrers, LinkSchedule, LinkHeaders, LinkRefresh, LinkRollout, LinkCountries, LinkOwner, LinkCreated FROM Links ORDER BY LinkHits DESC, LinkID DESC LIMIT ?`
+	sqlRecent = `SELECT LinkName, LinkURL, LinkAppend, LinkHits, LinkApp, LinkMeta, LinkKey, LinkReferrers, LinkSchedule, LinkHeaders, LinkRefresh, LinkRollout, LinkCountries, LinkOwner, LinkCreated FROM Links ORDER BY LinkID DESC LIMIT ?`
+	sqlList   = `SELECT LinkName, LinkURL, LinkAppend, LinkHits, LinkApp, LinkMeta, LinkKey, LinkReferrers, LinkSchedule, LinkHeaders, LinkRefresh, LinkRollout, LinkCountries, LinkOwner, LinkCreated FROM Links`
+	sqlHits   = `UPDATE Links SET LinkHits = LinkHits + ? WHERE LinkName = ?`
+	sqlDelete = `DELETE FROM Links WHERE LinkName = ?`
+	sqlAppend = `UPDATE Links SET LinkAppend = ? WHERE LinkName = ?`
+	sqlApp    = `UPDATE Links SET LinkApp = ? WHERE LinkName = ?`
+	sqlMeta   = `UPDATE Links SET LinkMeta = ? WHERE LinkName = ?`
+	sqlKey    = `UPDATE Links SET LinkKey = ? WHERE LinkName = ?`
+	sqlRefs   = `UPDATE Links SET LinkReferrers = ? WHERE LinkName = ?`
+	sqlGeo    = `UPDATE Links SET LinkCountries = ? WHERE LinkName = ?`
+	sqlWindow = `UPDATE Links SET LinkSchedule = ? WHERE LinkName = ?`
+	sqlReload = `UPDATE Links SET LinkRefresh = ? WHERE LinkName = ?`
+	sqlHeader = `UPDATE Links SET LinkHeaders = ? WHERE LinkName = ?`
+	sqlRoll   = `UPDATE Links SET LinkRollout = ? WHERE LinkName = ?`
+	sqlOwner  = `UPDATE Links SET LinkOwner = ? WHERE LinkName = ?`
+	sqlUpdate = `UPDATE Links SET LinkURL = ? WHERE LinkName = ?`
+	sqlSearch = `SELECT LinkName, LinkURL, LinkAppend, LinkHits, LinkApp, LinkMeta, LinkKey, LinkReferrers, LinkSchedule, LinkHeaders, LinkRefresh, LinkRollout, LinkCountries, LinkOwner, LinkCreated FROM Links
+		WHERE MATCH(LinkName, LinkURL, LinkMeta) AGAINST(? IN NATURAL LANGUAGE MODE) OR LinkName LIKE ?
+		ORDER BY MATCH(LinkName, LinkURL, LinkMeta) AGAINST(? IN NATURAL LANGUAGE MODE) DESC, LinkHits DESC LIMIT ?`
+	sqlIndex  = `SELECT COUNT(*) FROM information_schema.STATISTICS WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = ? AND INDEX_NAME = ?`
+	sqlColumn = `SELECT COUNT(*) FROM information_schema.COLUMNS WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = ? AND COLUMN_NAME = ?`
+	sqlTable  = `SELECT TABLE_COLLATION FROM information_schema.TABLES WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = ?`
+	sqlLayout = `SELECT DATA_TYPE, CHARACTER_MAXIMUM_LENGTH, COLLATION_NAME FROM information_schema.COLUMNS
+		WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = ? AND COLUMN_NAME = ?`
+	sqlPrepare = `CREATE TABLE IF NOT EXISTS Links (LinkID BIGINT(64) NOT NULL PRIMARY KEY AUTO_INCREMENT,
+		LinkName VARCHAR(64) NOT NULL UNIQUE, LinkURL VARCHAR(1024) NOT NULL, LinkAppend TINYINT(1) NULL DEFAULT NULL,
+		LinkHits BIGINT(64) UNSIGNED NOT NULL DEFAULT 0, LinkApp VARCHAR(1024) NULL DEFAULT NULL,
+		LinkMeta TEXT NULL, LinkKey VARCHAR(128) NULL DEFAULT NULL,
+		LinkReferrers TEXT NULL, LinkSchedule TEXT NULL, LinkHeaders TEXT NULL,
+		LinkRefresh TINYINT(1) NULL DEFAULT NULL, LinkRollout TEXT NULL, LinkOwner VARCHAR(255) NULL DEFAULT NULL,
+		LinkCreated TIMESTAMP NULL DEFAULT NULL, LinkCountries TEXT NULL, FULLTEXT INDEX LinkSearch (LinkName, LinkURL, LinkMeta))`
+	sqlPrepareHistory = `CREATE TABLE IF NOT EXISTS LinkHistory (HistoryID BIGINT(64) NOT NULL PRIMARY KEY AUTO_INCREMENT,
+		LinkName VARCHAR(64) NOT NULL, LinkURL VARCHAR(1024) NOT NULL,
+		HistoryDate TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP, INDEX(LinkName))`
+	sqlPrepareDaily = `CREATE TABLE IF NOT EXISTS LinkDaily (LinkName VARCHAR(64) NOT NULL, HitDate DATE NOT NULL,
+		Hits BIGINT(64) UNSIGNED NOT NULL DEFAULT 0, Uniques BIGINT(64) UNSIGNED NOT NULL DEFAULT 0,
+		PRIMARY KEY(LinkName, HitDate), INDEX(HitDate))`
+	sqlPrepareDeleted = `CREATE TABLE IF NOT EXISTS LinkDeleted (LinkName VARCHAR(64) NOT NULL PRIMARY KEY,
+		LinkOwner VARCHAR(255) NULL DEFAULT NULL, DeletedDate TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP)`
+
+	sqlHistoryGet    = `SELECT LinkURL FROM LinkHistory WHERE HistoryID = ? AND LinkName = ?`
+	sqlHistoryAdd    = `INSERT INTO LinkHistory(LinkName, LinkURL) SELECT LinkName, LinkURL FROM Links WHERE LinkName = ?`
+	sqlHistoryList   = `SELECT HistoryID, LinkURL, HistoryDate FROM LinkHistory WHERE LinkName = ? ORDER BY HistoryID DESC`
+	sqlHistoryDelete = `DELETE FROM LinkHistory WHERE LinkName = ?`
+
+	sqlDeletedAdd = `REPLACE INTO LinkDeleted(LinkName, LinkOwner) SELECT LinkName, LinkOwner FROM Links WHERE LinkName = ?`
+	sqlDeletedGet = `SELECT LinkOwner, DeletedDate FROM LinkDeleted WHERE LinkName = ?`
+
+	sqlDailyAdd = `INSERT INTO LinkDaily(LinkName, HitDate, Hits, Uniques) VALUES(?, ?, ?, ?)
+		ON DUPLICATE KEY UPDATE Hits = Hits + VALUES(Hits), Uniques = Uniques + VALUES(Uniques)`
+	sqlDailyList  = `SELECT HitDate, Hits, Uniques FROM LinkDaily WHERE LinkName = ? AND HitDate >= ? ORDER BY HitDate DESC`
+	sqlDailyUsage = `SELECT l.LinkName, l.LinkURL, SUM(d.Hits), SUM(d.Uniques) FROM LinkDaily d INNER JOIN Links l
+		ON l.LinkName = d.LinkName WHERE d.HitDate >= ? AND d.HitDate <= ? GROUP BY l.LinkID`
+	sqlDailyDelete  = `DELETE FROM LinkDaily WHERE LinkName = ?`
+	sqlDailyPurge   = `DELETE FROM LinkDaily WHERE HitDate < ?`
+	sqlDailyPopular = `SELECT l.LinkName, l.LinkURL, l.LinkAppend, SUM(d.Hits) AS c, l.LinkApp, l.LinkMeta, l.LinkKey,
+		l.LinkReferrers, l.LinkSchedule, l.LinkHeaders, l.LinkRefresh, l.LinkRollout, l.LinkCountries, l.LinkOwner, l.LinkCreated
+		FROM LinkDaily d INNER JOIN Links l ON l.LinkName = d.LinkName
+		WHERE d.HitDate >= ? GROUP BY l.LinkID ORDER BY c DESC LIMIT ?`
+)
+
+// columns is a list of table columns that have been added since the initial table layout. These columns are
+// added to existing tables when they are missing.
+var columns = [...][3]string{
+	{"Links", "LinkAppend", "TINYINT(1) NULL DEFAULT NULL"},
+	{"Links", "LinkHits", "BIGINT(64) UNSIGNED NOT NULL DEFAULT 0"},
+	{"Links", "LinkApp", "VARCHAR(1024) NULL DEFAULT NULL"},
+	{"Links", "LinkMeta", "TEXT NULL"},
+	{"Links", "LinkKey", "VARCHAR(128) NULL DEFAULT NULL"},
+	{"Links", "LinkReferrers", "TEXT NULL"},
+	{"Links", "LinkSchedule", "TEXT NULL"},
+	{"Links", "LinkOwner", "VARCHAR(255) NULL DEFAULT NULL"},
+	{"Links", "LinkCreated", "TIMESTAMP NULL DEFAULT NULL"},
+	{"Links", "LinkHeaders", "TEXT NULL"},
+	{"Links", "LinkRefresh", "TINYINT(1) NULL DEFAULT NULL"},
+	{"Links", "LinkRollout", "TEXT NULL"},
+	{"Links", "LinkCountries", "TEXT NULL"},
+	{"LinkDaily", "Uniques", "BIGINT(64) UNSIGNED NOT NULL DEFAULT 0"},
+}
+
+// indexes is a list of table indexes that have been added since the initial table layout. These indexes are
+// added to existing tables when they are missing.
+var indexes = [...][3]string{
+	{"Links", "LinkSearch", "FULLTEXT INDEX LinkSearch (LinkName, LinkURL, LinkMeta)"},
+}
+
+// keys is a list of the table indexes created with the initial table layout, which are checked along with the
+// added indexes.
+var keys = [...][3]string{
+	{"Links", "LinkName", "UNIQUE INDEX LinkName (LinkName)"},
+	{"LinkHistory", "LinkName", "INDEX LinkName (LinkName)"},
+	{"LinkDaily", "HitDate", "INDEX HitDate (HitDate)"},
+}
+
+type size struct {
+	table, column, def string
+	size               int64
+}
+type mysqlDB struct {
+	db        *sql.DB
+	sel       *sql.Stmt
+	name, url int64
+}
+
+func (m *mysqlDB) close() error {
+	if m.sel != nil {
+		if err := m.sel.Close(); err != nil {
+			m.db.Close()
+			return &errval{s: "unable to close get statement", e: err}
+		}
+	}
+	return m.db.Close()
+}
+func (m *mysqlDB) migrate() error {
+	for i := range columns {
+		var c int
+		if err := m.db.QueryRow(sqlColumn, columns[i][0], columns[i][1]).Scan(&c); err != nil {
+			return err
+		}
+		if c > 0 {
+			continue
+		}
+		if _, err := m.db.Exec("ALTER TABLE " + columns[i][0] + " ADD COLUMN " + columns[i][1] + " " + columns[i][2]); err != nil {
+			return err
+		}
+	}
+	for i := range indexes {
+		var c int
+		if err := m.db.QueryRow(sqlIndex, indexes[i][0], indexes[i][1]).Scan(&c); err != nil {
+			return err
+		}
+		if c > 0 {
+			continue
+		}
+		if _, err := m.db.Exec("ALTER TABLE " + indexes[i][0] + " ADD " + indexes[i][2]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+func (m *mysqlDB) resize(n, u int) error {
+	if m.name, m.url = int64(n), int64(u); m.name < defaultNameLimit {
+		m.name = defaultNameLimit
+	}
+	if m.url < defaultURLLimit {
+		m.url = defaultURLLimit
+	}
+	// Columns that are too small for the default limits are only changed by a check fix ("-y fix").
+	if m.name == defaultNameLimit && m.url == defaultURLLimit {
+		return nil
+	}
+	_, err := m.grow(true, nil, nil)
+	return err
+}
+
+// sizes returns the list of the table columns that must be at least the listed size to fit the name and URL
+// limits, with the column definition used to resize them. TEXT columns are always large enough, so URL columns
+// are changed to TEXT when longer URLs are allowed.
+func (m *mysqlDB) sizes() []size {
+	n, u, a := "VARCHAR("+strconv.FormatInt(m.name, 10)+") NOT NULL", "VARCHAR(1024) NOT NULL", "VARCHAR(1024) NULL DEFAULT NULL"
+	if m.url > defaultURLLimit {
+		u, a = "TEXT NOT NULL", "TEXT NULL"
+	}
+	return []size{
+		{"Links", "LinkName", n, m.name},
+		{"Links", "LinkURL", u, m.url},
+		{"Links", "LinkApp", a, m.url},
+		{"Links", "LinkKey", "VARCHAR(128) NULL DEFAULT NULL", 128},
+		{"LinkHistory", "LinkName", n, m.name},
+		{"LinkHistory", "LinkURL", u, m.url},
+		{"LinkDaily", "LinkName", n, m.name},
+		{"LinkDeleted", "LinkName", n, m.name},
+	}
+}
+func (m *mysqlDB) verify(f bool) ([]string, error) {
+	var (
+		v []string
+		t = make(map[string]bool, 4)
+	)
+	for _, n := range [...]string{"Links", "LinkHistory", "LinkDaily", "LinkDeleted"} {
+		var c sql.NullString
+		if err := m.db.QueryRow(sqlTable, n).Scan(&c); err != nil {
+			return nil, &errval{s: `unable to read the layout of table "` + n + `"`, e: err}
+		}
+		if !strings.HasPrefix(c.String, "utf8mb4") {
+			v, t[n] = append(v, `table "`+n+`" uses collation "`+c.String+`" instead of utf8mb4`), true
+		}
+	}
+	v, err := m.grow(f, v, t)
+	if err != nil {
+		return nil, err
+	}
+	if f {
+		for n := range t {
+			if _, err := m.db.Exec("ALTER TABLE " + n + " CONVERT TO CHARACTER SET utf8mb4 COLLATE utf8mb4_unicode_ci"); err != nil {
+				return nil, &errval{s: `unable to convert table "` + n + `" to utf8mb4`, e: err}
+			}
+		}
+	}
+	for i := range keys {
+		var c int
+		if err := m.db.QueryRow(sqlIndex, keys[i][0], keys[i][1]).Scan(&c); err != nil {
+			return nil, &errval{s: `unable to read the indexes of table "` + keys[i][0] + `"`, e: err}
+		}
+		if c > 0 {
+			continue
+		}
+		v = append(v, `index "`+keys[i][0]+"."+keys[i][1]+`" is missing`)
+		if f {
+			if _, err := m.db.Exec("ALTER TABLE " + keys[i][0] + " ADD " + keys[i][2]); err != nil {
+				return nil, &errval{s: `unable to add index "` + keys[i][0] + "." + keys[i][1] + `"`, e: err}
+			}
+		}
+	}
+	return v, nil
+}
+func (m *mysqlDB) grow(f bool, v []string, t map[string]bool) ([]string, error) {
+	for _, e := range m.sizes() {
+		var (
+			k string
+			z sql.NullInt64
+			c sql.NullString
+			n = e.table + "." + e.column
+		)
+		err := m.db.QueryRow(sqlLayout, e.table, e.column).Scan(&k, &z, &c)
+		if err == sql.ErrNoRows {
+			if v = append(v, `column "`+n+`" is missing`); f {
+				if _, err = m.db.Exec("ALTER TABLE " + e.table + " ADD COLUMN " + e.column + " " + e.def); err != nil {
+					return nil, &errval{s: `unable to add column "` + n + `"`, e: err}
+				}
+			}
+			continue
+		}
+		if err != nil {
+			return nil, &errval{s: `unable to read the layout of column "` + n + `"`, e: err}
+		}
+		if t != nil && c.Valid && !strings.HasPrefix(c.String, "utf8mb4") && !t[e.table] {
+			v, t[e.table] = append(v, `column "`+n+`" uses collation "`+c.String+`" instead of utf8mb4`), true
+		}
+		if k == "text" || k == "mediumtext" || k == "longtext" || z.Int64 >= e.size {
+			continue
+		}
+		v = append(v, `column "`+n+`" is `+k+"("+strconv.FormatInt(z.Int64, 10)+"), which is smaller than "+
+			strconv.FormatInt(e.size, 10))
+		if f {
+			if _, err = m.db.Exec("ALTER TABLE " + e.table + " MODIFY COLUMN " + e.column + " " + e.def); err != nil {
+				return nil, &errval{s: `unable to resize column "` + n + `"`, e: err}
+			}
+		}
+	}
+	return v, nil
+}
+func (m *mysqlDB) list() ([]Link, error) {
+	q, err := m.db.Prepare(sqlList)
+	if err != nil {
+		return nil, &errval{s: "unable to prepare query statement", e: err}
+	}
+	r, err := q.Query()
+	if err != nil {
+		q.Close()
+		return nil, &errval{s: "unable to execute query statement", e: err}
+	}
+	v, err := scanLinks(r)
+	if q.Close(); err != nil {
+		return nil, &errval{s: "unable to parse query statement results", e: err}
+	}
+	return v, nil
+}
+func (m *mysqlDB) add(n, u string) error {
+	q, err := m.db.Prepare(sqlAdd)
+	if err != nil {
+		return &errval{s: "unable to prepare add statement", e: err}
+	}
+	_, err = q.Exec(n, u)
+	if q.Close(); err != nil {
+		return &errval{s: "unable to execute add statement", e: err}
+	}
+	return nil
+}
+func (m *mysqlDB) claim(n, u, o string, q int) error {
+	t, err := m.db.Begin()
+	if err != nil {
+		return &errval{s: "unable to start claim transaction", e: err}
+	}
+	// The owned names are locked until the commit, so concurrent claims by the same owner can not both pass the
+	// quota check.
+	if q > 0 {
+		var c int
+		if err = t.QueryRow(sqlOwned, o).Scan(&c); err != nil {
+			t.Rollback()
+			return &errval{s: "unable to execute owned names statement", e: err}
+		}
+		if c >= q {
+			t.Rollback()
+			return errQuota
+		}
+	}
+	if _, err = t.Exec(sqlClaim, n, u, o); err != nil {
+		t.Rollback()
+		return &errval{s: "unable to execute claim statement", e: err}
+	}
+	if err = t.Commit(); err != nil {
+		return &errval{s: "unable to commit claim transaction", e: err}
+	}
+	return nil
+}
+func (m *mysqlDB) delete(n string) error {
+	t, err := m.db.Begin()
+	if err != nil {
+		return &errval{s: "unable to start delete transaction", e: err}
+	}
+	if _, err = t.Exec(sqlDeletedAdd, n); err != nil {
+		t.Rollback()
+		return &errval{s: "unable to execute deleted name statement", e: err}
+	}
+	if _, err = t.Exec(sqlDelete, n); err != nil {
+		t.Rollback()
+		return &errval{s: "unable to execute delete statement", e: err}
+	}
+	if _, err = t.Exec(sqlHistoryDelete, n); err != nil {
+		t.Rollback()
+		return &errval{s: "unable to execute history delete statement", e: err}
+	}
+	if _, err = t.Exec(sqlDailyDelete, n); err != nil {
+		t.Rollback()
+		return &errval{s: "unable to execute daily hits delete statement", e: err}
+	}
+	if err = t.Commit(); err != nil {
+		return &errval{s: "unable to commit delete transaction", e: err}
+	}
+	return nil
+}
+func (m *mysqlDB) deleted(x context.Context, n string) (time.Time, string, error) {
+	var (
+		t time.Time
+		o sql.NullString
+	)
+	if err := m.db.QueryRowContext(x, sqlDeletedGet, n).Scan(&o, &t); err != nil {
+		if err == sql.ErrNoRows {
+			return t, "", err
+		}
+		return t, "", &errval{s: "unable to execute deleted name statement", e: err}
+	}
+	return t, o.String, nil
+}
+func (m *mysqlDB) rewrite(f func(string) (string, error)) (int, error) {
+	t, err := m.db.Begin()
+	if err != nil {
+		return 0, &errval{s: "unable to start rewrite transaction", e: err}
+	}
+	var c int
+	v := [...]struct {
+		f       func(string) (string, error)
+		n, i, c string
+	}{
+		{f, "Links", "LinkID", "LinkURL"}, {f, "Links", "LinkID", "LinkKey"}, {f, "Links", "LinkID", "LinkApp"},
+		{f, "LinkHistory", "HistoryID", "LinkURL"}, {rolled(f), "Links", "LinkID", "LinkRollout"},
+		{rescheduled(f), "Links", "LinkID", "LinkSchedule"},
+	}
+	for i := range v {
+		n, err := rewriteTable(t, v[i].n, v[i].i, v[i].c, v[i].f)
+		if err != nil {
+			t.Rollback()
+			return 0, err
+		}
+		c += n
+	}
+	if err = t.Commit(); err != nil {
+		return 0, &errval{s: "unable to commit rewrite transaction", e: err}
+	}
+	return c, nil
+}
+func rewriteTable(t *sql.Tx, n, i, c string, f func(string) (string, error)) (int, error) {
+	r, err := t.Query("SELECT " + i + ", " + c + " FROM " + n + " WHERE " + c + " IS NOT NULL FOR UPDATE")
+	if err != nil {
+		return 0, &errval{s: "unable to execute rewrite select statement", e: err}
+	}
+	var (
+		d []uint64
+		v []string
+	)
+	for r.Next() {
+		var (
+			k uint64
+			u string
+		)
+		if err = r.Scan(&k, &u); err != nil {
+			break
+		}
+		if s, err := f(u); err != nil {
+			r.Close()
+			return 0, err
+		} else if s != u {
+			d, v = append(d, k), append(v, s)
+		}
+	}
+	if r.Close(); err != nil {
+		return 0, &errval{s: "unable to parse rewrite select statement results", e: err}
+	}
+	for x := range d {
+		if _, err = t.Exec("UPDATE "+n+" SET "+c+" = ? WHERE "+i+" = ?", v[x], d[x]); err != nil {
+			return 0, &errval{s: "unable to execute rewrite update statement", e: err}
+		}
+	}
+	return len(d), nil
+}
+func scanLinks(r *sql.Rows) ([]Link, error) {
+	var (
+		v                         []Link
+		a, x                      sql.NullBool
+		c                         sql.NullTime
+		p, m, k, f, w, h, o, g, y sql.NullString
+		err                       error
+	)
+	for r.Next() {
+		var e Link
+		if err = r.Scan(&e.Name, &e.URL, &a, &e.Hits, &p, &m, &k, &f, &w, &h, &x, &g, &y, &o, &c); err != nil {
+			break
+		}
+		e.App, e.Meta, e.Key, e.Countries = p.String, decodeMeta(m.String), k.String, split(y.String)
+		e.Referrers, e.Schedule, e.Owner = split(f.String), decodeSchedule(w.String), o.String
+		e.Headers, e.Rollout = decodeHeaders(h.String), decodeRollout(g.String)
+		if c.Valid {
+			t := c.Time
+			e.Created = &t
+		}
+		if a.Valid {
+			b := a.Bool
+			e.Append = &b
+		}
+		if x.Valid {
+			b := x.Bool
+			e.Refresh = &b
+		}
+		v = append(v, e)
+	}
+	if r.Close(); err != nil {
+		return nil, err
+	}
+	return v, r.Err()
+}
+func (m *mysqlDB) update(n, u string) error {
+	t, err := m.db.Begin()
+	if err != nil {
+		return &errval{s: "unable to start update transaction", e: err}
+	}
+	if err = historyUpdate(t, n, u); err != nil {
+		t.Rollback()
+		return err
+	}
+	if err = t.Commit(); err != nil {
+		return &errval{s: "unable to commit update transaction", e: err}
+	}
+	return nil
+}
+func historyUpdate(t *sql.Tx, n, u string) error {
+	r, err := t.Exec(sqlHistoryAdd, n)
+	if err != nil {
+		return &errval{s: "unable to execute history add statement", e: err}
+	}
+	if c, err := r.RowsAffected(); err == nil && c == 0 {
+		return &errval{s: `name "` + n + `" does not exist`}
+	}
+	if _, err = t.Exec(sqlUpdate, u, n); err != nil {
+		return &errval{s: "unable to execute update statement", e: err}
+	}
+	return nil
+}
+func (m *mysqlDB) setAppend(n string, a *bool) error {
+	var v sql.NullBool
+	if a != nil {
+		v.Valid, v.Bool = true, *a
+	}
+	q, err := m.db.Prepare(sqlAppend)
+	if err != nil {
+		return &errval{s: "unable to prepare append statement", e: err}
+	}
+	r, err := q.Exec(v, n)
+	if q.Close(); err != nil {
+		return &errval{s: "unable to execute append statement", e: err}
+	}
+	if c, err := r.RowsAffected(); err == nil && c == 0 {
+		return &errval{s: `name "` + n + `" does not exist`}
+	}
+	return nil
+}
+func (m *mysqlDB) setRefresh(n string, a *bool) error {
+	var v sql.NullBool
+	if a != nil {
+		v.Valid, v.Bool = true, *a
+	}
+	q, err := m.db.Prepare(sqlReload)
+	if err != nil {
+		return &errval{s: "unable to prepare refresh statement", e: err}
+	}
+	r, err := q.Exec(v, n)
+	if q.Close(); err != nil {
+		return &errval{s: "unable to execute refresh statement", e: err}
+	}
+	if c, err := r.RowsAffected(); err == nil && c == 0 {
+		return &errval{s: `name "` + n + `" does not exist`}
+	}
+	return nil
+}
+func (m *mysqlDB) setApp(n, a string) error {
+	v := sql.NullString{String: a, Valid: len(a) > 0}
+	q, err := m.db.Prepare(sqlApp)
+	if err != nil {
+		return &errval{s: "unable to prepare app statement", e: err}
+	}
+	r, err := q.Exec(v, n)
+	if q.Close(); err != nil {
+		return &errval{s: "unable to execute app statement", e: err}
+	}
+	if c, err := r.RowsAffected(); err == nil && c == 0 {
+		return &errval{s: `name "` + n + `" does not exist`}
+	}
+	return nil
+}
+func (m *mysqlDB) setMeta(n string, e *Meta) error {
+	q, err := m.db.Prepare(sqlMeta)
+	if err != nil {
+		return &errval{s: "unable to prepare meta statement", e: err}
+	}
+	r, err := q.Exec(e.encode(), n)
+	if q.Close(); err != nil {
+		return &errval{s: "unable to execute meta statement", e: err}
+	}
+	if c, err := r.RowsAffected(); err == nil && c == 0 {
+		return &errval{s: `name "` + n + `" does not exist`}
+	}
+	return nil
+}
+func (m *mysqlDB) setKey(n, k string) error {
+	q, err := m.db.Prepare(sqlKey)
+	if err != nil {
+		return &errval{s: "unable to prepare key statement", e: err}
+	}
+	r, err := q.Exec(sql.NullString{String: k, Valid: len(k) > 0}, n)
+	if q.Close(); err != nil {
+		return &errval{s: "unable to execute key statement", e: err}
+	}
+	if c, err := r.RowsAffected(); err == nil && c == 0 {
+		return &errval{s: `name "` + n + `" does not exist`}
+	}
+	return nil
+}
+func (m *mysqlDB) setReferrers(n string, v []string) error {
+	q, err := m.db.Prepare(sqlRefs)
+	if err != nil {
+		return &errval{s: "unable to prepare referrers statement", e: err}
+	}
+	r, err := q.Exec(sql.NullString{String: strings.Join(v, ","), Valid: len(v) > 0}, n)
+	if q.Close(); err != nil {
+		return &errval{s: "unable to execute referrers statement", e: err}
+	}
+	if c, err := r.RowsAffected(); err == nil && c == 0 {
+		return &errval{s: `name "` + n + `" does not exist`}
+	}
+	return nil
+}
+func (m *mysqlDB) setCountries(n string, v []string) error {
+	q, err := m.db.Prepare(sqlGeo)
+	if err != nil {
+		return &errval{s: "unable to prepare countries statement", e: err}
+	}
+	r, err := q.Exec(sql.NullString{String: strings.Join(v, ","), Valid: len(v) > 0}, n)
+	if q.Close(); err != nil {
+		return &errval{s: "unable to execute countries statement", e: err}
+	}
+	if c, err := r.RowsAffected(); err == nil && c == 0 {
+		return &errval{s: `name "` + n + `" does not exist`}
+	}
+	return nil
+}
+func (m *mysqlDB) setSchedule(n string, v []Schedule) error {
+	q, err := m.db.Prepare(sqlWindow)
+	if err != nil {
+		return &errval{s: "unable to prepare schedule statement", e: err}
+	}
+	r, err := q.Exec(encodeSchedule(v), n)
+	if q.Close(); err != nil {
+		return &errval{s: "unable to execute schedule statement", e: err}
+	}
+	if c, err := r.RowsAffected(); err == nil && c == 0 {
+		return &errval{s: `name "` + n + `" does not exist`}
+	}
+	return nil
+}
+func (m *mysqlDB) setHeaders(n string, v map[string]string) error {
+	q, err := m.db.Prepare(sqlHeader)
+	if err != nil {
+		return &errval{s: "unable to prepare headers statement", e: err}
+	}
+	r, err := q.Exec(encodeHeaders(v), n)
+	if q.Close(); err != nil {
+		return &errval{s: "unable to execute headers statement", e: err}
+	}
+	if c, err := r.RowsAffected(); err == nil && c == 0 {
+		return &errval{s: `name "` + n + `" does not exist`}
+	}
+	return nil
+}
+func (m *mysqlDB) setRollout(n string, v *Rollout) error {
+	q, err := m.db.Prepare(sqlRoll)
+	if err != nil {
+		return &errval{s: "unable to prepare rollout statement", e: err}
+	}
+	r, err := q.Exec(encodeRollout(v), n)
+	if q.Close(); err != nil {
+		return &errval{s: "unable to execute rollout statement", e: err}
+	}
+	if c, err := r.RowsAffected(); err == nil && c == 0 {
+		return &errval{s: `name "` + n + `" does not exist`}
+	}
+	return nil
+}
+func (m *mysqlDB) setOwner(n, v string) error {
+	q, err := m.db.Prepare(sqlOwner)
+	if err != nil {
+		return &errval{s: "unable to prepare owner statement", e: err}
+	}
+	r, err := q.Exec(sql.NullString{String: v, Valid: len(v) > 0}, n)
+	if q.Close(); err != nil {
+		return &errval{s: "unable to execute owner statement", e: err}
+	}
+	if c, err := r.RowsAffected(); err == nil && c == 0 {
+		return &errval{s: `name "` + n + `" does not exist`}
+	}
+	return nil
+}
+func (m *mysqlDB) rollback(n string, v uint64) error {
+	t, err := m.db.Begin()
+	if err != nil {
+		return &errval{s: "unable to start rollback transaction", e: err}
+	}
+	var u string
+	if err = t.QueryRow(sqlHistoryGet, v, n).Scan(&u); err != nil {
+		if t.Rollback(); err == sql.ErrNoRows {
+			return &errval{s: `history ID "` + strconv.FormatUint(v, 10) + `" for name "` + n + `" does not exist`}
+		}
+		return &errval{s: "unable to execute history get statement", e: err}
+	}
+	if err = historyUpdate(t, n, u); err != nil {
+		t.Rollback()
+		return err
+	}
+	if err = t.Commit(); err != nil {
+		return &errval{s: "unable to commit rollback transaction", e: err}
+	}
+	return nil
+}
+func (m *mysqlDB) history(n string) ([]Version, error) {
+	q, err := m.db.Prepare(sqlHistoryList)
+	if err != nil {
+		return nil, &errval{s: "unable to prepare history statement", e: err}
+	}
+	r, err := q.Query(n)
+	if err != nil {
+		q.Close()
+		return nil, &errval{s: "unable to execute history statement", e: err}
+	}
+	var v []Version
+	for r.Next() {
+		var e Version
+		if err = r.Scan(&e.ID, &e.URL, &e.Time); err != nil {
+			break
+		}
+		v = append(v, e)
+	}
+	r.Close()
+	if q.Close(); err != nil {
+		return nil, &errval{s: "unable to parse history statement results", e: err}
+	}
+	return v, nil
+}
+func openMySQL(d database) (*mysqlDB, error) {
+	c, err := d.config()
+	if err != nil {
+		return nil, err
+	}
+	x, err := mysql.NewConnector(c)
+	if err != nil {
+		return nil, &errval{s: "invalid MySQL database configuration", e: err}
+	}
+	var (
+		s  = `"` + c.DBName + `" on "` + c.Addr + `"`
+		db = sql.OpenDB(x)
+	)
+	if err = db.Ping(); err != nil {
+		db.Close()
+		return nil, &errval{s: "unable to connect to database " + s, e: err}
+	}
+	m, err := newMySQL(db, s)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return m, nil
+}
+func (d database) config() (*mysql.Config, error) {
+	s := d.DSN
+	if len(s) == 0 {
+		if len(d.Username) == 0 || len(d.Server) == 0 || len(d.Name) == 0 {
+			return nil, &errval{s: "invalid MySQL database configuration"}
+		}
+		if s = d.Server; s[0] == '/' {
+			s = "unix(" + s + ")"
+		}
+		s = d.Username + ":" + d.Password + "@" + s + "/" + d.Name
+	}
+	if len(d.Params) > 0 {
+		k := make([]string, 0, len(d.Params))
+		for n, v := range d.Params {
+			if len(n) == 0 || strings.ContainsAny(n, "&=?") || strings.ContainsRune(v, '&') {
+				return nil, &errval{s: `MySQL parameter "` + n + `" contains invalid characters`}
+			}
+			k = append(k, n)
+		}
+		sort.Strings(k)
+		for i := range k {
+			if strings.ContainsRune(s, '?') {
+				s += "&"
+			} else {
+				s += "?"
+			}
+			s += k[i] + "=" + d.Params[k[i]]
+		}
+	}
+	c, err := mysql.ParseDSN(s)
+	if err != nil {
+		return nil, &errval{s: "invalid MySQL database configuration", e: err}
+	}
+	if len(c.User) == 0 || len(c.DBName) == 0 {
+		return nil, &errval{s: "invalid MySQL database configuration, the username and database name are required"}
+	}
+	switch c.Net {
+	case "tcp", "tcp4", "tcp6":
+	case "unix":
+		if len(d.CA) > 0 || len(d.Cert) > 0 || len(d.Key) > 0 {
+			return nil, &errval{s: "the MySQL TLS options cannot be used with a Unix socket"}
+		}
+		if !filepath.IsAbs(c.Addr) {
+			return nil, &errval{s: `MySQL socket path "` + c.Addr + `" must be an absolute path`}
+		}
+		i, err := os.Stat(c.Addr)
+		if err != nil {
+			return nil, &errval{s: `unable to access MySQL socket "` + c.Addr + `"`, e: err}
+		}
+		if i.Mode()&os.ModeSocket == 0 {
+			return nil, &errval{s: `MySQL socket path "` + c.Addr + `" is not a Unix socket`}
+		}
+	default:
+		return nil, &errval{s: `unsupported MySQL network "` + c.Net + `"`}
+	}
+	c.ParseTime, c.ClientFoundRows = true, true
+	if len(d.CA) == 0 && len(d.Cert) == 0 && len(d.Key) == 0 {
+		return c, nil
+	}
+	t := &tls.Config{MinVersion: tls.VersionTLS12}
+	if h, _, err := net.SplitHostPort(c.Addr); err == nil && c.Net == "tcp" {
+		t.ServerName = h
+	}
+	if len(d.CA) > 0 {
+		b, err := ioutil.ReadFile(d.CA)
+		if err != nil {
+			return nil, &errval{s: `unable to read MySQL CA certificate "` + d.CA + `"`, e: err}
+		}
+		if t.RootCAs = x509.NewCertPool(); !t.RootCAs.AppendCertsFromPEM(b) {
+			return nil, &errval{s: `MySQL CA certificate "` + d.CA + `" does not contain any PEM certificates`}
+		}
+	}
+	if len(d.Cert) > 0 || len(d.Key) > 0 {
+		x, err := tls.LoadX509KeyPair(d.Cert, d.Key)
+		if err != nil {
+			return nil, &errval{s: "unable to load the MySQL client certificate", e: err}
+		}
+		t.Certificates = []tls.Certificate{x}
+	}
+	if err = mysql.RegisterTLSConfig("linker", t); err != nil {
+		return nil, &errval{s: "unable to register the MySQL TLS configuration", e: err}
+	}
+	c.TLSConfig = "linker"
+	return c, nil
+}
+func newMySQL(db *sql.DB, s string) (*mysqlDB, error) {
+	for _, v := range [...]string{sqlPrepare, sqlPrepareHistory, sqlPrepareDaily, sqlPrepareDeleted} {
+		n, err := db.Prepare(v)
+		if err != nil {
+			return nil, &errval{s: "unable to prepare the initial database tables in " + s, e: err}
+		}
+		_, err = n.Exec()
+		if n.Close(); err != nil {
+			return nil, &errval{s: "unable to create the initial database tables in " + s, e: err}
+		}
+	}
+	var (
+		m   = &mysqlDB{db: db, name: defaultNameLimit, url: defaultURLLimit}
+		err = m.migrate()
+	)
+	if err != nil {
+		return nil, &errval{s: "unable to update the database tables in " + s, e: err}
+	}
+	if m.sel, err = db.Prepare(sqlGet); err != nil {
+		return nil, &errval{s: "unable to prepare get statement", e: err}
+	}
+	return m, nil
+}
+func (m *mysqlDB) top(x context.Context, n int) ([]Link, error) {
+	r, err := m.db.QueryContext(x, sqlTop, n)
+	if err != nil {
+		return nil, &errval{s: "unable to execute top statement", e: err}
+	}
+	v, err := scanLinks(r)
+	if err != nil {
+		return nil, &errval{s: "unable to parse top statement results", e: err}
+	}
+	return v, nil
+}
+func (m *mysqlDB) search(x context.Context, q string, n int) ([]Link, error) {
+	p := escape.Replace(q) + "%"
+	r, err := m.db.QueryContext(x, sqlSearch, q, p, q, n)
+	if err != nil {
+		return nil, &errval{s: "unable to execute search statement", e: err}
+	}
+	v, err := scanLinks(r)
+	if err != nil {
+		return nil, &errval{s: "unable to parse search statement results", e: err}
+	}
+	return v, nil
+}
+func (m *mysqlDB) filter(x context.Context, f filter) ([]Link, error) {
+	q, a, err := f.query()
+	if err != nil {
+		return nil, err
+	}
+	r, err := m.db.QueryContext(x, q, a...)
+	if err != nil {
+		return nil, &errval{s: "unable to execute filter statement", e: err}
+	}
+	v, err := scanLinks(r)
+	if err != nil {
+		return nil, &errval{s: "unable to parse filter statement results", e: err}
+	}
+	return v, nil
+}
+func (m *mysqlDB) recent(x context.Context, n int) ([]Link, error) {
+	r, err := m.db.QueryContext(x, sqlRecent, n)
+	if err != nil {
+		return nil, &errval{s: "unable to execute recent statement", e: err}
+	}
+	v, err := scanLinks(r)
+	if err != nil {
+		return nil, &errval{s: "unable to parse recent statement results", e: err}
+	}
+	return v, nil
+}
+func (m *mysqlDB) get(x context.Context, n string) (record, error) {
+	var (
+		v                      record
+		p, e, k, f, w, h, g, y sql.NullString
+		err                    = m.sel.QueryRowContext(x, n).Scan(&v.url, &v.append, &p, &e, &k, &f, &w, &h, &v.refresh, &g, &y)
+	)
+	v.app, v.meta, v.key, v.refs, v.sched = p.String, decodeMeta(e.String), k.String, split(f.String), windows(decodeSchedule(w.String))
+	v.heads, v.roll, v.geo = decodeHeaders(h.String), decodeRollout(g.String), split(y.String)
+	return v, err
+}
+func (m *mysqlDB) hits(x context.Context, h map[string]uint64) error {
+	t, err := m.db.BeginTx(x, nil)
+	if err != nil {
+		return &errval{s: "unable to start hits transaction", e: err}
+	}
+	var q *sql.Stmt
+	if q, err = t.PrepareContext(x, sqlHits); err != nil {
+		t.Rollback()
+		return &errval{s: "unable to prepare hits statement", e: err}
+	}
+	for k, v := range h {
+		if _, err = q.ExecContext(x, v, k); err != nil {
+			break
+		}
+	}
+	if q.Close(); err != nil {
+		t.Rollback()
+		return &errval{s: "unable to execute hits statement", e: err}
+	}
+	if err = t.Commit(); err != nil {
+		return &errval{s: "unable to commit hits transaction", e: err}
+	}
+	return nil
+}
+func (m *mysqlDB) daily(x context.Context, d time.Time, h, u map[string]uint64) error {
+	t, err := m.db.BeginTx(x, nil)
+	if err != nil {
+		return &errval{s: "unable to start daily hits transaction", e: err}
+	}
+	var (
+		q *sql.Stmt
+		s = d.UTC().Format(dateFormat)
+	)
+	if q, err = t.PrepareContext(x, sqlDailyAdd); err != nil {
+		t.Rollback()
+		return &errval{s: "unable to prepare daily hits statement", e: err}
+	}
+	for k, v := range h {
+		if _, err = q.ExecContext(x, k, s, v, u[k]); err != nil {
+			break
+		}
+	}
+	if q.Close(); err != nil {
+		t.Rollback()
+		return &errval{s: "unable to execute daily hits statement", e: err}
+	}
+	if err = t.Commit(); err != nil {
+		return &errval{s: "unable to commit daily hits transaction", e: err}
+	}
+	return nil
+}
+func (m *mysqlDB) visits(x context.Context, n string, d time.Time) ([]Day, error) {
+	r, err := m.db.QueryContext(x, sqlDailyList, n, d.UTC().Format(dateFormat))
+	if err != nil {
+		return nil, &errval{s: "unable to execute visits statement", e: err}
+	}
+	var v []Day
+	for r.Next() {
+		var e Day
+		if err = r.Scan(&e.Date, &e.Hits, &e.Uniques); err != nil {
+			break
+		}
+		v = append(v, e)
+	}
+	if r.Close(); err != nil {
+		return nil, &errval{s: "unable to parse visits statement results", e: err}
+	}
+	if err = r.Err(); err != nil {
+		return nil, &errval{s: "unable to parse visits statement results", e: err}
+	}
+	return v, nil
+}
+func (m *mysqlDB) usage(x context.Context, f, t time.Time) ([]usage, error) {
+	r, err := m.db.QueryContext(x, sqlDailyUsage, f.UTC().Format(dateFormat), t.UTC().Format(dateFormat))
+	if err != nil {
+		return nil, &errval{s: "unable to execute usage statement", e: err}
+	}
+	var v []usage
+	for r.Next() {
+		var e usage
+		if err = r.Scan(&e.name, &e.url, &e.hits, &e.uniques); err != nil {
+			break
+		}
+		v = append(v, e)
+	}
+	if r.Close(); err != nil {
+		return nil, &errval{s: "unable to parse usage statement results", e: err}
+	}
+	if err = r.Err(); err != nil {
+		return nil, &errval{s: "unable to parse usage statement results", e: err}
+	}
+	return v, nil
+}
+func (m *mysqlDB) popular(x context.Context, d time.Time, n int) ([]Link, error) {
+	r, err := m.db.QueryContext(x, sqlDailyPopular, d.UTC().Format(dateFormat), n)
+	if err != nil {
+		return nil, &errval{s: "unable to execute popular statement", e: err}
+	}
+	v, err := scanLinks(r)
+	if err != nil {
+		return nil, &errval{s: "unable to parse popular statement results", e: err}
+	}
+	return v, nil
+}
+func (m *mysqlDB) purge(x context.Context, d time.Time) error {
+	if _, err := m.db.ExecContext(x, sqlDailyPurge, d.UTC().Format(dateFormat)); err != nil {
+		return &errval{s: "unable to execute daily hits purge statement", e: err}
+	}
+	return nil
+}
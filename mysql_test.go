@@ -0,0 +1,248 @@
+// mysql_test.go
+// URL Shortener with MySQL database.
+//
+// Copyright (C) 2020 iDigitalFlame
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+//
+
+package linker
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+var linkColumns = []string{
+	"LinkURL", "LinkAppend", "LinkApp", "LinkMeta", "LinkKey", "LinkReferrers", "LinkSchedule", "LinkHeaders",
+	"LinkRefresh", "LinkRollout", "LinkCountries",
+}
+
+// newMock returns a Linker created by NewWithDB with a mock database, which expects the statements that create
+// and update the tables. The returned prepared get statement is used for the redirect lookups.
+func newMock(t *testing.T) (*Linker, sqlmock.Sqlmock, *sqlmock.ExpectedPrepare) {
+	t.Helper()
+	db, m, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	if err != nil {
+		t.Fatalf("unable to create mock database: %s", err)
+	}
+	for _, s := range [...]string{sqlPrepare, sqlPrepareHistory, sqlPrepareDaily, sqlPrepareDeleted} {
+		m.ExpectPrepare(s).ExpectExec().WillReturnResult(sqlmock.NewResult(0, 0))
+	}
+	for i := range columns {
+		m.ExpectQuery(sqlColumn).WithArgs(columns[i][0], columns[i][1]).
+			WillReturnRows(sqlmock.NewRows([]string{"COUNT(*)"}).AddRow(1))
+	}
+	for i := range indexes {
+		m.ExpectQuery(sqlIndex).WithArgs(indexes[i][0], indexes[i][1]).
+			WillReturnRows(sqlmock.NewRows([]string{"COUNT(*)"}).AddRow(1))
+	}
+	g := m.ExpectPrepare(sqlGet)
+	l, err := NewWithDB(db)
+	if err != nil {
+		t.Fatalf("unable to create Linker: %s", err)
+	}
+	if err = m.ExpectationsWereMet(); err != nil {
+		t.Fatalf("setup did not run the expected statements: %s", err)
+	}
+	t.Cleanup(func() {
+		m.ExpectClose()
+		if err := l.Close(); err != nil {
+			t.Errorf("unable to close Linker: %s", err)
+		}
+		if err := m.ExpectationsWereMet(); err != nil {
+			t.Error(err)
+		}
+	})
+	return l, m, g
+}
+func TestNewWithDB(t *testing.T) {
+	if _, err := NewWithDB(nil); err != errNotConfigured {
+		t.Fatalf("NewWithDB(nil) returned %v, expected %v", err, errNotConfigured)
+	}
+	db, m, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	if err != nil {
+		t.Fatalf("unable to create mock database: %s", err)
+	}
+	defer db.Close()
+	m.ExpectPrepare(sqlPrepare).ExpectExec().WillReturnError(errors.New("access denied"))
+	if _, err = NewWithDB(db); err == nil || !strings.Contains(err.Error(), "unable to create the initial database tables") {
+		t.Fatalf("NewWithDB returned %v, expected a table error", err)
+	}
+	if err = m.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+	l, _, _ := newMock(t)
+	if l.db == nil {
+		t.Fatal("NewWithDB did not set the store")
+	}
+}
+func TestMockServe(t *testing.T) {
+	l, m, g := newMock(t)
+	g.ExpectQuery().WithArgs("foo").WillReturnRows(
+		sqlmock.NewRows(linkColumns).AddRow("https://example.com/foo", nil, nil, nil, nil, nil, nil, nil, nil, nil, nil),
+	)
+	g.ExpectQuery().WithArgs("nope").WillReturnError(sql.ErrNoRows)
+	g.ExpectQuery().WithArgs("down").WillReturnError(errors.New("connection refused"))
+	h := l.Handler()
+	v := [...]struct {
+		path, location string
+		status         int
+	}{
+		{"/foo/bar", "https://example.com/foo/bar", http.StatusTemporaryRedirect},
+		{"/nope", "https://duckduckgo.com", http.StatusTemporaryRedirect},
+		{"/down", "", http.StatusInternalServerError},
+	}
+	for _, c := range v {
+		r := httptest.NewRequest(http.MethodGet, c.path, nil)
+		r.Header.Set("User-Agent", "Mozilla/5.0")
+		w := httptest.NewRecorder()
+		if h.ServeHTTP(w, r); w.Code != c.status || w.Header().Get("Location") != c.location {
+			t.Errorf("%s: response is %d %q, expected %d %q", c.path, w.Code, w.Header().Get("Location"), c.status, c.location)
+		}
+	}
+	m.ExpectBegin()
+	m.ExpectPrepare(sqlHits).ExpectExec().WithArgs(1, "foo").WillReturnResult(sqlmock.NewResult(0, 1))
+	m.ExpectCommit()
+	m.ExpectBegin()
+	m.ExpectPrepare(sqlDailyAdd).ExpectExec().WithArgs("foo", time.Now().UTC().Format(dateFormat), 1, 0).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	m.ExpectCommit()
+	if err := l.flush(context.Background()); err != nil {
+		t.Fatalf("unable to save hit counts: %s", err)
+	}
+}
+func TestMockAdd(t *testing.T) {
+	l, m, g := newMock(t)
+	m.ExpectPrepare(sqlAdd).ExpectExec().WithArgs("foo", "https://example.com/foo").
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	if err := l.Add("foo", "example.com/foo"); err != nil {
+		t.Fatalf("unable to add: %s", err)
+	}
+	m.ExpectPrepare(sqlAdd).ExpectExec().WithArgs("foo", "https://example.com/bar").
+		WillReturnError(errors.New("duplicate entry"))
+	if err := l.Add("foo", "https://example.com/bar"); err == nil || !strings.Contains(err.Error(), "add statement") {
+		t.Fatalf("adding a duplicate name returned %v, expected an add statement error", err)
+	}
+	if err := l.Add("bad name", "https://example.com"); err == nil {
+		t.Fatal("adding an invalid name did not return an error")
+	}
+	g.ExpectQuery().WithArgs("foo").WillReturnRows(
+		sqlmock.NewRows(linkColumns).AddRow("https://example.com/foo", nil, nil, nil, nil, nil, nil, nil, nil, nil, nil),
+	)
+	m.ExpectPrepare(sqlAdd).ExpectExec().WithArgs("alias", aliasPrefix+"foo").WillReturnResult(sqlmock.NewResult(2, 1))
+	if err := l.Add("alias", aliasPrefix+"foo"); err != nil {
+		t.Fatalf("unable to add alias: %s", err)
+	}
+	g.ExpectQuery().WithArgs("missing").WillReturnError(sql.ErrNoRows)
+	if err := l.Add("alias2", aliasPrefix+"missing"); err == nil || !strings.Contains(err.Error(), "does not exist") {
+		t.Fatalf("adding an alias to a missing name returned %v, expected a does not exist error", err)
+	}
+}
+func TestMockDelete(t *testing.T) {
+	l, m, _ := newMock(t)
+	v := [...]struct {
+		name    string
+		deleted int64
+	}{{"foo", 1}, {"missing", 0}}
+	// Deleting a name that does not exist is not an error, so the command line and API calls can be repeated.
+	for _, c := range v {
+		m.ExpectBegin()
+		m.ExpectExec(sqlDeletedAdd).WithArgs(c.name).WillReturnResult(sqlmock.NewResult(0, c.deleted))
+		m.ExpectExec(sqlDelete).WithArgs(c.name).WillReturnResult(sqlmock.NewResult(0, c.deleted))
+		m.ExpectExec(sqlHistoryDelete).WithArgs(c.name).WillReturnResult(sqlmock.NewResult(0, 0))
+		m.ExpectExec(sqlDailyDelete).WithArgs(c.name).WillReturnResult(sqlmock.NewResult(0, 0))
+		m.ExpectCommit()
+		if err := l.Delete(c.name); err != nil {
+			t.Fatalf("unable to delete %q: %s", c.name, err)
+		}
+	}
+	m.ExpectBegin()
+	m.ExpectExec(sqlDeletedAdd).WithArgs("foo").WillReturnResult(sqlmock.NewResult(0, 1))
+	m.ExpectExec(sqlDelete).WithArgs("foo").WillReturnError(errors.New("lock wait timeout"))
+	m.ExpectRollback()
+	if err := l.Delete("foo"); err == nil || !strings.Contains(err.Error(), "delete statement") {
+		t.Fatalf("delete returned %v, expected a delete statement error", err)
+	}
+	if err := l.Delete("bad name"); err == nil {
+		t.Fatal("deleting an invalid name did not return an error")
+	}
+}
+func TestMockUpdate(t *testing.T) {
+	l, m, _ := newMock(t)
+	m.ExpectPrepare(sqlRoll).ExpectExec().WithArgs(sql.NullString{}, "foo").WillReturnResult(sqlmock.NewResult(0, 1))
+	m.ExpectBegin()
+	m.ExpectExec(sqlHistoryAdd).WithArgs("foo").WillReturnResult(sqlmock.NewResult(3, 1))
+	m.ExpectExec(sqlUpdate).WithArgs("https://example.com/new", "foo").WillReturnResult(sqlmock.NewResult(0, 1))
+	m.ExpectCommit()
+	if err := l.Update("foo", "https://example.com/new"); err != nil {
+		t.Fatalf("unable to update: %s", err)
+	}
+	m.ExpectPrepare(sqlRoll).ExpectExec().WithArgs(sql.NullString{}, "missing").WillReturnResult(sqlmock.NewResult(0, 0))
+	if err := l.Update("missing", "https://example.com/new"); err == nil || !strings.Contains(err.Error(), "does not exist") {
+		t.Fatalf("updating a missing name returned %v, expected a does not exist error", err)
+	}
+	m.ExpectPrepare(sqlRoll).ExpectExec().WithArgs(sql.NullString{}, "foo").WillReturnResult(sqlmock.NewResult(0, 1))
+	m.ExpectBegin()
+	m.ExpectExec(sqlHistoryAdd).WithArgs("foo").WillReturnResult(sqlmock.NewResult(4, 1))
+	m.ExpectExec(sqlUpdate).WithArgs("https://example.com/other", "foo").WillReturnError(errors.New("data too long"))
+	m.ExpectRollback()
+	if err := l.Update("foo", "https://example.com/other"); err == nil || !strings.Contains(err.Error(), "update statement") {
+		t.Fatalf("update returned %v, expected the history to be rolled back", err)
+	}
+	d := time.Date(2020, 10, 1, 12, 0, 0, 0, time.UTC)
+	m.ExpectPrepare(sqlHistoryList).ExpectQuery().WithArgs("foo").WillReturnRows(
+		sqlmock.NewRows([]string{"HistoryID", "LinkURL", "HistoryDate"}).
+			AddRow(3, "https://example.com/old", d).AddRow(1, "https://example.com/older", d.Add(-time.Hour)),
+	)
+	h, err := l.History("foo")
+	if err != nil {
+		t.Fatalf("unable to read history: %s", err)
+	}
+	if len(h) != 2 || h[0].ID != 3 || h[0].URL != "https://example.com/old" || !h[1].Time.Equal(d.Add(-time.Hour)) {
+		t.Fatalf("history is %+v, expected the two versions", h)
+	}
+	m.ExpectBegin()
+	m.ExpectQuery(sqlHistoryGet).WithArgs(3, "foo").
+		WillReturnRows(sqlmock.NewRows([]string{"LinkURL"}).AddRow("https://example.com/old"))
+	m.ExpectExec(sqlHistoryAdd).WithArgs("foo").WillReturnResult(sqlmock.NewResult(5, 1))
+	m.ExpectExec(sqlUpdate).WithArgs("https://example.com/old", "foo").WillReturnResult(sqlmock.NewResult(0, 1))
+	m.ExpectCommit()
+	m.ExpectPrepare(sqlRoll).ExpectExec().WithArgs(sql.NullString{}, "foo").WillReturnResult(sqlmock.NewResult(0, 1))
+	if err = l.Rollback("foo", 3); err != nil {
+		t.Fatalf("unable to rollback: %s", err)
+	}
+	m.ExpectBegin()
+	m.ExpectQuery(sqlHistoryGet).WithArgs(9, "foo").WillReturnError(sql.ErrNoRows)
+	m.ExpectRollback()
+	if err = l.Rollback("foo", 9); err == nil || !strings.Contains(err.Error(), "does not exist") {
+		t.Fatalf("rollback to a missing version returned %v, expected a does not exist error", err)
+	}
+}
+func TestMockPurge(t *testing.T) {
+	l, m, _ := newMock(t)
+	d := time.Date(2020, 6, 1, 0, 0, 0, 0, time.UTC)
+	m.ExpectExec(sqlDailyPurge).WithArgs("2020-06-01").WillReturnResult(sqlmock.NewResult(0, 12))
+	if err := l.db.purge(context.Background(), d); err != nil {
+		t.Fatalf("unable to purge daily hits: %s", err)
+	}
+}
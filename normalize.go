@@ -0,0 +1,154 @@
+// normalize.go
+// URL Shortener with MySQL database.
+//
+// Copyright (C) 2020 iDigitalFlame
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+//
+
+package linker
+
+import (
+	"net"
+	"net/url"
+	"strings"
+
+	"golang.org/x/net/idna"
+)
+
+const hex = "0123456789ABCDEF"
+
+var tracking = [...]string{
+	"fbclid", "gclid", "dclid", "msclkid", "yclid", "igshid", "mc_cid", "mc_eid", "_ga", "_hsenc", "_hsmi",
+}
+
+type normalizer struct {
+	params  map[string]struct{}
+	enabled bool
+	utm     bool
+}
+type normalizeConfig struct {
+	Params   []string `json:"params"`
+	Enabled  bool     `json:"enabled"`
+	Tracking bool     `json:"tracking"`
+}
+
+func (n *normalizer) load(c normalizeConfig) {
+	if n.enabled = c.Enabled; !n.enabled {
+		return
+	}
+	if n.params = make(map[string]struct{}, len(c.Params)+len(tracking)); c.Tracking {
+		for i := range tracking {
+			n.params[tracking[i]] = struct{}{}
+		}
+	}
+	for i := range c.Params {
+		n.params[strings.ToLower(c.Params[i])] = struct{}{}
+	}
+	n.utm = c.Tracking
+}
+func ascii(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= 0x80 {
+			return false
+		}
+	}
+	return true
+}
+func location(s string) string {
+	if ascii(s) {
+		return s
+	}
+	u, err := url.Parse(s)
+	if err != nil || punycode(u) != nil {
+		return s
+	}
+	return u.String()
+}
+func punycode(u *url.URL) error {
+	if !ascii(u.RawQuery) {
+		var b strings.Builder
+		for i := 0; i < len(u.RawQuery); i++ {
+			if u.RawQuery[i] < 0x80 {
+				b.WriteByte(u.RawQuery[i])
+				continue
+			}
+			b.WriteByte('%')
+			b.WriteByte(hex[u.RawQuery[i]>>4])
+			b.WriteByte(hex[u.RawQuery[i]&0xF])
+		}
+		u.RawQuery = b.String()
+	}
+	h := u.Hostname()
+	if ascii(h) {
+		return nil
+	}
+	a, err := idna.Lookup.ToASCII(h)
+	if err != nil {
+		return &errval{s: `invalid URL host "` + h + `"`, e: err}
+	}
+	if p := u.Port(); len(p) > 0 {
+		a = a + ":" + p
+	}
+	u.Host = a
+	return nil
+}
+func (n *normalizer) normalize(u *url.URL) (*url.URL, error) {
+	if !n.enabled {
+		return u, nil
+	}
+	u.Scheme = strings.ToLower(u.Scheme)
+	if len(u.Host) > 0 {
+		if err := punycode(u); err != nil {
+			return nil, err
+		}
+		h, p := u.Hostname(), u.Port()
+		if h = strings.ToLower(h); strings.IndexByte(h, ':') >= 0 {
+			// Only IPv6 addresses (with an optional zone) can have a colon in the host name.
+			a := h
+			if i := strings.IndexByte(a, '%'); i > 0 {
+				a = a[:i]
+			}
+			if net.ParseIP(a) == nil {
+				return nil, &errval{s: `invalid URL host "` + u.Host + `"`}
+			}
+			h = "[" + h + "]"
+		}
+		if (p == "80" && u.Scheme == "http") || (p == "443" && u.Scheme == "https") {
+			p = ""
+		}
+		if len(p) > 0 {
+			h = h + ":" + p
+		}
+		u.Host = h
+	}
+	if len(u.Opaque) == 0 {
+		u = u.ResolveReference(&url.URL{})
+	}
+	if len(n.params) == 0 || len(u.RawQuery) == 0 {
+		return u, nil
+	}
+	q, c := u.Query(), false
+	for k := range q {
+		x := strings.ToLower(k)
+		if _, ok := n.params[x]; ok || (n.utm && strings.HasPrefix(x, "utm_")) {
+			delete(q, k)
+			c = true
+		}
+	}
+	if c {
+		u.RawQuery = q.Encode()
+	}
+	return u, nil
+}
@@ -0,0 +1,247 @@
+// output.go
+// URL Shortener with MySQL database.
+//
+// Copyright (C) 2020 iDigitalFlame
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+//
+
+package linker
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"strconv"
+	"strings"
+)
+
+const timeFormat = "2006-01-02 15:04:05"
+
+// Table, JSON, CSV and XLSX are the output formats that can be used to print the redirect list, history, visits and
+// campaigns. The XLSX format is a spreadsheet workbook with a single sheet. The Nginx and Caddy formats can only be
+// used to print the redirect list, as web server configuration that serves the same redirects without Linker. The DNS
+// format can only be used to print the redirect list, as DNS zone file TXT records.
+const (
+	Table Format = iota
+	JSON
+	CSV
+	Nginx
+	Caddy
+	DNS
+	XLSX
+)
+
+// Format is a type that represents an output format that can be used by the WriteLinks, WriteHistory, WriteVisits
+// and WriteCampaigns functions. The Table format is a fixed-width text table meant for humans, while the JSON and
+// CSV formats are meant to be read by scripts and the XLSX format is meant to be opened in a spreadsheet.
+type Format uint8
+
+// ParseFormat will return the Format that matches the supplied name ("table", "json", "csv", "xlsx", "nginx",
+// "caddy" or "dns"). This function will return an error if the name does not match any Format.
+func ParseFormat(s string) (Format, error) {
+	switch strings.ToLower(s) {
+	case "", "table":
+		return Table, nil
+	case "json":
+		return JSON, nil
+	case "csv":
+		return CSV, nil
+	case "nginx":
+		return Nginx, nil
+	case "caddy":
+		return Caddy, nil
+	case "dns":
+		return DNS, nil
+	case "xlsx":
+		return XLSX, nil
+	}
+	return Table, &errval{s: `invalid output format "` + s + `"`}
+}
+
+// WriteLinks will write the list of redirects to the supplied Writer using this Format. This function returns
+// an error if writing fails.
+func (f Format) WriteLinks(w io.Writer, v []Link) error {
+	if f == JSON {
+		if v == nil {
+			v = []Link{}
+		}
+		return encodeJSON(w, v)
+	}
+	if f == Nginx || f == Caddy {
+		return f.writeServer(w, resolved(v))
+	}
+	if f == DNS {
+		return writeDNS(w, resolved(v))
+	}
+	r := make([][]string, len(v))
+	for i := range v {
+		r[i] = []string{v[i].Name, strconv.FormatUint(v[i].Hits, 10), v[i].URL}
+	}
+	return f.write(w, []string{"Name", "Hits", "URL"}, []int{15, 10}, r)
+}
+
+// WriteHistory will write the list of redirect Versions to the supplied Writer using this Format. This function
+// returns an error if writing fails.
+func (f Format) WriteHistory(w io.Writer, v []Version) error {
+	if f == JSON {
+		if v == nil {
+			v = []Version{}
+		}
+		return encodeJSON(w, v)
+	}
+	if f == Nginx || f == Caddy || f == DNS {
+		return &errval{s: "history cannot be written as server configuration"}
+	}
+	r := make([][]string, len(v))
+	for i := range v {
+		r[i] = []string{strconv.FormatUint(v[i].ID, 10), v[i].Time.Format(timeFormat), v[i].URL}
+	}
+	return f.write(w, []string{"ID", "Date", "URL"}, []int{10, 21}, r)
+}
+
+// WriteVisits will write the list of redirect daily visits to the supplied Writer using this Format. This function
+// returns an error if writing fails.
+func (f Format) WriteVisits(w io.Writer, v []Day) error {
+	if f == JSON {
+		if v == nil {
+			v = []Day{}
+		}
+		return encodeJSON(w, v)
+	}
+	if f == Nginx || f == Caddy || f == DNS {
+		return &errval{s: "visits cannot be written as server configuration"}
+	}
+	r := make([][]string, len(v))
+	for i := range v {
+		r[i] = []string{v[i].Date.Format(dateFormat), strconv.FormatUint(v[i].Hits, 10), strconv.FormatUint(v[i].Uniques, 10)}
+	}
+	return f.write(w, []string{"Date", "Hits", "Uniques"}, []int{15, 10}, r)
+}
+
+// WriteCampaigns will write the campaign report to the supplied Writer using this Format. This function returns
+// an error if writing fails.
+func (f Format) WriteCampaigns(w io.Writer, v []Campaign) error {
+	if f == JSON {
+		if v == nil {
+			v = []Campaign{}
+		}
+		return encodeJSON(w, v)
+	}
+	if f == Nginx || f == Caddy || f == DNS {
+		return &errval{s: "campaigns cannot be written as server configuration"}
+	}
+	r := make([][]string, len(v))
+	for i := range v {
+		r[i] = []string{
+			v[i].Campaign, v[i].Source, v[i].Medium, v[i].Name,
+			strconv.FormatUint(v[i].Hits, 10), strconv.FormatUint(v[i].Uniques, 10),
+		}
+	}
+	return f.write(w, []string{"Campaign", "Source", "Medium", "Name", "Hits", "Uniques"}, []int{20, 15, 15, 15, 10}, r)
+}
+func encodeJSON(w io.Writer, v interface{}) error {
+	e := json.NewEncoder(w)
+	e.SetIndent("", "    ")
+	if err := e.Encode(v); err != nil {
+		return &errval{s: "unable to write JSON output", e: err}
+	}
+	return nil
+}
+func (f Format) write(w io.Writer, h []string, s []int, r [][]string) error {
+	if f == XLSX {
+		return writeXLSX(w, h, r)
+	}
+	if f == CSV {
+		c := csv.NewWriter(w)
+		c.Write(h)
+		if c.WriteAll(r); c.Error() != nil {
+			return &errval{s: "unable to write CSV output", e: c.Error()}
+		}
+		return nil
+	}
+	var b strings.Builder
+	for i := range h {
+		if i < len(s) {
+			b.WriteString(expand(h[i], s[i]))
+			continue
+		}
+		b.WriteString(h[i])
+	}
+	b.WriteString("\n==============================================\n")
+	for i := range r {
+		for x := range r[i] {
+			if x < len(s) {
+				b.WriteString(expand(r[i][x], s[x]))
+				continue
+			}
+			b.WriteString(r[i][x])
+		}
+		b.WriteByte('\n')
+	}
+	if _, err := io.WriteString(w, b.String()); err != nil {
+		return &errval{s: "unable to write output", e: err}
+	}
+	return nil
+}
+func (f Format) writeServer(w io.Writer, v []Link) error {
+	var b strings.Builder
+	if f == Nginx {
+		b.WriteString("# Generated by Linker, include in the \"http\" block and redirect in a \"server\" block with:\n")
+		b.WriteString("#   if ($linker) { return 307 $linker; }\nmap $uri $linker {\n    default \"\";\n")
+	} else {
+		b.WriteString("# Generated by Linker, import in a site block.\n")
+	}
+	for i := range v {
+		// Nginx expands "$" and Caddy expands "{}" in values, so they are escaped in the URL.
+		u := strings.NewReplacer(`"`, "%22", `\`, "%5C", "$", "%24", "{", "%7B", "}", "%7D").Replace(location(v[i].URL))
+		if f == Nginx {
+			b.WriteString(`    "/` + v[i].Name + `" "` + u + "\";\n")
+			b.WriteString(`    "/` + v[i].Name + `/" "` + u + "\";\n")
+			continue
+		}
+		b.WriteString("redir /" + v[i].Name + ` "` + u + "\" 307\n")
+		b.WriteString("redir /" + v[i].Name + `/ "` + u + "\" 307\n")
+	}
+	if f == Nginx {
+		b.WriteString("}\n")
+	}
+	if _, err := io.WriteString(w, b.String()); err != nil {
+		return &errval{s: "unable to write output", e: err}
+	}
+	return nil
+}
+func writeDNS(w io.Writer, v []Link) error {
+	var b strings.Builder
+	b.WriteString("; Generated by Linker, names are relative to the zone $ORIGIN.\n")
+	for i := range v {
+		u := strings.NewReplacer(`"`, "%22", `\`, "%5C").Replace(location(v[i].URL))
+		b.WriteString(v[i].Name + " IN TXT")
+		// TXT record strings are limited to 255 bytes, so longer URLs are split into multiple strings which
+		// are joined by resolvers.
+		for len(u) > 0 {
+			n := len(u)
+			if n > 255 {
+				n = 255
+			}
+			b.WriteString(` "` + u[:n] + `"`)
+			u = u[n:]
+		}
+		b.WriteByte('\n')
+	}
+	if _, err := io.WriteString(w, b.String()); err != nil {
+		return &errval{s: "unable to write output", e: err}
+	}
+	return nil
+}
@@ -0,0 +1,207 @@
+// popular.go
+// URL Shortener with MySQL database.
+//
+// Copyright (C) 2020 iDigitalFlame
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+//
+
+package linker
+
+import (
+	"context"
+	"encoding/json"
+	"html"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const dateFormat = "2006-01-02"
+
+const defaultPopularDays = 7
+
+var periods = [...]int{1, 7, 30, 0}
+
+type popular struct {
+	path   string
+	header string
+	limit  int
+}
+type listed struct {
+	Meta *Meta  `json:"meta,omitempty"`
+	Name string `json:"name"`
+	URL  string `json:"url"`
+	Hits uint64 `json:"hits"`
+}
+type popularConfig struct {
+	Path   string `json:"path"`
+	Header string `json:"header"`
+	Limit  uint16 `json:"limit"`
+}
+
+func (p *popular) load(c popularConfig) error {
+	if len(c.Path) == 0 {
+		return nil
+	}
+	if c.Path[0] != '/' || len(c.Path) == 1 {
+		return &errval{s: `invalid popular page path "` + c.Path + `"`}
+	}
+	if p.path, p.header, p.limit = c.Path, c.Header, int(c.Limit); p.limit == 0 {
+		p.limit = defaultSearchLimit
+	}
+	return nil
+}
+
+// Popular will return up to the supplied number of the most used redirects in the last supplied number of days
+// (including today, in UTC), with the hit count of each redirect set to the hits in that time. A day count of zero
+// uses the total hits of each redirect. Redirects with a signing key or referrers are not included. This function
+// will return an error if the lookup fails.
+func (l *Linker) Popular(d, n int) ([]Link, error) {
+	if l.db == nil {
+		return nil, errNotConfigured
+	}
+	if n <= 0 {
+		return nil, nil
+	}
+	x := l.ctx
+	if x == nil {
+		x = context.Background()
+	}
+	var (
+		v   []Link
+		err error
+	)
+	if d <= 0 {
+		v, err = l.db.top(x, n)
+	} else {
+		v, err = l.db.popular(x, time.Now().UTC().AddDate(0, 0, 1-d), n)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return visible(v), nil
+}
+func visible(v []Link) []Link {
+	r := v[:0]
+	for i := range v {
+		if len(v[i].Key) == 0 && len(v[i].Referrers) == 0 {
+			r = append(r, v[i])
+		}
+	}
+	return r
+}
+func (l *Linker) ranked(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	l.lock.RLock()
+	c, p := l.rank, l.proxy
+	if l.lock.RUnlock(); gated(w, r, c.header, p) {
+		return
+	}
+	d := defaultPopularDays
+	if s := r.URL.Query().Get("days"); len(s) > 0 {
+		i, err := strconv.ParseUint(s, 10, 16)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		d = int(i)
+	}
+	v, err := l.Popular(d, c.limit)
+	if err != nil {
+		l.report.error("Unable to list popular names", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	var b strings.Builder
+	b.WriteString(`<p>`)
+	for i := range periods {
+		if i > 0 {
+			b.WriteString(` | `)
+		}
+		var t string
+		switch periods[i] {
+		case 0:
+			t = "All time"
+		case 1:
+			t = "Today"
+		default:
+			t = "Last " + strconv.Itoa(periods[i]) + " days"
+		}
+		if periods[i] == d {
+			b.WriteString(`<b>` + t + `</b>`)
+			continue
+		}
+		b.WriteString(`<a href="?days=` + strconv.Itoa(periods[i]) + `">` + t + `</a>`)
+	}
+	b.WriteString(`</p>`)
+	results(w, r, "Popular", b.String(), v)
+}
+func gated(w http.ResponseWriter, r *http.Request, h string, p proxies) bool {
+	switch {
+	case len(h) == 0:
+		return false
+	case !p.trusted(r):
+		w.WriteHeader(http.StatusForbidden)
+	case len(strings.TrimSpace(r.Header.Get(h))) == 0:
+		w.WriteHeader(http.StatusUnauthorized)
+	default:
+		return false
+	}
+	return true
+}
+func results(w http.ResponseWriter, r *http.Request, t, h string, v []Link) {
+	w.Header().Set("Cache-Control", "no-store")
+	if strings.Contains(r.Header.Get("Accept"), "application/json") {
+		o := make([]listed, len(v))
+		for i := range v {
+			o[i] = listed{Meta: v[i].Meta, Name: v[i].Name, URL: v[i].URL, Hits: v[i].Hits}
+		}
+		b, err := json.Marshal(o)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		w.Write(b)
+		return
+	}
+	var b strings.Builder
+	b.WriteString(`<!DOCTYPE html><html><head><meta charset="utf-8"><meta name="robots" content="noindex, nofollow">`)
+	b.WriteString(`<title>` + t + `</title></head><body><h1>` + t + `</h1>` + h)
+	if len(v) > 0 {
+		b.WriteString(`<table>`)
+		for i := range v {
+			var (
+				n = html.EscapeString(v[i].Name)
+				u = html.EscapeString(v[i].URL)
+			)
+			b.WriteString(`<tr><td><a href="` + n + `">` + n + `</a></td><td>` + u + `</td><td>`)
+			if v[i].Meta != nil {
+				b.WriteString(html.EscapeString(v[i].Meta.Title))
+			}
+			b.WriteString(`</td><td>` + strconv.FormatUint(v[i].Hits, 10) + `</td></tr>`)
+		}
+		b.WriteString(`</table>`)
+	}
+	b.WriteString(`</body></html>`)
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(b.String()))
+}
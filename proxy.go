@@ -0,0 +1,95 @@
+// proxy.go
+// URL Shortener with MySQL database.
+//
+// Copyright (C) 2020 iDigitalFlame
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+//
+
+package linker
+
+import (
+	"net"
+	"net/http"
+	"strings"
+)
+
+// proxies is the list of networks of the reverse proxies in front of Linker, which are trusted to set the headers
+// that identify the user and client address of a request.
+type proxies []*net.IPNet
+
+func trust(v []string) (proxies, error) {
+	if len(v) == 0 {
+		return nil, nil
+	}
+	p := make(proxies, 0, len(v))
+	for i := range v {
+		s := strings.TrimSpace(v[i])
+		if strings.IndexByte(s, '/') == -1 {
+			if x := net.ParseIP(s); x != nil && x.To4() != nil {
+				s += "/32"
+			} else {
+				s += "/128"
+			}
+		}
+		_, n, err := net.ParseCIDR(s)
+		if err != nil {
+			return nil, &errval{s: `invalid proxy address "` + v[i] + `"`}
+		}
+		p = append(p, n)
+	}
+	return p, nil
+}
+
+// client returns the address of the client that sent the request. When the request is from a trusted proxy, the
+// "X-Forwarded-For" header is read from the right and the first address that is not a trusted proxy is used, as
+// the addresses to the left of it could be set by the client.
+func (p proxies) client(r *http.Request) string {
+	a := address(r)
+	if !p.contains(a) {
+		return a
+	}
+	v := r.Header["X-Forwarded-For"]
+	for i := len(v) - 1; i >= 0; i-- {
+		s := strings.Split(v[i], ",")
+		for x := len(s) - 1; x >= 0; x-- {
+			h := strings.TrimSpace(s[x])
+			if net.ParseIP(h) == nil {
+				return a
+			}
+			if a = h; !p.contains(h) {
+				return h
+			}
+		}
+	}
+	return a
+}
+func (p proxies) trusted(r *http.Request) bool {
+	return p.contains(address(r))
+}
+func (p proxies) contains(s string) bool {
+	if len(p) == 0 {
+		return false
+	}
+	x := net.ParseIP(s)
+	if x == nil {
+		return false
+	}
+	for i := range p {
+		if p[i].Contains(x) {
+			return true
+		}
+	}
+	return false
+}
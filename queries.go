@@ -0,0 +1,297 @@
+// queries.go
+// URL Shortener with MySQL database.
+//
+// Copyright (C) 2020 iDigitalFlame
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+//
+
+package linker
+
+import (
+	"context"
+	"database/sql"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Statement is a struct that contains the latency metrics of a single kind of database call (such as "get" for
+// redirect lookups) since the HTTP service started.
+type Statement struct {
+	Name    string   `json:"name"`
+	Count   uint64   `json:"count"`
+	Errors  uint64   `json:"errors"`
+	Slow    uint64   `json:"slow"`
+	Total   duration `json:"total"`
+	Average duration `json:"average"`
+	Max     duration `json:"max"`
+}
+
+// timed wraps a store and records the latency of every call, logging calls that take longer than the slow query
+// threshold (when set). Only the call name is logged, the parameters (names, URLs and keys) are always redacted.
+type timed struct {
+	store
+	stats map[string]*Statement
+	slow  time.Duration
+	lock  sync.Mutex
+}
+
+func measure(d store, s duration) *timed {
+	return &timed{store: d, slow: time.Duration(s), stats: make(map[string]*Statement)}
+}
+
+// Statements will return the latency metrics of each kind of database call made since the HTTP service started,
+// sorted by name. This function returns nil if the database is not loaded.
+func (l *Linker) Statements() []Statement {
+	t, ok := l.queries()
+	if !ok {
+		return nil
+	}
+	t.lock.Lock()
+	v := make([]Statement, 0, len(t.stats))
+	for _, s := range t.stats {
+		v = append(v, *s)
+	}
+	t.lock.Unlock()
+	sort.Slice(v, func(i, j int) bool { return v[i].Name < v[j].Name })
+	return v
+}
+func (l *Linker) queries() (*timed, bool) {
+	switch d := l.db.(type) {
+	case *timed:
+		return d, true
+	case *sealed:
+		t, ok := d.store.(*timed)
+		return t, ok
+	}
+	return nil, false
+}
+func (t *timed) done(n string, c int, s time.Time, err error) {
+	d := time.Since(s)
+	t.lock.Lock()
+	v, ok := t.stats[n]
+	if !ok {
+		v = &Statement{Name: n}
+		t.stats[n] = v
+	}
+	v.Count++
+	if err != nil && err != context.Canceled {
+		v.Errors++
+	}
+	if v.Total += duration(d); duration(d) > v.Max {
+		v.Max = duration(d)
+	}
+	v.Average = v.Total / duration(v.Count)
+	if t.slow == 0 || d < t.slow {
+		t.lock.Unlock()
+		return
+	}
+	v.Slow++
+	t.lock.Unlock()
+	os.Stderr.WriteString(
+		"Slow database query " + n + "(" + strings.TrimSuffix(strings.Repeat("?, ", c), ", ") + ") took " +
+			d.Round(time.Microsecond).String() + "!\n",
+	)
+}
+func (t *timed) add(n, u string) error {
+	s := time.Now()
+	err := t.store.add(n, u)
+	t.done("add", 2, s, err)
+	return err
+}
+func (t *timed) claim(n, u, o string, q int) error {
+	s := time.Now()
+	err := t.store.claim(n, u, o, q)
+	t.done("claim", 4, s, err)
+	return err
+}
+func (t *timed) list() ([]Link, error) {
+	s := time.Now()
+	v, err := t.store.list()
+	t.done("list", 0, s, err)
+	return v, err
+}
+func (t *timed) filter(x context.Context, f filter) ([]Link, error) {
+	s := time.Now()
+	v, err := t.store.filter(x, f)
+	t.done("filter", 0, s, err)
+	return v, err
+}
+func (t *timed) delete(n string) error {
+	s := time.Now()
+	err := t.store.delete(n)
+	t.done("delete", 1, s, err)
+	return err
+}
+func (t *timed) deleted(x context.Context, n string) (time.Time, string, error) {
+	s := time.Now()
+	v, o, err := t.store.deleted(x, n)
+	if err == sql.ErrNoRows {
+		t.done("deleted", 1, s, nil)
+	} else {
+		t.done("deleted", 1, s, err)
+	}
+	return v, o, err
+}
+func (t *timed) update(n, u string) error {
+	s := time.Now()
+	err := t.store.update(n, u)
+	t.done("update", 2, s, err)
+	return err
+}
+func (t *timed) history(n string) ([]Version, error) {
+	s := time.Now()
+	v, err := t.store.history(n)
+	t.done("history", 1, s, err)
+	return v, err
+}
+func (t *timed) rollback(n string, i uint64) error {
+	s := time.Now()
+	err := t.store.rollback(n, i)
+	t.done("rollback", 2, s, err)
+	return err
+}
+func (t *timed) setAppend(n string, a *bool) error {
+	s := time.Now()
+	err := t.store.setAppend(n, a)
+	t.done("setAppend", 2, s, err)
+	return err
+}
+func (t *timed) setRefresh(n string, a *bool) error {
+	s := time.Now()
+	err := t.store.setRefresh(n, a)
+	t.done("setRefresh", 2, s, err)
+	return err
+}
+func (t *timed) setRollout(n string, v *Rollout) error {
+	s := time.Now()
+	err := t.store.setRollout(n, v)
+	t.done("setRollout", 2, s, err)
+	return err
+}
+func (t *timed) setApp(n, a string) error {
+	s := time.Now()
+	err := t.store.setApp(n, a)
+	t.done("setApp", 2, s, err)
+	return err
+}
+func (t *timed) setMeta(n string, m *Meta) error {
+	s := time.Now()
+	err := t.store.setMeta(n, m)
+	t.done("setMeta", 2, s, err)
+	return err
+}
+func (t *timed) setKey(n, k string) error {
+	s := time.Now()
+	err := t.store.setKey(n, k)
+	t.done("setKey", 2, s, err)
+	return err
+}
+func (t *timed) setReferrers(n string, v []string) error {
+	s := time.Now()
+	err := t.store.setReferrers(n, v)
+	t.done("setReferrers", 2, s, err)
+	return err
+}
+func (t *timed) setCountries(n string, v []string) error {
+	s := time.Now()
+	err := t.store.setCountries(n, v)
+	t.done("setCountries", 2, s, err)
+	return err
+}
+func (t *timed) setSchedule(n string, v []Schedule) error {
+	s := time.Now()
+	err := t.store.setSchedule(n, v)
+	t.done("setSchedule", 2, s, err)
+	return err
+}
+func (t *timed) setHeaders(n string, v map[string]string) error {
+	s := time.Now()
+	err := t.store.setHeaders(n, v)
+	t.done("setHeaders", 2, s, err)
+	return err
+}
+func (t *timed) setOwner(n, o string) error {
+	s := time.Now()
+	err := t.store.setOwner(n, o)
+	t.done("setOwner", 2, s, err)
+	return err
+}
+func (t *timed) top(x context.Context, n int) ([]Link, error) {
+	s := time.Now()
+	v, err := t.store.top(x, n)
+	t.done("top", 1, s, err)
+	return v, err
+}
+func (t *timed) search(x context.Context, q string, n int) ([]Link, error) {
+	s := time.Now()
+	v, err := t.store.search(x, q, n)
+	t.done("search", 2, s, err)
+	return v, err
+}
+func (t *timed) recent(x context.Context, n int) ([]Link, error) {
+	s := time.Now()
+	v, err := t.store.recent(x, n)
+	t.done("recent", 1, s, err)
+	return v, err
+}
+func (t *timed) get(x context.Context, n string) (record, error) {
+	s := time.Now()
+	v, err := t.store.get(x, n)
+	if err == sql.ErrNoRows {
+		t.done("get", 1, s, nil)
+	} else {
+		t.done("get", 1, s, err)
+	}
+	return v, err
+}
+func (t *timed) hits(x context.Context, h map[string]uint64) error {
+	s := time.Now()
+	err := t.store.hits(x, h)
+	t.done("hits", 1, s, err)
+	return err
+}
+func (t *timed) daily(x context.Context, d time.Time, h, u map[string]uint64) error {
+	s := time.Now()
+	err := t.store.daily(x, d, h, u)
+	t.done("daily", 3, s, err)
+	return err
+}
+func (t *timed) visits(x context.Context, n string, d time.Time) ([]Day, error) {
+	s := time.Now()
+	v, err := t.store.visits(x, n, d)
+	t.done("visits", 2, s, err)
+	return v, err
+}
+func (t *timed) usage(x context.Context, f, e time.Time) ([]usage, error) {
+	s := time.Now()
+	v, err := t.store.usage(x, f, e)
+	t.done("usage", 2, s, err)
+	return v, err
+}
+func (t *timed) popular(x context.Context, d time.Time, n int) ([]Link, error) {
+	s := time.Now()
+	v, err := t.store.popular(x, d, n)
+	t.done("popular", 2, s, err)
+	return v, err
+}
+func (t *timed) purge(x context.Context, d time.Time) error {
+	s := time.Now()
+	err := t.store.purge(x, d)
+	t.done("purge", 1, s, err)
+	return err
+}
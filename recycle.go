@@ -0,0 +1,68 @@
+// recycle.go
+// URL Shortener with MySQL database.
+//
+// Copyright (C) 2020 iDigitalFlame
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+//
+
+package linker
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+type recycler struct {
+	wait  time.Duration
+	owner bool
+}
+type recycleConfig struct {
+	Cooldown duration `json:"cooldown"`
+	Owner    bool     `json:"owner"`
+}
+
+func (r *recycler) load(v recycleConfig) error {
+	if v.Cooldown < 0 {
+		return &errval{s: `invalid recycle cooldown "` + time.Duration(v.Cooldown).String() + `"`}
+	}
+	r.wait, r.owner = time.Duration(v.Cooldown), v.Owner
+	return nil
+}
+
+// recycled returns the reason the deleted name n can not be added again by the owner o, or an empty string if it
+// can be added. An empty owner is used for names added without the claim page, which are only held back by the
+// cooldown. The previous owner of a deleted name can always claim it again.
+func (l *Linker) recycled(x context.Context, n, o string) (string, error) {
+	l.lock.RLock()
+	c := l.recycle
+	if l.lock.RUnlock(); c.wait <= 0 && !c.owner {
+		return "", nil
+	}
+	t, p, err := l.db.deleted(x, n)
+	switch {
+	case err == sql.ErrNoRows:
+		return "", nil
+	case err != nil:
+		return "", err
+	case len(p) > 0 && p == o:
+		return "", nil
+	case c.wait > 0 && time.Since(t) < c.wait:
+		return "was deleted recently and can be added again after " + t.Add(c.wait).UTC().Format(time.RFC3339), nil
+	case c.owner && len(p) > 0 && len(o) > 0:
+		return "was deleted and can only be claimed again by its previous owner", nil
+	}
+	return "", nil
+}
@@ -0,0 +1,133 @@
+// referrer.go
+// URL Shortener with MySQL database.
+//
+// Copyright (C) 2020 iDigitalFlame
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+//
+
+package linker
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// policies is the list of the supported "Referrer-Policy" values.
+var policies = [...]string{
+	"no-referrer", "no-referrer-when-downgrade", "origin", "origin-when-cross-origin", "same-origin", "strict-origin",
+	"strict-origin-when-cross-origin", "unsafe-url",
+}
+
+// SetReferrers will change the list of allowed referrers of the redirect with the supplied name. Each referrer
+// is a host name (such as "intranet.example.com", or ".example.com" to also match any sub domain) or a URL prefix
+// (such as "https://intranet.example.com/links/"). Requests for a redirect with referrers without a matching
+// "Referer" header get a 404 status. An empty list removes the restriction. This function will return an error
+// if the change fails or the name does not exist.
+func (l *Linker) SetReferrers(n string, v []string) error {
+	if l.db == nil {
+		return errNotConfigured
+	}
+	if !validName(n) {
+		return &errval{s: `name "` + n + `" contains invalid characters`}
+	}
+	r := make([]string, 0, len(v))
+	for i := range v {
+		s := strings.ToLower(strings.TrimSpace(v[i]))
+		if len(s) == 0 {
+			continue
+		}
+		if strings.ContainsAny(s, ", \t") {
+			return &errval{s: `referrer "` + v[i] + `" contains invalid characters`}
+		}
+		r = append(r, s)
+	}
+	if len(r) == 0 {
+		r = nil
+	}
+	if err := l.db.setReferrers(n, r); err != nil {
+		return err
+	}
+	l.cache.remove(n)
+	return nil
+}
+func policy(s string) (string, error) {
+	if s = strings.ToLower(strings.TrimSpace(s)); len(s) == 0 {
+		return "", nil
+	}
+	v := strings.Split(s, ",")
+loop:
+	for i := range v {
+		v[i] = strings.TrimSpace(v[i])
+		for x := range policies {
+			if v[i] == policies[x] {
+				continue loop
+			}
+		}
+		return "", &errval{s: `invalid referrer policy "` + v[i] + `"`}
+	}
+	return strings.Join(v, ", "), nil
+}
+func split(s string) []string {
+	if len(s) == 0 {
+		return nil
+	}
+	return strings.Split(s, ",")
+}
+func referred(r *http.Request, v []string) bool {
+	f := r.Referer()
+	if len(f) == 0 {
+		return false
+	}
+	u, err := url.Parse(f)
+	if err != nil {
+		return false
+	}
+	var (
+		h = strings.ToLower(u.Hostname())
+		s = strings.ToLower(f)
+	)
+	for i := range v {
+		switch {
+		case strings.Contains(v[i], "/"):
+			if prefixed(s, v[i]) {
+				return true
+			}
+		case v[i][0] == '.':
+			if h == v[i][1:] || strings.HasSuffix(h, v[i]) {
+				return true
+			}
+		case h == v[i]:
+			return true
+		}
+	}
+	return false
+}
+
+// prefixed returns true if the URL s starts with the prefix p and the prefix ends at a path, query or fragment
+// boundary, so the prefix "https://example.com" does not match "https://example.com.evil.net/".
+func prefixed(s, p string) bool {
+	if !strings.HasPrefix(s, p) {
+		return false
+	}
+	if len(s) == len(p) || p[len(p)-1] == '/' {
+		return true
+	}
+	switch s[len(p)] {
+	case '/', '?', '#':
+		return true
+	}
+	return false
+}
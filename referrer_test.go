@@ -0,0 +1,45 @@
+// referrer_test.go
+// URL Shortener with MySQL database.
+//
+// Copyright (C) 2020 iDigitalFlame
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+//
+
+package linker
+
+import "testing"
+
+func TestPrefixed(t *testing.T) {
+	v := []struct {
+		s, p string
+		e    bool
+	}{
+		{"https://example.com", "https://example.com", true},
+		{"https://example.com/page", "https://example.com", true},
+		{"https://example.com?q=1", "https://example.com", true},
+		{"https://example.com#top", "https://example.com", true},
+		{"https://example.com/page", "https://example.com/", true},
+		{"https://example.com.evil.net/", "https://example.com", false},
+		{"https://example.com:8080/", "https://example.com", false},
+		{"https://example.com/docs2", "https://example.com/docs", false},
+		{"https://example.com/docs/a", "https://example.com/docs", true},
+		{"https://example.org/", "https://example.com", false},
+	}
+	for i := range v {
+		if r := prefixed(v[i].s, v[i].p); r != v[i].e {
+			t.Errorf("prefixed(%q, %q) returned %t, expected %t", v[i].s, v[i].p, r, v[i].e)
+		}
+	}
+}
@@ -0,0 +1,84 @@
+// refresh.go
+// URL Shortener with MySQL database.
+//
+// Copyright (C) 2020 iDigitalFlame
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+//
+
+package linker
+
+import (
+	"encoding/json"
+	"html"
+	"net/http"
+	"strconv"
+)
+
+const maxRefreshDelay = 60
+
+type refresher struct {
+	notice string
+	delay  uint32
+	on     bool
+}
+type refreshConfig struct {
+	Notice  string `json:"notice"`
+	Delay   uint32 `json:"delay"`
+	Enabled bool   `json:"enabled"`
+}
+
+// SetRefresh will change whether the redirect with the supplied name is sent as an HTML page that redirects with a
+// meta refresh and JavaScript (without a referrer) instead of a redirect status. A nil value will reset the redirect
+// to use the "refresh" config value. This function will return an error if the change fails or the name does not
+// exist.
+func (l *Linker) SetRefresh(n string, a *bool) error {
+	if l.db == nil {
+		return errNotConfigured
+	}
+	if !validName(n) {
+		return &errval{s: `name "` + n + `" contains invalid characters`}
+	}
+	if err := l.db.setRefresh(n, a); err != nil {
+		return err
+	}
+	l.cache.remove(n)
+	return nil
+}
+func (r *refresher) load(c refreshConfig) error {
+	if c.Delay > maxRefreshDelay {
+		return &errval{s: "refresh delay must not be longer than " + strconv.Itoa(maxRefreshDelay) + " seconds"}
+	}
+	r.on, r.delay, r.notice = c.Enabled, c.Delay, c.Notice
+	return nil
+}
+func (r refresher) write(w http.ResponseWriter, u string) {
+	var (
+		j, _ = json.Marshal(u)
+		d    = strconv.FormatUint(uint64(r.delay), 10)
+		n    = "Redirecting to"
+	)
+	if u = html.EscapeString(u); len(r.notice) > 0 {
+		n = html.EscapeString(r.notice)
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Referrer-Policy", "no-referrer")
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(`<!DOCTYPE html><html><head><meta charset="utf-8"><meta name="viewport" ` +
+		`content="width=device-width, initial-scale=1"><meta name="referrer" content="no-referrer">` +
+		`<meta http-equiv="refresh" content="` + d + `;url=` + u + `"><title>Redirecting</title></head><body><p>` + n +
+		` <a href="` + u + `" rel="noreferrer">` + u + `</a></p><script>setTimeout(function(){window.location.replace(` +
+		string(j) + `);},` + strconv.FormatUint(uint64(r.delay)*1000, 10) + `);</script></body></html>`))
+}
@@ -0,0 +1,209 @@
+// reload.go
+// URL Shortener with MySQL database.
+//
+// Copyright (C) 2020 iDigitalFlame
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+//
+
+package linker
+
+import (
+	"encoding/json"
+	"os"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// reloadable is the list of the top level config values that can be changed without restarting Linker.
+var reloadable = map[string]struct{}{
+	"strict": {}, "append": {}, "slashes": {}, "static": {}, "refresh": {}, "referrer_policy": {}, "allow_hosts": {},
+	"proxies": {}, "well_known": {}, "crawlers": {}, "signing": {}, "geo": {}, "claim": {}, "recycle": {},
+	"search": {}, "popular": {}, "feed": {}, "api": {}, "features.api": {}, "features.claim": {},
+	"features.search": {}, "features.popular": {}, "features.feed": {}, "features.previews": {}, "features.apps": {},
+}
+
+// secret is the list of config value names that are not included in the changes returned by Reload.
+var secret = [...]string{"key", "previous", "token", "secret", "dsn", "rollbar", "password", "webhook"}
+
+// view is a copy of the reloadable settings used by a request, taken under the read lock so the lock can be released
+// before the request does any slow work.
+type view struct {
+	hosts    map[string]struct{}
+	static   map[string]string
+	proxy    proxies
+	referrer string
+	claim    string
+	find     string
+	rank     string
+	news     string
+	known    known
+	crawl    crawlers
+	sign     signer
+	geo      geo
+	refresh  refresher
+	strict   bool
+	slash    bool
+	previews bool
+	apps     bool
+	append   bool
+}
+
+// Change is a struct that describes a changed config value that was found by the Reload function. The Key is the
+// dotted path of the value (such as "signing.required"). The Old and New values are empty for secret values (such
+// as keys, tokens and webhook URLs). Applied is false when the value only takes effect after Linker is restarted.
+type Change struct {
+	Old     interface{} `json:"old,omitempty"`
+	New     interface{} `json:"new,omitempty"`
+	Key     string      `json:"key"`
+	Applied bool        `json:"applied"`
+}
+
+// Reload will read the configuration file again and apply any changed values that can be changed while Linker is
+// running (such as the "strict", "signing", "geo" and most "features" values). The returned list contains every
+// changed value and if the change was applied, changes to other values (such as "listen" or "db") need a restart.
+// This function will return an error if Linker was not created from a configuration file or the file is not valid,
+// in which case nothing is changed.
+func (l *Linker) Reload() ([]Change, error) {
+	if len(l.file) == 0 {
+		return nil, &errval{s: "configuration was not loaded from a file"}
+	}
+	c, _, err := read(l.file)
+	if err != nil {
+		return nil, err
+	}
+	// The running config has the default timeouts filled in, so the new one needs them too to not report changes.
+	if err = c.Timeout.check(); err != nil {
+		return nil, err
+	}
+	// Static URLs use the running normalizer, as the "normalize" values only change after a restart.
+	n := Linker{norm: l.norm}
+	if err = n.settings(c); err != nil {
+		return nil, err
+	}
+	l.lock.Lock()
+	v := changes(l.conf, c)
+	l.strict, l.append, l.slash, l.hosts = n.strict, n.append, n.slash, n.hosts
+	l.known, l.crawl, l.sign, l.geo = n.known, n.crawl, n.sign, n.geo
+	l.claim, l.find, l.rank, l.news, l.api = n.claim, n.find, n.rank, n.news, n.api
+	l.recycle, l.static, l.proxy = n.recycle, n.static, n.proxy
+	l.previews, l.apps, l.refresh, l.referrer = n.previews, n.apps, n.refresh, n.referrer
+	l.conf.Strict, l.conf.Append, l.conf.Slashes, l.conf.Hosts = c.Strict, c.Append, c.Slashes, c.Hosts
+	l.conf.Proxies = c.Proxies
+	l.conf.Known, l.conf.Crawlers, l.conf.Signing, l.conf.Geo = c.Known, c.Crawlers, c.Signing, c.Geo
+	l.conf.Refresh, l.conf.Referrer, l.conf.Recycle, l.conf.Static = c.Refresh, c.Referrer, c.Recycle, c.Static
+	l.conf.Claim, l.conf.Search, l.conf.Popular, l.conf.Feed, l.conf.API = c.Claim, c.Search, c.Popular, c.Feed, c.API
+	f := make(features, len(c.Features))
+	for k, x := range c.Features {
+		f[k] = x
+	}
+	if x, ok := l.conf.Features["stats"]; ok {
+		f["stats"] = x
+	} else {
+		delete(f, "stats")
+	}
+	l.conf.Features = f
+	l.lock.Unlock()
+	return v, nil
+}
+func (l *Linker) reloaded() {
+	v, err := l.Reload()
+	if err != nil {
+		l.report.error("Unable to reload the configuration", err)
+		return
+	}
+	var s int
+	for i := range v {
+		if !v[i].Applied {
+			s++
+		}
+	}
+	os.Stderr.WriteString(
+		"Reloaded the configuration with " + strconv.Itoa(len(v)) + " changes (" + strconv.Itoa(s) +
+			" need a restart)!\n",
+	)
+}
+func (l *Linker) current() view {
+	return view{
+		hosts: l.hosts, static: l.static, proxy: l.proxy, referrer: l.referrer, claim: l.claim.path, find: l.find.path,
+		rank: l.rank.path, news: l.news.path, known: l.known, crawl: l.crawl, sign: l.sign, geo: l.geo,
+		refresh: l.refresh, strict: l.strict, slash: l.slash, previews: l.previews, apps: l.apps, append: l.append,
+	}
+}
+func changes(a, b config) []Change {
+	o, n := make(map[string]interface{}), make(map[string]interface{})
+	flatten(o, "", a)
+	flatten(n, "", b)
+	var v []Change
+	for k := range n {
+		if _, ok := o[k]; !ok {
+			o[k] = nil
+		}
+	}
+	for k, x := range o {
+		y := n[k]
+		if reflect.DeepEqual(x, y) {
+			continue
+		}
+		c := Change{Key: k}
+		if _, c.Applied = reloadable[k]; !c.Applied {
+			if i := strings.IndexByte(k, '.'); i > 0 {
+				_, c.Applied = reloadable[k[:i]]
+			}
+		}
+		if !hidden(k) {
+			c.Old, c.New = x, y
+		}
+		v = append(v, c)
+	}
+	sort.Slice(v, func(i, j int) bool { return v[i].Key < v[j].Key })
+	return v
+}
+func hidden(k string) bool {
+	if i := strings.LastIndexByte(k, '.'); i >= 0 {
+		k = k[i+1:]
+	}
+	for i := range secret {
+		if k == secret[i] {
+			return true
+		}
+	}
+	return false
+}
+func flatten(m map[string]interface{}, p string, v interface{}) {
+	if c, ok := v.(config); ok {
+		b, err := json.Marshal(c)
+		if err != nil {
+			return
+		}
+		var x interface{}
+		if json.Unmarshal(b, &x) != nil {
+			return
+		}
+		v = x
+	}
+	o, ok := v.(map[string]interface{})
+	if !ok || (len(o) == 0 && len(p) > 0) {
+		m[p] = v
+		return
+	}
+	for k, x := range o {
+		if len(p) > 0 {
+			k = p + "." + k
+		}
+		flatten(m, k, x)
+	}
+}
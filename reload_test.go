@@ -0,0 +1,107 @@
+// reload_test.go
+// URL Shortener with MySQL database.
+//
+// Copyright (C) 2020 iDigitalFlame
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+//
+
+package linker
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestReload(t *testing.T) {
+	l := newTest(t, new(memory), `{"normalize": {"enabled": true}}`)
+	b, err := json.Marshal(testConfig(t, `{
+		"static": {"docs": "HTTPS://Example.COM/Docs"}, "refresh": {"enabled": true},
+		"referrer_policy": "no-referrer", "recycle": {"cooldown": "1h"}, "proxies": ["10.0.0.0/8"],
+		"normalize": {"enabled": true, "tracking": true}
+	}`))
+	if err != nil {
+		t.Fatalf("unable to write configuration: %s", err)
+	}
+	if l.file = filepath.Join(t.TempDir(), "linker.conf"); ioutil.WriteFile(l.file, b, 0600) != nil {
+		t.Fatal("unable to write configuration")
+	}
+	v, err := l.Reload()
+	if err != nil {
+		t.Fatalf("unable to reload: %s", err)
+	}
+	e := map[string]bool{
+		"static": true, "static.docs": true, "refresh.enabled": true, "referrer_policy": true,
+		"recycle.cooldown": true, "proxies": true, "normalize.tracking": false,
+	}
+	if len(v) != len(e) {
+		t.Errorf("reload returned %d changes, expected %d: %+v", len(v), len(e), v)
+	}
+	for i := range v {
+		if a, ok := e[v[i].Key]; !ok || a != v[i].Applied {
+			t.Errorf("change %q was applied %t, expected it to be in %v", v[i].Key, v[i].Applied, e)
+		}
+	}
+	s := l.current()
+	// Static URLs use the running normalizer, so they are normalized even though "normalize" was changed.
+	if u := s.static["docs"]; u != "https://example.com/Docs" {
+		t.Errorf("static URL is %q, expected the normalized URL", u)
+	}
+	if !s.refresh.on || s.referrer != "no-referrer" || !s.proxy.contains("10.1.2.3") {
+		t.Errorf("refresh, referrer or proxies were not applied: %+v", s)
+	}
+	if l.recycle.wait != time.Hour {
+		t.Errorf("recycle cooldown is %s, expected 1h", l.recycle.wait)
+	}
+	if l.norm.utm {
+		t.Error("normalize values were applied without a restart")
+	}
+	if v, err = l.Reload(); err != nil || len(v) != 1 || v[0].Key != "normalize.tracking" {
+		t.Errorf("second reload returned %+v (%v), expected only the change that needs a restart", v, err)
+	}
+}
+func TestReloadSecret(t *testing.T) {
+	l := newTest(t, new(memory), "")
+	b, err := json.Marshal(testConfig(t, `{
+		"alerts": {"webhook": "https://hooks.example.com/T000/B000/sekret"}, "api": {"token": "sekret"},
+		"referrer_policy": "no-referrer"
+	}`))
+	if err != nil {
+		t.Fatalf("unable to write configuration: %s", err)
+	}
+	if l.file = filepath.Join(t.TempDir(), "linker.conf"); ioutil.WriteFile(l.file, b, 0600) != nil {
+		t.Fatal("unable to write configuration")
+	}
+	v, err := l.Reload()
+	if err != nil {
+		t.Fatalf("unable to reload: %s", err)
+	}
+	e := map[string]bool{"alerts.webhook": true, "api.token": true, "referrer_policy": false}
+	if len(v) != len(e) {
+		t.Errorf("reload returned %d changes, expected %d: %+v", len(v), len(e), v)
+	}
+	for i := range v {
+		h, ok := e[v[i].Key]
+		if !ok {
+			t.Errorf("unexpected change %q", v[i].Key)
+			continue
+		}
+		if s := v[i].Old != nil || v[i].New != nil; s == h {
+			t.Errorf("change %q has values %v and %v, expected them to be hidden %t", v[i].Key, v[i].Old, v[i].New, h)
+		}
+	}
+}
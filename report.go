@@ -0,0 +1,171 @@
+// report.go
+// URL Shortener with MySQL database.
+//
+// Copyright (C) 2020 iDigitalFlame
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+//
+
+package linker
+
+import (
+	"bytes"
+	"context"
+	crypto "crypto/rand"
+	hexenc "encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+const rollbarURL = "https://api.rollbar.com/api/1/item/"
+
+type event struct {
+	Extra       map[string]string `json:"extra,omitempty"`
+	Request     *eventRequest     `json:"request,omitempty"`
+	ID          string            `json:"event_id"`
+	Level       string            `json:"level"`
+	Logger      string            `json:"logger"`
+	Message     string            `json:"message"`
+	Platform    string            `json:"platform"`
+	Timestamp   string            `json:"timestamp"`
+	Environment string            `json:"environment,omitempty"`
+}
+type rollbar struct {
+	Token string      `json:"access_token"`
+	Data  rollbarData `json:"data"`
+}
+type reporter struct {
+	url    string
+	auth   string
+	token  string
+	env    string
+	sample float64
+}
+type rollbarData struct {
+	Body struct {
+		Message struct {
+			Body  string `json:"body"`
+			Stack string `json:"stack,omitempty"`
+		} `json:"message"`
+	} `json:"body"`
+	Request     *eventRequest `json:"request,omitempty"`
+	UUID        string        `json:"uuid"`
+	Level       string        `json:"level"`
+	Language    string        `json:"language"`
+	Environment string        `json:"environment"`
+	Timestamp   int64         `json:"timestamp"`
+}
+type reportConfig struct {
+	DSN         string  `json:"dsn"`
+	Rollbar     string  `json:"rollbar"`
+	Environment string  `json:"environment"`
+	Sample      float64 `json:"sample"`
+}
+type eventRequest struct {
+	URL    string `json:"url"`
+	Method string `json:"method"`
+}
+
+func (e *reporter) load(c reportConfig) error {
+	if c.Sample < 0 || c.Sample > 1 {
+		return &errval{s: "error reporting sample must be between 0 and 1"}
+	}
+	e.token, e.env, e.sample = c.Rollbar, c.Environment, c.Sample
+	if e.url, e.auth = "", ""; len(c.DSN) == 0 {
+		return nil
+	}
+	u, err := url.Parse(c.DSN)
+	if err != nil {
+		return &errval{s: "invalid error reporting DSN", e: err}
+	}
+	i := strings.LastIndexByte(u.Path, '/')
+	if u.User == nil || len(u.User.Username()) == 0 || len(u.Host) == 0 || i < 0 || i+1 >= len(u.Path) {
+		return &errval{s: "invalid error reporting DSN"}
+	}
+	e.url = u.Scheme + "://" + u.Host + u.Path[:i] + "/api/" + u.Path[i+1:] + "/store/"
+	e.auth = "Sentry sentry_version=7, sentry_client=linker/2, sentry_key=" + u.User.Username()
+	if s, ok := u.User.Password(); ok && len(s) > 0 {
+		e.auth += ", sentry_secret=" + s
+	}
+	return nil
+}
+func (e *reporter) error(s string, err error) {
+	if os.Stderr.WriteString(s + ": " + err.Error() + "!\n"); e == nil || (len(e.url) == 0 && len(e.token) == 0) {
+		return
+	}
+	if err == context.Canceled || (e.sample > 0 && rand.Float64() >= e.sample) {
+		return
+	}
+	e.report("error", s+": "+err.Error(), nil, nil)
+}
+func (e *reporter) panic(r *http.Request, v interface{}, s []byte) {
+	if len(e.url) == 0 && len(e.token) == 0 {
+		return
+	}
+	e.report("fatal", "panic: "+fmt.Sprint(v), &eventRequest{URL: r.URL.Path, Method: r.Method}, s)
+}
+func (e *reporter) report(l, m string, r *eventRequest, s []byte) {
+	var (
+		b [16]byte
+		t = time.Now().UTC()
+	)
+	crypto.Read(b[:])
+	if len(e.url) > 0 {
+		v := event{
+			ID: hexenc.EncodeToString(b[:]), Level: l, Logger: "linker", Message: m, Platform: "go",
+			Timestamp: t.Format("2006-01-02T15:04:05"), Environment: e.env, Request: r,
+		}
+		if len(s) > 0 {
+			v.Extra = map[string]string{"stack": string(s)}
+		}
+		go e.send(e.url, "X-Sentry-Auth", e.auth, v)
+	}
+	if len(e.token) > 0 {
+		v := rollbar{Token: e.token, Data: rollbarData{
+			UUID: hexenc.EncodeToString(b[:]), Level: l, Language: "go", Environment: e.env, Timestamp: t.Unix(), Request: r,
+		}}
+		if v.Data.Body.Message.Body, v.Data.Body.Message.Stack = m, string(s); l == "fatal" {
+			v.Data.Level = "critical"
+		}
+		if len(v.Data.Environment) == 0 {
+			v.Data.Environment = "production"
+		}
+		go e.send(rollbarURL, "X-Rollbar-Access-Token", e.token, v)
+	}
+}
+func (e *reporter) send(u, h, a string, v interface{}) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return
+	}
+	q, err := http.NewRequest(http.MethodPost, u, bytes.NewReader(b))
+	if err != nil {
+		return
+	}
+	q.Header.Set("Content-Type", "application/json")
+	q.Header.Set(h, a)
+	c := http.Client{Timeout: defaultTimeout}
+	r, err := c.Do(q)
+	if err != nil {
+		os.Stderr.WriteString("Unable to send error report: " + err.Error() + "!\n")
+		return
+	}
+	r.Body.Close()
+}
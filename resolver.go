@@ -0,0 +1,63 @@
+// resolver.go
+// URL Shortener with MySQL database.
+//
+// Copyright (C) 2020 iDigitalFlame
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+//
+
+package linker
+
+import "net/http"
+
+// Resolver is an interface that can be used to change how redirect names are resolved without changing Linker.
+// Resolvers are called for each redirect request in the order they were added with AddResolver.
+type Resolver interface {
+	// Before is called before the database lookup with the request and redirect name. It returns the name to
+	// lookup, which can be rewritten, and a URL. A non-empty URL is used as the destination and skips the database
+	// lookup and any later Resolvers. Returning false will veto the redirect and send the request to the default URL.
+	Before(*http.Request, string) (string, string, bool)
+	// After is called after the database lookup with the request, redirect name and destination URL. It returns
+	// the URL to use, which can be changed. Returning false will veto the redirect and send the request to the
+	// default URL.
+	After(*http.Request, string, string) (string, bool)
+}
+
+// AddResolver will add the supplied Resolvers to the redirect handler. Resolvers are called in the order they were
+// added. This function must be called before the Handler or Listen functions to take effect.
+func (l *Linker) AddResolver(r ...Resolver) {
+	l.resolvers = append(l.resolvers, r...)
+}
+func (l *Linker) before(r *http.Request, n string) (string, string, bool) {
+	for i := range l.resolvers {
+		v, u, ok := l.resolvers[i].Before(r, n)
+		if !ok || len(v) == 0 {
+			return "", "", false
+		}
+		if n = v; len(u) > 0 {
+			return n, u, true
+		}
+	}
+	return n, "", true
+}
+func (l *Linker) after(r *http.Request, n, u string) (string, bool) {
+	for i := range l.resolvers {
+		v, ok := l.resolvers[i].After(r, n, u)
+		if !ok || len(v) == 0 {
+			return "", false
+		}
+		u = v
+	}
+	return u, true
+}
@@ -0,0 +1,225 @@
+// retry.go
+// URL Shortener with MySQL database.
+//
+// Copyright (C) 2020 iDigitalFlame
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+//
+
+package linker
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"math/rand"
+	"net"
+	"syscall"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+const (
+	defaultBackoff    = 25 * time.Millisecond
+	defaultMaxBackoff = time.Second
+)
+
+// retried wraps a MySQL store and retries calls that fail with a transient error. Reads are retried on any
+// transient error, but changes are only retried when the server reports that the change was rolled back (deadlocks
+// and lock wait timeouts), as a lost connection cannot tell if the change was applied.
+type retried struct {
+	store
+	wait, max time.Duration
+	tries     uint32
+}
+type retryConfig struct {
+	Attempts uint32   `json:"attempts"`
+	Backoff  duration `json:"backoff"`
+	Max      duration `json:"max_backoff"`
+}
+
+func retry(d store, c retryConfig) store {
+	if _, ok := d.(*mysqlDB); !ok || c.Attempts < 2 {
+		return d
+	}
+	r := &retried{store: d, tries: c.Attempts, wait: time.Duration(c.Backoff), max: time.Duration(c.Max)}
+	if r.wait <= 0 {
+		r.wait = defaultBackoff
+	}
+	if r.max <= 0 {
+		r.max = defaultMaxBackoff
+	}
+	if r.max < r.wait {
+		r.max = r.wait
+	}
+	return r
+}
+func transient(err error, w bool) bool {
+	var m *mysql.MySQLError
+	if errors.As(err, &m) {
+		switch m.Number {
+		case 1205, 1213:
+			return true
+		case 1040, 1053, 1158, 1159, 1160, 1161, 2006, 2013:
+			return !w
+		}
+		return false
+	}
+	if w {
+		return false
+	}
+	if errors.Is(err, mysql.ErrInvalidConn) || errors.Is(err, driver.ErrBadConn) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return true
+	}
+	if errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.ECONNREFUSED) || errors.Is(err, syscall.EPIPE) {
+		return true
+	}
+	var n net.Error
+	return errors.As(err, &n) && n.Timeout()
+}
+func (r *retried) do(x context.Context, w bool, f func() error) error {
+	var err error
+	for i, d := uint32(1), r.wait; ; i++ {
+		if err = f(); err == nil || i >= r.tries || !transient(err, w) {
+			return err
+		}
+		t := time.NewTimer(d/2 + time.Duration(rand.Int63n(int64(d/2)+1)))
+		select {
+		case <-x.Done():
+			t.Stop()
+			return err
+		case <-t.C:
+		}
+		if d *= 2; d > r.max {
+			d = r.max
+		}
+	}
+}
+func (r *retried) add(n, u string) error {
+	return r.do(context.Background(), true, func() error { return r.store.add(n, u) })
+}
+func (r *retried) claim(n, u, o string, q int) error {
+	return r.do(context.Background(), true, func() error { return r.store.claim(n, u, o, q) })
+}
+func (r *retried) list() ([]Link, error) {
+	var v []Link
+	err := r.do(context.Background(), false, func() (err error) { v, err = r.store.list(); return })
+	return v, err
+}
+func (r *retried) filter(x context.Context, f filter) ([]Link, error) {
+	var v []Link
+	err := r.do(x, false, func() (err error) { v, err = r.store.filter(x, f); return })
+	return v, err
+}
+func (r *retried) delete(n string) error {
+	return r.do(context.Background(), true, func() error { return r.store.delete(n) })
+}
+func (r *retried) deleted(x context.Context, n string) (time.Time, string, error) {
+	var (
+		t time.Time
+		o string
+	)
+	err := r.do(x, false, func() (err error) { t, o, err = r.store.deleted(x, n); return })
+	return t, o, err
+}
+func (r *retried) update(n, u string) error {
+	return r.do(context.Background(), true, func() error { return r.store.update(n, u) })
+}
+func (r *retried) history(n string) ([]Version, error) {
+	var v []Version
+	err := r.do(context.Background(), false, func() (err error) { v, err = r.store.history(n); return })
+	return v, err
+}
+func (r *retried) rollback(n string, i uint64) error {
+	return r.do(context.Background(), true, func() error { return r.store.rollback(n, i) })
+}
+func (r *retried) setAppend(n string, a *bool) error {
+	return r.do(context.Background(), true, func() error { return r.store.setAppend(n, a) })
+}
+func (r *retried) setRefresh(n string, a *bool) error {
+	return r.do(context.Background(), true, func() error { return r.store.setRefresh(n, a) })
+}
+func (r *retried) setRollout(n string, v *Rollout) error {
+	return r.do(context.Background(), true, func() error { return r.store.setRollout(n, v) })
+}
+func (r *retried) setApp(n, a string) error {
+	return r.do(context.Background(), true, func() error { return r.store.setApp(n, a) })
+}
+func (r *retried) setMeta(n string, m *Meta) error {
+	return r.do(context.Background(), true, func() error { return r.store.setMeta(n, m) })
+}
+func (r *retried) setKey(n, k string) error {
+	return r.do(context.Background(), true, func() error { return r.store.setKey(n, k) })
+}
+func (r *retried) setReferrers(n string, v []string) error {
+	return r.do(context.Background(), true, func() error { return r.store.setReferrers(n, v) })
+}
+func (r *retried) setCountries(n string, v []string) error {
+	return r.do(context.Background(), true, func() error { return r.store.setCountries(n, v) })
+}
+func (r *retried) setSchedule(n string, v []Schedule) error {
+	return r.do(context.Background(), true, func() error { return r.store.setSchedule(n, v) })
+}
+func (r *retried) setHeaders(n string, v map[string]string) error {
+	return r.do(context.Background(), true, func() error { return r.store.setHeaders(n, v) })
+}
+func (r *retried) setOwner(n, o string) error {
+	return r.do(context.Background(), true, func() error { return r.store.setOwner(n, o) })
+}
+func (r *retried) top(x context.Context, n int) ([]Link, error) {
+	var v []Link
+	err := r.do(x, false, func() (err error) { v, err = r.store.top(x, n); return })
+	return v, err
+}
+func (r *retried) search(x context.Context, q string, n int) ([]Link, error) {
+	var v []Link
+	err := r.do(x, false, func() (err error) { v, err = r.store.search(x, q, n); return })
+	return v, err
+}
+func (r *retried) recent(x context.Context, n int) ([]Link, error) {
+	var v []Link
+	err := r.do(x, false, func() (err error) { v, err = r.store.recent(x, n); return })
+	return v, err
+}
+func (r *retried) get(x context.Context, n string) (record, error) {
+	var v record
+	err := r.do(x, false, func() (err error) { v, err = r.store.get(x, n); return })
+	return v, err
+}
+func (r *retried) hits(x context.Context, h map[string]uint64) error {
+	return r.do(x, true, func() error { return r.store.hits(x, h) })
+}
+func (r *retried) daily(x context.Context, d time.Time, h, u map[string]uint64) error {
+	return r.do(x, true, func() error { return r.store.daily(x, d, h, u) })
+}
+func (r *retried) visits(x context.Context, n string, d time.Time) ([]Day, error) {
+	var v []Day
+	err := r.do(x, false, func() (err error) { v, err = r.store.visits(x, n, d); return })
+	return v, err
+}
+func (r *retried) usage(x context.Context, f, t time.Time) ([]usage, error) {
+	var v []usage
+	err := r.do(x, false, func() (err error) { v, err = r.store.usage(x, f, t); return })
+	return v, err
+}
+func (r *retried) popular(x context.Context, d time.Time, n int) ([]Link, error) {
+	var v []Link
+	err := r.do(x, false, func() (err error) { v, err = r.store.popular(x, d, n); return })
+	return v, err
+}
+func (r *retried) purge(x context.Context, d time.Time) error {
+	return r.do(x, true, func() error { return r.store.purge(x, d) })
+}
@@ -0,0 +1,117 @@
+// rollout.go
+// URL Shortener with MySQL database.
+//
+// Copyright (C) 2020 iDigitalFlame
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+//
+
+package linker
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"math/rand"
+	"strconv"
+	"time"
+)
+
+// Rollout is a struct that represents a gradual change of the URL of a redirect. Requests are sent to the new URL
+// with a chance that starts at Percent when the rollout Start and grows to every request at the end of the Ramp
+// duration. The other requests are sent to the previous URL From.
+type Rollout struct {
+	Start   time.Time `json:"start"`
+	From    string    `json:"from"`
+	Ramp    duration  `json:"ramp"`
+	Percent uint8     `json:"percent"`
+}
+
+// Rollout will change the URL of the redirect with the supplied name like Update, but the new URL is only sent
+// to the supplied percent of requests at first, which grows to every request over the supplied duration. The
+// other requests are still sent to the previous URL, so a broken new URL only reaches some visitors and can be
+// reverted with Rollback or Update before the rollout is done. A duration of zero is the same as Update. This
+// function will return an error if the update fails, the percent is more than 100 or the name does not exist.
+func (l *Linker) Rollout(n, u string, d time.Duration, p uint8) error {
+	if d <= 0 {
+		return l.Update(n, u)
+	}
+	if l.db == nil {
+		return errNotConfigured
+	}
+	if !validName(n) {
+		return &errval{s: `name "` + n + `" contains invalid characters`}
+	}
+	if p > 100 {
+		return &errval{s: `invalid rollout percent "` + strconv.Itoa(int(p)) + `"`}
+	}
+	r, err := l.db.get(context.Background(), n)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return &errval{s: `name "` + n + `" does not exist`}
+		}
+		return err
+	}
+	return l.update(n, u, &Rollout{Start: time.Now().UTC(), From: r.url, Ramp: duration(d), Percent: p})
+}
+func (r *Rollout) pick(t time.Time, u string) string {
+	if r == nil || len(r.From) == 0 || r.Ramp <= 0 {
+		return u
+	}
+	e := t.Sub(r.Start)
+	if e >= time.Duration(r.Ramp) {
+		return u
+	}
+	if e < 0 {
+		e = 0
+	}
+	if rand.Float64()*100 < float64(r.Percent)+float64(100-r.Percent)*float64(e)/float64(r.Ramp) {
+		return u
+	}
+	return r.From
+}
+func rolled(f func(string) (string, error)) func(string) (string, error) {
+	return func(s string) (string, error) {
+		r := decodeRollout(s)
+		if r == nil || len(r.From) == 0 {
+			return s, nil
+		}
+		u, err := f(r.From)
+		if err != nil || u == r.From {
+			return s, err
+		}
+		r.From = u
+		return encodeRollout(r).String, nil
+	}
+}
+func encodeRollout(r *Rollout) sql.NullString {
+	if r == nil {
+		return sql.NullString{}
+	}
+	b, err := json.Marshal(r)
+	if err != nil {
+		return sql.NullString{}
+	}
+	return sql.NullString{String: string(b), Valid: true}
+}
+func decodeRollout(s string) *Rollout {
+	if len(s) == 0 {
+		return nil
+	}
+	var r Rollout
+	if json.Unmarshal([]byte(s), &r) != nil {
+		return nil
+	}
+	return &r
+}
@@ -0,0 +1,71 @@
+// rollout_test.go
+// URL Shortener with MySQL database.
+//
+// Copyright (C) 2020 iDigitalFlame
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+//
+
+package linker
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRolled(t *testing.T) {
+	f := rolled(func(s string) (string, error) {
+		if s == "bad" {
+			return "", errors.New("bad value")
+		}
+		return strings.ToUpper(s), nil
+	})
+	if r, err := f(""); err != nil || r != "" {
+		t.Errorf("empty rollout returned %q (%v), expected it unchanged", r, err)
+	}
+	s := encodeRollout(&Rollout{Start: time.Unix(0, 0).UTC(), From: "https://old", Ramp: duration(time.Hour)}).String
+	r, err := f(s)
+	if err != nil {
+		t.Fatalf("rollout returned an error: %s", err)
+	}
+	if v := decodeRollout(r); v == nil || v.From != "HTTPS://OLD" || v.Ramp != duration(time.Hour) {
+		t.Errorf("rollout was %q, expected only the From URL to change", r)
+	}
+	if r, err = f(encodeRollout(&Rollout{From: "bad"}).String); err == nil {
+		t.Errorf("rollout returned %q, expected an error", r)
+	}
+}
+func TestRolloutAlias(t *testing.T) {
+	r := &Rollout{Start: time.Now(), From: "https://example.com/old", Ramp: duration(time.Hour)}
+	d := &memory{links: map[string]record{
+		"new":   {url: "https://example.com/new", roll: r},
+		"alias": {url: aliasPrefix + "new"},
+		"roll":  {url: aliasPrefix + "new", roll: &Rollout{Start: time.Now(), From: aliasPrefix + "old", Ramp: r.Ramp}},
+		"old":   {url: "https://example.com/old"},
+	}}
+	h := newTest(t, d, "").Handler()
+	// A rollout that has just started with no percent sends every request to the previous URL.
+	for _, n := range [...]string{"new", "alias", "roll"} {
+		q := httptest.NewRequest(http.MethodGet, "/"+n, nil)
+		q.Header.Set("User-Agent", "Mozilla/5.0")
+		w := httptest.NewRecorder()
+		if h.ServeHTTP(w, q); w.Header().Get("Location") != r.From {
+			t.Errorf("%q redirected to %q, expected the rollout URL %q", n, w.Header().Get("Location"), r.From)
+		}
+	}
+}
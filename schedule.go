@@ -0,0 +1,202 @@
+// schedule.go
+// URL Shortener with MySQL database.
+//
+// Copyright (C) 2020 iDigitalFlame
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+//
+
+package linker
+
+import (
+	"database/sql"
+	"encoding/json"
+	"strings"
+	"time"
+)
+
+var days = [...]string{"sun", "mon", "tue", "wed", "thu", "fri", "sat"}
+
+// Schedule is a struct that represents a time window where a redirect goes to a different URL. The Start and
+// End values are times of day (such as "09:00"), where an End before the Start covers midnight and an End equal
+// to the Start covers the whole day. Days is a list of short day names (such as "mon") the window applies to,
+// which is every day when empty. The Zone is the IANA time zone name used for the window (such as
+// "America/New_York"), which is the local time zone when empty.
+type Schedule struct {
+	Zone  string   `json:"zone,omitempty"`
+	Days  []string `json:"days,omitempty"`
+	Start string   `json:"start"`
+	End   string   `json:"end"`
+	URL   string   `json:"url"`
+}
+type window struct {
+	loc        *time.Location
+	url        string
+	start, end int
+	days       uint8
+}
+
+// SetSchedule will change the schedule of the redirect with the supplied name. During a time window in the schedule
+// the redirect goes to the URL of the window instead, the first matching window is used. An empty schedule will
+// remove it. This function will return an error if the change fails, a window is invalid or the name does not
+// exist.
+func (l *Linker) SetSchedule(n string, s []Schedule) error {
+	if l.db == nil {
+		return errNotConfigured
+	}
+	if !validName(n) {
+		return &errval{s: `name "` + n + `" contains invalid characters`}
+	}
+	var v []Schedule
+	if len(s) > 0 {
+		v = make([]Schedule, len(s))
+	}
+	for i := range s {
+		v[i] = Schedule{Zone: s[i].Zone, Start: s[i].Start, End: s[i].End}
+		if _, err := clock(s[i].Start); err != nil {
+			return &errval{s: `invalid schedule start "` + s[i].Start + `"`, e: err}
+		}
+		if _, err := clock(s[i].End); err != nil {
+			return &errval{s: `invalid schedule end "` + s[i].End + `"`, e: err}
+		}
+		if _, err := time.LoadLocation(s[i].Zone); len(s[i].Zone) > 0 && err != nil {
+			return &errval{s: `invalid schedule zone "` + s[i].Zone + `"`, e: err}
+		}
+		for _, d := range s[i].Days {
+			if weekdays([]string{d}) == 0 {
+				return &errval{s: `invalid schedule day "` + d + `"`}
+			}
+			v[i].Days = append(v[i].Days, strings.ToLower(strings.TrimSpace(d)))
+		}
+		p, err := l.parse(s[i].URL)
+		if err != nil {
+			return err
+		}
+		v[i].URL = p
+	}
+	if err := l.db.setSchedule(n, v); err != nil {
+		return err
+	}
+	l.cache.remove(n)
+	return nil
+}
+func clock(s string) (int, error) {
+	t, err := time.Parse("15:04", strings.TrimSpace(s))
+	if err != nil {
+		return 0, err
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+func weekdays(v []string) uint8 {
+	var r uint8
+	for i := range v {
+		s := strings.ToLower(strings.TrimSpace(v[i]))
+		for d := range days {
+			if s == days[d] {
+				r |= 1 << uint(d)
+			}
+		}
+	}
+	return r
+}
+func encodeSchedule(s []Schedule) sql.NullString {
+	if len(s) == 0 {
+		return sql.NullString{}
+	}
+	b, err := json.Marshal(s)
+	if err != nil {
+		return sql.NullString{}
+	}
+	return sql.NullString{String: string(b), Valid: true}
+}
+func decodeSchedule(s string) []Schedule {
+	if len(s) == 0 {
+		return nil
+	}
+	var v []Schedule
+	if json.Unmarshal([]byte(s), &v) != nil {
+		return nil
+	}
+	return v
+}
+func rescheduled(f func(string) (string, error)) func(string) (string, error) {
+	return func(s string) (string, error) {
+		var (
+			v = decodeSchedule(s)
+			c bool
+		)
+		for i := range v {
+			u, err := f(v[i].URL)
+			if err != nil {
+				return s, err
+			}
+			if u != v[i].URL {
+				v[i].URL, c = u, true
+			}
+		}
+		if !c {
+			return s, nil
+		}
+		return encodeSchedule(v).String, nil
+	}
+}
+func windows(s []Schedule) []window {
+	if len(s) == 0 {
+		return nil
+	}
+	v := make([]window, 0, len(s))
+	for i := range s {
+		var (
+			w   = window{url: s[i].URL, loc: time.Local, days: weekdays(s[i].Days)}
+			err error
+		)
+		if w.start, err = clock(s[i].Start); err != nil {
+			continue
+		}
+		if w.end, err = clock(s[i].End); err != nil {
+			continue
+		}
+		if len(s[i].Zone) > 0 {
+			if w.loc, err = time.LoadLocation(s[i].Zone); err != nil {
+				continue
+			}
+		}
+		v = append(v, w)
+	}
+	return v
+}
+func scheduled(v []window, t time.Time) string {
+	for i := range v {
+		var (
+			n = t.In(v[i].loc)
+			m = n.Hour()*60 + n.Minute()
+		)
+		if v[i].days != 0 && v[i].days&(1<<uint(n.Weekday())) == 0 {
+			continue
+		}
+		if v[i].start == v[i].end {
+			return v[i].url
+		}
+		if v[i].start < v[i].end {
+			if m >= v[i].start && m < v[i].end {
+				return v[i].url
+			}
+			continue
+		}
+		if m >= v[i].start || m < v[i].end {
+			return v[i].url
+		}
+	}
+	return ""
+}
@@ -0,0 +1,143 @@
+// search.go
+// URL Shortener with MySQL database.
+//
+// Copyright (C) 2020 iDigitalFlame
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+//
+
+package linker
+
+import (
+	"context"
+	"html"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const defaultSearchLimit = 25
+
+type search struct {
+	path   string
+	header string
+	limit  int
+}
+type scored struct {
+	v []Link
+	s []int
+}
+type searchConfig struct {
+	Path   string `json:"path"`
+	Header string `json:"header"`
+	Limit  uint16 `json:"limit"`
+}
+
+func (s *search) load(c searchConfig) error {
+	if len(c.Path) == 0 {
+		return nil
+	}
+	if c.Path[0] != '/' || len(c.Path) == 1 {
+		return &errval{s: `invalid search page path "` + c.Path + `"`}
+	}
+	if s.path, s.header, s.limit = c.Path, c.Header, int(c.Limit); s.limit == 0 {
+		s.limit = defaultSearchLimit
+	}
+	return nil
+}
+func (s scored) Len() int {
+	return len(s.v)
+}
+func (s scored) Swap(i, j int) {
+	s.v[i], s.v[j], s.s[i], s.s[j] = s.v[j], s.v[i], s.s[j], s.s[i]
+}
+func (s scored) Less(i, j int) bool {
+	if s.s[i] == s.s[j] {
+		return s.v[i].Hits > s.v[j].Hits
+	}
+	return s.s[i] > s.s[j]
+}
+
+// Search will return up to the supplied number of redirects with names, URLs or preview titles and descriptions
+// matching the supplied query, with the best matches first. Redirects with a signing key or referrers are not
+// included. This function will return an error if the search fails.
+func (l *Linker) Search(q string, n int) ([]Link, error) {
+	if l.db == nil {
+		return nil, errNotConfigured
+	}
+	if q = strings.TrimSpace(q); len(q) == 0 || n <= 0 {
+		return nil, nil
+	}
+	x := l.ctx
+	if x == nil {
+		x = context.Background()
+	}
+	v, err := l.db.search(x, q, n)
+	if err != nil {
+		return nil, err
+	}
+	return visible(v), nil
+}
+func match(v []Link, q string, n int) []Link {
+	var (
+		t = strings.Fields(strings.ToLower(q))
+		r scored
+	)
+	for i := range v {
+		f := strings.ToLower(v[i].Name + "\n" + v[i].URL)
+		if v[i].Meta != nil {
+			f += strings.ToLower("\n" + v[i].Meta.Title + "\n" + v[i].Meta.Description)
+		}
+		var c int
+		for k := range t {
+			if strings.Contains(f, t[k]) {
+				c++
+			}
+		}
+		if c > 0 {
+			r.v, r.s = append(r.v, v[i]), append(r.s, c)
+		}
+	}
+	if sort.Sort(r); len(r.v) > n {
+		return r.v[:n]
+	}
+	return r.v
+}
+func (l *Linker) searched(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	l.lock.RLock()
+	c, p := l.find, l.proxy
+	if l.lock.RUnlock(); gated(w, r, c.header, p) {
+		return
+	}
+	q := r.URL.Query().Get("q")
+	v, err := l.Search(q, c.limit)
+	if err != nil {
+		l.report.error("Unable to search names", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	var b strings.Builder
+	q = html.EscapeString(q)
+	b.WriteString(`<form method="get"><input name="q" placeholder="search" value="` + q + `">`)
+	b.WriteString(`<button type="submit">Search</button></form>`)
+	if len(q) > 0 {
+		b.WriteString(`<p>` + strconv.Itoa(len(v)) + ` results for "` + q + `".</p>`)
+	}
+	results(w, r, "Search", b.String(), v)
+}
@@ -0,0 +1,131 @@
+// sign.go
+// URL Shortener with MySQL database.
+//
+// Copyright (C) 2020 iDigitalFlame
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+//
+
+package linker
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	hexenc "encoding/hex"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const defaultParam = "sig"
+
+type signer struct {
+	key      string
+	param    string
+	required bool
+}
+type signConfig struct {
+	Key      string `json:"key"`
+	Param    string `json:"param"`
+	Required bool   `json:"required"`
+}
+
+func (s *signer) load(c signConfig) error {
+	if s.key, s.param, s.required = c.Key, c.Param, c.Required; len(s.param) == 0 {
+		s.param = defaultParam
+	}
+	if s.required && len(s.key) == 0 {
+		return &errval{s: "signing is required but no signing key is set"}
+	}
+	return nil
+}
+
+// SetKey will change the signing key of the redirect with the supplied name. Requests for a redirect with a
+// signing key must contain a valid signature (see Sign) or they are sent to the default URL. An empty string will
+// remove the key, so the redirect only needs a signature when signing is required in the config. This function
+// will return an error if the change fails or the name does not exist.
+func (l *Linker) SetKey(n, k string) error {
+	if l.db == nil {
+		return errNotConfigured
+	}
+	if !validName(n) {
+		return &errval{s: `name "` + n + `" contains invalid characters`}
+	}
+	if err := l.db.setKey(n, k); err != nil {
+		return err
+	}
+	l.cache.remove(n)
+	return nil
+}
+
+// Sign will return the signed query string (such as "sig=1600000000.abcd...") to add to requests for the redirect
+// with the supplied name. The signature stops working after the supplied duration, or never expires when the
+// duration is zero. This function will return an error if the name does not exist or there is no signing key for
+// the redirect.
+func (l *Linker) Sign(n string, d time.Duration) (string, error) {
+	if l.db == nil {
+		return "", errNotConfigured
+	}
+	v, err := l.db.get(context.Background(), n)
+	if err != nil {
+		return "", &errval{s: `unable to get name "` + n + `"`, e: err}
+	}
+	l.lock.RLock()
+	k, p := v.key, l.sign.param
+	if len(k) == 0 {
+		k = l.sign.key
+	}
+	if l.lock.RUnlock(); len(k) == 0 {
+		return "", &errval{s: `name "` + n + `" does not have a signing key`}
+	}
+	var e int64
+	if d > 0 {
+		e = time.Now().Add(d).Unix()
+	}
+	return p + "=" + signature(k, n, e), nil
+}
+func strip(q, p string) string {
+	if len(q) == 0 {
+		return q
+	}
+	v := strings.Split(q, "&")
+	r := v[:0]
+	for i := range v {
+		if v[i] != p && !strings.HasPrefix(v[i], p+"=") {
+			r = append(r, v[i])
+		}
+	}
+	return strings.Join(r, "&")
+}
+func signature(k, n string, e int64) string {
+	t := strconv.FormatInt(e, 10)
+	h := hmac.New(sha256.New, []byte(k))
+	h.Write([]byte(n + "\n" + t))
+	return t + "." + hexenc.EncodeToString(h.Sum(nil))
+}
+func (s *signer) verify(k, n, v string) bool {
+	if len(k) == 0 {
+		k = s.key
+	}
+	i := strings.IndexByte(v, '.')
+	if i <= 0 || len(k) == 0 {
+		return false
+	}
+	e, err := strconv.ParseInt(v[:i], 10, 64)
+	if err != nil || e < 0 || (e > 0 && time.Now().Unix() > e) {
+		return false
+	}
+	return hmac.Equal([]byte(signature(k, n, e)), []byte(v))
+}
@@ -0,0 +1,235 @@
+// snapshot.go
+// URL Shortener with MySQL database.
+//
+// Copyright (C) 2020 iDigitalFlame
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+//
+
+package linker
+
+import (
+	"context"
+	"database/sql"
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+const snapshotCheck = time.Second
+
+var errReadOnly = &errval{s: "database is a read only snapshot"}
+
+// snapshotDB is a read only store that serves redirects from a snapshot file, such as the JSON or CSV output of
+// the list, with no database. The file is checked for changes at most once every snapshotCheck and reloaded
+// when it changes, so it can be replaced while running.
+type snapshotDB struct {
+	lock   sync.RWMutex
+	mod    time.Time
+	last   time.Time
+	path   string
+	links  []Link
+	names  map[string]record
+	report *reporter
+}
+
+func (*snapshotDB) close() error {
+	return nil
+}
+func (*snapshotDB) add(_, _ string) error {
+	return errReadOnly
+}
+func (*snapshotDB) claim(_, _, _ string, _ int) error {
+	return errReadOnly
+}
+func (s *snapshotDB) load() error {
+	i, err := os.Stat(s.path)
+	if err != nil {
+		return err
+	}
+	if s.last = time.Now(); i.ModTime().Equal(s.mod) {
+		return nil
+	}
+	f, err := os.Open(s.path)
+	if err != nil {
+		return err
+	}
+	v, err := ReadImport(f)
+	if f.Close(); err != nil {
+		return err
+	}
+	n := make(map[string]record, len(v))
+	for x := range v {
+		n[v[x].Name] = v[x].record()
+	}
+	sort.SliceStable(v, func(a, b int) bool { return v[a].Hits > v[b].Hits })
+	s.links, s.names, s.mod = v, n, i.ModTime()
+	return nil
+}
+func (s *snapshotDB) check() {
+	s.lock.RLock()
+	ok := time.Since(s.last) < snapshotCheck
+	if s.lock.RUnlock(); ok {
+		return
+	}
+	s.lock.Lock()
+	if time.Since(s.last) >= snapshotCheck {
+		if err := s.load(); err != nil {
+			s.report.error(`Unable to reload snapshot "`+s.path+`"`, err)
+		}
+	}
+	s.lock.Unlock()
+}
+func (s *snapshotDB) list() ([]Link, error) {
+	s.check()
+	s.lock.RLock()
+	v := append([]Link(nil), s.links...)
+	s.lock.RUnlock()
+	return v, nil
+}
+func (s *snapshotDB) filter(_ context.Context, f filter) ([]Link, error) {
+	s.check()
+	s.lock.RLock()
+	v := f.apply(s.links)
+	s.lock.RUnlock()
+	return v, nil
+}
+func (*snapshotDB) delete(_ string) error {
+	return errReadOnly
+}
+func (*snapshotDB) deleted(_ context.Context, _ string) (time.Time, string, error) {
+	return time.Time{}, "", sql.ErrNoRows
+}
+func (*snapshotDB) update(_, _ string) error {
+	return errReadOnly
+}
+func openSnapshot(d database) (*snapshotDB, error) {
+	if len(d.File) == 0 {
+		return nil, &errval{s: "invalid snapshot database configuration"}
+	}
+	s := &snapshotDB{path: d.File}
+	if err := s.load(); err != nil {
+		return nil, &errval{s: `unable to read snapshot "` + d.File + `"`, e: err}
+	}
+	return s, nil
+}
+func (*snapshotDB) setAppend(_ string, _ *bool) error {
+	return errReadOnly
+}
+func (*snapshotDB) setRefresh(_ string, _ *bool) error {
+	return errReadOnly
+}
+func (*snapshotDB) setRollout(_ string, _ *Rollout) error {
+	return errReadOnly
+}
+func (*snapshotDB) setApp(_, _ string) error {
+	return errReadOnly
+}
+func (*snapshotDB) setMeta(_ string, _ *Meta) error {
+	return errReadOnly
+}
+func (*snapshotDB) setKey(_, _ string) error {
+	return errReadOnly
+}
+func (*snapshotDB) setReferrers(_ string, _ []string) error {
+	return errReadOnly
+}
+func (*snapshotDB) setCountries(_ string, _ []string) error {
+	return errReadOnly
+}
+func (*snapshotDB) setSchedule(_ string, _ []Schedule) error {
+	return errReadOnly
+}
+func (*snapshotDB) setHeaders(_ string, _ map[string]string) error {
+	return errReadOnly
+}
+func (*snapshotDB) setOwner(_, _ string) error {
+	return errReadOnly
+}
+func (*snapshotDB) rollback(_ string, _ uint64) error {
+	return errReadOnly
+}
+func (*snapshotDB) history(_ string) ([]Version, error) {
+	return nil, nil
+}
+func (s *snapshotDB) top(_ context.Context, n int) ([]Link, error) {
+	s.check()
+	s.lock.RLock()
+	if n > len(s.links) {
+		n = len(s.links)
+	}
+	v := append([]Link(nil), s.links[:n]...)
+	s.lock.RUnlock()
+	return v, nil
+}
+func (s *snapshotDB) search(_ context.Context, q string, n int) ([]Link, error) {
+	s.check()
+	s.lock.RLock()
+	v := match(s.links, q, n)
+	s.lock.RUnlock()
+	return v, nil
+}
+func (s *snapshotDB) recent(_ context.Context, n int) ([]Link, error) {
+	s.check()
+	s.lock.RLock()
+	v := append([]Link(nil), s.links...)
+	s.lock.RUnlock()
+	sort.SliceStable(v, func(a, b int) bool {
+		if v[a].Created == nil || v[b].Created == nil {
+			return v[b].Created == nil && v[a].Created != nil
+		}
+		return v[a].Created.After(*v[b].Created)
+	})
+	if len(v) > n {
+		v = v[:n]
+	}
+	return v, nil
+}
+func (s *snapshotDB) get(_ context.Context, n string) (record, error) {
+	s.check()
+	s.lock.RLock()
+	r, ok := s.names[n]
+	if s.lock.RUnlock(); !ok {
+		return r, sql.ErrNoRows
+	}
+	return r, nil
+}
+func (*snapshotDB) hits(_ context.Context, _ map[string]uint64) error {
+	return nil
+}
+func (*snapshotDB) daily(_ context.Context, _ time.Time, _, _ map[string]uint64) error {
+	return nil
+}
+func (*snapshotDB) visits(_ context.Context, _ string, _ time.Time) ([]Day, error) {
+	return nil, nil
+}
+func (*snapshotDB) rewrite(_ func(string) (string, error)) (int, error) {
+	return 0, errReadOnly
+}
+func (*snapshotDB) resize(_, _ int) error {
+	return nil
+}
+func (*snapshotDB) verify(_ bool) ([]string, error) {
+	return nil, nil
+}
+func (*snapshotDB) usage(_ context.Context, _, _ time.Time) ([]usage, error) {
+	return nil, nil
+}
+func (s *snapshotDB) popular(x context.Context, _ time.Time, n int) ([]Link, error) {
+	return s.top(x, n)
+}
+func (*snapshotDB) purge(_ context.Context, _ time.Time) error {
+	return nil
+}
@@ -0,0 +1,267 @@
+// source.go
+// URL Shortener with MySQL database.
+//
+// Copyright (C) 2020 iDigitalFlame
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+//
+
+package linker
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"hash/fnv"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// sourceCheck is the time between checks of a HTTP configuration URL, and the time to wait before retrying a
+	// failed Consul or etcd watch.
+	sourceCheck = time.Minute
+	// sourceWait is the longest time a Consul watch request is blocked before it is sent again.
+	sourceWait = 5 * time.Minute
+)
+
+type source struct {
+	kind uint8
+	url  string
+	key  string
+}
+type etcdKV struct {
+	Value       string `json:"value"`
+	ModRevision string `json:"mod_revision"`
+}
+type etcdRange struct {
+	Header struct {
+		Revision string `json:"revision"`
+	} `json:"header"`
+	KVs []etcdKV `json:"kvs"`
+}
+type etcdWatch struct {
+	Result struct {
+		Events []struct {
+			KV etcdKV `json:"kv"`
+		} `json:"events"`
+		Canceled bool `json:"canceled"`
+	} `json:"result"`
+}
+
+const (
+	sourceFile uint8 = iota
+	sourceHTTP
+	sourceConsul
+	sourceEtcd
+)
+
+func locate(s string) (source, error) {
+	var (
+		k uint8
+		p = "http://"
+	)
+	switch i := strings.Index(s, "://"); {
+	case i <= 0:
+		return source{url: s}, nil
+	case strings.HasPrefix(s, "http://") || strings.HasPrefix(s, "https://"):
+		return source{kind: sourceHTTP, url: s}, nil
+	case strings.HasPrefix(s, "consul://"):
+		k = sourceConsul
+	case strings.HasPrefix(s, "consul+https://"):
+		k, p = sourceConsul, "https://"
+	case strings.HasPrefix(s, "etcd://"):
+		k = sourceEtcd
+	case strings.HasPrefix(s, "etcd+https://"):
+		k, p = sourceEtcd, "https://"
+	default:
+		return source{}, &errval{s: `unsupported configuration URL "` + s + `"`}
+	}
+	u, err := url.Parse(s)
+	if err != nil {
+		return source{}, &errval{s: `invalid configuration URL "` + s + `"`, e: err}
+	}
+	if len(u.Host) == 0 || len(strings.Trim(u.Path, "/")) == 0 {
+		return source{}, &errval{s: `configuration URL "` + s + `" does not contain a host and key`}
+	}
+	return source{kind: k, url: p + u.Host, key: strings.Trim(u.Path, "/")}, nil
+}
+func (s source) read(x context.Context) ([]byte, string, error) {
+	switch s.kind {
+	case sourceHTTP:
+		b, v, _, err := s.get(x, s.url, "")
+		return b, v, err
+	case sourceConsul:
+		b, v, _, err := s.get(x, s.url+"/v1/kv/"+s.key+"?raw", "")
+		return b, v, err
+	case sourceEtcd:
+		var r etcdRange
+		if err := s.post(x, "/v3/kv/range", map[string]string{"key": encode(s.key)}, &r); err != nil {
+			return nil, "", err
+		}
+		if len(r.KVs) == 0 {
+			return nil, "", &errval{s: `etcd key "` + s.key + `" does not exist`}
+		}
+		b, err := base64.StdEncoding.DecodeString(r.KVs[0].Value)
+		if err != nil {
+			return nil, "", &errval{s: `etcd key "` + s.key + `" has an invalid value`, e: err}
+		}
+		return b, r.Header.Revision, nil
+	}
+	b, err := ioutil.ReadFile(s.url)
+	return b, "", err
+}
+func (s source) get(x context.Context, u, v string) ([]byte, string, bool, error) {
+	q, err := http.NewRequestWithContext(x, http.MethodGet, u, nil)
+	if err != nil {
+		return nil, "", false, err
+	}
+	if len(v) > 0 && s.kind == sourceHTTP {
+		q.Header.Set("If-None-Match", v)
+	}
+	if t := os.Getenv("CONSUL_HTTP_TOKEN"); len(t) > 0 && s.kind == sourceConsul {
+		q.Header.Set("X-Consul-Token", t)
+	}
+	c := http.Client{Timeout: defaultTimeout}
+	if s.kind == sourceConsul {
+		c.Timeout = sourceWait + sourceWait/16 + defaultTimeout
+	}
+	r, err := c.Do(q)
+	if err != nil {
+		return nil, "", false, err
+	}
+	defer r.Body.Close()
+	switch {
+	case r.StatusCode == http.StatusNotModified:
+		return nil, v, false, nil
+	case r.StatusCode != http.StatusOK:
+		return nil, "", false, &errval{s: "configuration server returned status " + strconv.Itoa(r.StatusCode)}
+	}
+	if s.kind == sourceConsul {
+		v = r.Header.Get("X-Consul-Index")
+	} else {
+		v = r.Header.Get("ETag")
+	}
+	b, err := ioutil.ReadAll(io.LimitReader(r.Body, 1<<20))
+	if err == nil && len(v) == 0 {
+		h := fnv.New64a()
+		h.Write(b)
+		v = strconv.FormatUint(h.Sum64(), 16)
+	}
+	return b, v, true, err
+}
+func (s source) post(x context.Context, p string, v, o interface{}) error {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	q, err := http.NewRequestWithContext(x, http.MethodPost, s.url+p, bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+	q.Header.Set("Content-Type", "application/json")
+	c := http.Client{Timeout: defaultTimeout}
+	r, err := c.Do(q)
+	if err != nil {
+		return err
+	}
+	defer r.Body.Close()
+	if r.StatusCode != http.StatusOK {
+		return &errval{s: "configuration server returned status " + strconv.Itoa(r.StatusCode)}
+	}
+	return json.NewDecoder(r.Body).Decode(o)
+}
+func (s source) watch(x context.Context, e *reporter, v string, f func()) {
+	for {
+		n, err := s.wait(x, v)
+		if x.Err() != nil {
+			return
+		}
+		if err != nil {
+			e.error("Unable to watch the configuration", err)
+			n = v
+		}
+		if n != v {
+			f()
+		}
+		if v = n; err == nil && s.kind == sourceConsul {
+			continue
+		}
+		t := time.NewTimer(sourceCheck)
+		select {
+		case <-x.Done():
+			t.Stop()
+			return
+		case <-t.C:
+		}
+	}
+}
+func (s source) wait(x context.Context, v string) (string, error) {
+	switch s.kind {
+	case sourceHTTP:
+		_, n, _, err := s.get(x, s.url, v)
+		return n, err
+	case sourceConsul:
+		_, n, _, err := s.get(x, s.url+"/v1/kv/"+s.key+"?raw&wait="+sourceWait.String()+"&index="+v, "")
+		return n, err
+	case sourceEtcd:
+		return s.stream(x, v)
+	}
+	return v, nil
+}
+func (s source) stream(x context.Context, v string) (string, error) {
+	r := map[string]string{"key": encode(s.key)}
+	if n, err := strconv.ParseInt(v, 10, 64); err == nil {
+		r["start_revision"] = strconv.FormatInt(n+1, 10)
+	}
+	b, err := json.Marshal(map[string]interface{}{"create_request": r})
+	if err != nil {
+		return v, err
+	}
+	q, err := http.NewRequestWithContext(x, http.MethodPost, s.url+"/v3/watch", bytes.NewReader(b))
+	if err != nil {
+		return v, err
+	}
+	q.Header.Set("Content-Type", "application/json")
+	o, err := http.DefaultClient.Do(q)
+	if err != nil {
+		return v, err
+	}
+	defer o.Body.Close()
+	if o.StatusCode != http.StatusOK {
+		return v, &errval{s: "configuration server returned status " + strconv.Itoa(o.StatusCode)}
+	}
+	for d := json.NewDecoder(o.Body); ; {
+		var e etcdWatch
+		if err = d.Decode(&e); err != nil {
+			return v, err
+		}
+		if e.Result.Canceled {
+			return v, &errval{s: "etcd watch was canceled"}
+		}
+		if len(e.Result.Events) > 0 {
+			return e.Result.Events[len(e.Result.Events)-1].KV.ModRevision, nil
+		}
+	}
+}
+func encode(s string) string {
+	return base64.StdEncoding.EncodeToString([]byte(s))
+}
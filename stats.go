@@ -0,0 +1,230 @@
+// stats.go
+// URL Shortener with MySQL database.
+//
+// Copyright (C) 2020 iDigitalFlame
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+//
+
+package linker
+
+import (
+	"context"
+	crypto "crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"math/rand"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+const defaultInterval = 30 * time.Second
+
+// purgeInterval is how often daily hit counts older than the stats retention are removed.
+const purgeInterval = time.Hour
+
+// maxVisitors is the most visitor hashes kept for a day. Once reached, visitors that were not seen yet are
+// counted as unique every time.
+const maxVisitors = 1 << 20
+
+type stats struct {
+	lock     sync.Mutex
+	date     time.Time
+	hits     map[string]uint64
+	visits   map[string]uint64
+	seen     map[string]map[uint64]struct{}
+	salt     []byte
+	past     []tally
+	interval time.Duration
+	retain   time.Duration
+	count    int
+	day      int
+	bots     bool
+	dnt      bool
+}
+type tally struct {
+	date   time.Time
+	hits   map[string]uint64
+	visits map[string]uint64
+}
+type statsConfig struct {
+	Interval  duration `json:"interval"`
+	Retention duration `json:"retention"`
+	Enabled   bool     `json:"enabled"`
+	Bots      bool     `json:"bots"`
+	Uniques   bool     `json:"uniques"`
+	DNT       bool     `json:"dnt"`
+}
+
+func (s *stats) add(n, a string, r *http.Request) {
+	if s.hits == nil {
+		return
+	}
+	s.lock.Lock()
+	// Hits are kept apart for each UTC day, so hits counted before midnight are saved to the previous day even when
+	// they are flushed after it.
+	if d := today(); !d.Equal(s.date) {
+		if len(s.hits) > 0 {
+			s.past = append(s.past, tally{date: s.date, hits: s.hits, visits: s.visits})
+			if s.hits = make(map[string]uint64); s.visits != nil {
+				s.visits = make(map[string]uint64)
+			}
+		}
+		s.date = d
+	}
+	// Requests that opt out of tracking are still counted as a hit, but not as a visitor.
+	if s.hits[n]++; s.visits != nil && !(s.dnt && optout(r)) {
+		s.visit(n, a, r)
+	}
+	s.lock.Unlock()
+}
+func (s *stats) merge(t tally) {
+	e := tally{date: s.date, hits: s.hits, visits: s.visits}
+	if !t.date.Equal(s.date) {
+		i := sort.Search(len(s.past), func(i int) bool { return !s.past[i].date.Before(t.date) })
+		if i == len(s.past) || !s.past[i].date.Equal(t.date) {
+			s.past = append(s.past, tally{})
+			copy(s.past[i+1:], s.past[i:])
+			s.past[i] = t
+			return
+		}
+		e = s.past[i]
+	}
+	for k, v := range t.hits {
+		e.hits[k] += v
+	}
+	if e.visits == nil {
+		return
+	}
+	for k, v := range t.visits {
+		e.visits[k] += v
+	}
+}
+func optout(r *http.Request) bool {
+	return r.Header.Get("DNT") == "1" || r.Header.Get("Sec-GPC") == "1"
+}
+func today() time.Time {
+	y, m, d := time.Now().UTC().Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, time.UTC)
+}
+func (s *stats) visit(n, a string, r *http.Request) {
+	if d := time.Now().UTC().YearDay(); d != s.day || s.seen == nil {
+		if _, err := crypto.Read(s.salt); err != nil {
+			return
+		}
+		s.day, s.count, s.seen = d, 0, make(map[string]map[uint64]struct{})
+	}
+	h := sha256.New()
+	h.Write(s.salt)
+	h.Write([]byte(a + "\n" + r.UserAgent()))
+	var (
+		k = binary.BigEndian.Uint64(h.Sum(nil))
+		m = s.seen[n]
+	)
+	if m == nil {
+		m = make(map[uint64]struct{})
+		s.seen[n] = m
+	}
+	if _, ok := m[k]; ok {
+		return
+	}
+	if s.count < maxVisitors {
+		m[k] = struct{}{}
+		s.count++
+	}
+	s.visits[n]++
+}
+func (s *stats) load(c statsConfig) {
+	if !c.Enabled {
+		return
+	}
+	s.retain, s.dnt = time.Duration(c.Retention), c.DNT
+	if s.bots, s.interval = c.Bots, time.Duration(c.Interval); s.interval <= 0 {
+		s.interval = defaultInterval
+	}
+	if s.hits, s.date = make(map[string]uint64), today(); c.Uniques {
+		s.visits, s.salt = make(map[string]uint64), make([]byte, 32)
+	}
+}
+func (l *Linker) count(x context.Context) {
+	var (
+		t = time.NewTimer(jitter(l.stats.interval))
+		p time.Time
+	)
+	for {
+		select {
+		case <-x.Done():
+			t.Stop()
+			return
+		case <-t.C:
+		}
+		if err := l.flush(x); err != nil {
+			l.report.error("Unable to save link hit counts", err)
+		}
+		if l.stats.retain > 0 && time.Since(p) >= purgeInterval {
+			if err := l.db.purge(x, today().Add(-l.stats.retain)); err != nil {
+				l.report.error("Unable to purge old daily hit counts", err)
+			}
+			p = time.Now()
+		}
+		t.Reset(jitter(l.stats.interval))
+	}
+}
+func jitter(d time.Duration) time.Duration {
+	return d - d/5 + time.Duration(rand.Int63n(int64(d/5)*2+1))
+}
+func (l *Linker) flush(x context.Context) error {
+	if l.stats.hits == nil || l.db == nil {
+		return nil
+	}
+	l.stats.lock.Lock()
+	v := append(l.stats.past, tally{date: l.stats.date, hits: l.stats.hits, visits: l.stats.visits})
+	if l.stats.past, l.stats.hits = nil, make(map[string]uint64, len(l.stats.hits)); l.stats.visits != nil {
+		l.stats.visits = make(map[string]uint64, len(l.stats.visits))
+	}
+	l.stats.lock.Unlock()
+	h := v[0].hits
+	if len(v) > 1 {
+		h = make(map[string]uint64)
+		for i := range v {
+			for k, c := range v[i].hits {
+				h[k] += c
+			}
+		}
+	}
+	if l.alerts.check(h); len(h) == 0 {
+		return nil
+	}
+	if err := l.db.hits(x, h); err != nil {
+		// The daily and unique counts are put back with the hits, so they are saved by the next flush instead of
+		// being lost.
+		l.stats.lock.Lock()
+		for i := range v {
+			l.stats.merge(v[i])
+		}
+		l.stats.lock.Unlock()
+		return err
+	}
+	for i := range v {
+		if len(v[i].hits) == 0 {
+			continue
+		}
+		if err := l.db.daily(x, v[i].date, v[i].hits, v[i].visits); err != nil {
+			l.report.error("Unable to save daily link hit counts", err)
+		}
+	}
+	return nil
+}
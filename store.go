@@ -0,0 +1,104 @@
+// store.go
+// URL Shortener with MySQL database.
+//
+// Copyright (C) 2020 iDigitalFlame
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+//
+
+package linker
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"time"
+)
+
+type store interface {
+	close() error
+	add(string, string) error
+	claim(string, string, string, int) error
+	list() ([]Link, error)
+	filter(context.Context, filter) ([]Link, error)
+	delete(string) error
+	deleted(context.Context, string) (time.Time, string, error)
+	update(string, string) error
+	history(string) ([]Version, error)
+	rollback(string, uint64) error
+	setAppend(string, *bool) error
+	setRefresh(string, *bool) error
+	setRollout(string, *Rollout) error
+	setApp(string, string) error
+	setMeta(string, *Meta) error
+	setKey(string, string) error
+	setReferrers(string, []string) error
+	setCountries(string, []string) error
+	setSchedule(string, []Schedule) error
+	setHeaders(string, map[string]string) error
+	setOwner(string, string) error
+	top(context.Context, int) ([]Link, error)
+	search(context.Context, string, int) ([]Link, error)
+	recent(context.Context, int) ([]Link, error)
+	get(context.Context, string) (record, error)
+	hits(context.Context, map[string]uint64) error
+	daily(context.Context, time.Time, map[string]uint64, map[string]uint64) error
+	visits(context.Context, string, time.Time) ([]Day, error)
+	usage(context.Context, time.Time, time.Time) ([]usage, error)
+	rewrite(func(string) (string, error)) (int, error)
+	verify(bool) ([]string, error)
+	resize(int, int) error
+	popular(context.Context, time.Time, int) ([]Link, error)
+	purge(context.Context, time.Time) error
+}
+type record struct {
+	meta    *Meta
+	heads   map[string]string
+	refs    []string
+	geo     []string
+	sched   []window
+	url     string
+	app     string
+	key     string
+	append  sql.NullBool
+	refresh sql.NullBool
+	roll    *Rollout
+}
+
+func open(d database) (store, error) {
+	switch strings.ToLower(d.Driver) {
+	case "", "mysql":
+		return openMySQL(d)
+	case "bolt", "bbolt":
+		return openBolt(d)
+	case "snapshot":
+		return openSnapshot(d)
+	case "memory":
+		return openMemory(), nil
+	}
+	return nil, &errval{s: `unsupported database driver "` + d.Driver + `"`}
+}
+func (e Link) record() record {
+	r := record{
+		url: e.URL, app: e.App, key: e.Key, meta: e.Meta, refs: e.Referrers, sched: windows(e.Schedule), heads: e.Headers,
+		roll: e.Rollout, geo: e.Countries,
+	}
+	if e.Append != nil {
+		r.append.Valid, r.append.Bool = true, *e.Append
+	}
+	if e.Refresh != nil {
+		r.refresh.Valid, r.refresh.Bool = true, *e.Refresh
+	}
+	return r
+}
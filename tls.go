@@ -0,0 +1,121 @@
+// tls.go
+// URL Shortener with MySQL database.
+//
+// Copyright (C) 2020 iDigitalFlame
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+//
+
+package linker
+
+import (
+	"crypto/tls"
+	"strings"
+)
+
+// ciphers is a list of the TLS 1.2 cipher suites that can be used in the "tls" config, in order of preference.
+// The default suites are the AEAD suites with forward secrecy. TLS 1.3 cipher suites are always enabled and cannot
+// be changed.
+var ciphers = [...]struct {
+	name      string
+	id        uint16
+	def, fips bool
+}{
+	{"TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384", tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384, true, true},
+	{"TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384", tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384, true, true},
+	{"TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305", tls.TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305, true, false},
+	{"TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305", tls.TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305, true, false},
+	{"TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256", tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256, true, true},
+	{"TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256", tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256, true, true},
+	{"TLS_ECDHE_ECDSA_WITH_AES_256_CBC_SHA", tls.TLS_ECDHE_ECDSA_WITH_AES_256_CBC_SHA, false, false},
+	{"TLS_ECDHE_RSA_WITH_AES_256_CBC_SHA", tls.TLS_ECDHE_RSA_WITH_AES_256_CBC_SHA, false, false},
+	{"TLS_ECDHE_ECDSA_WITH_AES_128_CBC_SHA", tls.TLS_ECDHE_ECDSA_WITH_AES_128_CBC_SHA, false, false},
+	{"TLS_ECDHE_RSA_WITH_AES_128_CBC_SHA", tls.TLS_ECDHE_RSA_WITH_AES_128_CBC_SHA, false, false},
+	{"TLS_RSA_WITH_AES_256_GCM_SHA384", tls.TLS_RSA_WITH_AES_256_GCM_SHA384, false, true},
+	{"TLS_RSA_WITH_AES_128_GCM_SHA256", tls.TLS_RSA_WITH_AES_128_GCM_SHA256, false, true},
+}
+
+type tlsConfig struct {
+	Min     string   `json:"min_version"`
+	Ciphers []string `json:"ciphers"`
+	Curves  []string `json:"curves"`
+	FIPS    bool     `json:"fips"`
+}
+
+func (c tlsConfig) config() (*tls.Config, error) {
+	t := &tls.Config{NextProtos: []string{"h2", "http/1.1"}, PreferServerCipherSuites: true}
+	switch c.Min {
+	case "1.0":
+		t.MinVersion = tls.VersionTLS10
+	case "1.1":
+		t.MinVersion = tls.VersionTLS11
+	case "", "1.2":
+		t.MinVersion = tls.VersionTLS12
+	case "1.3":
+		t.MinVersion = tls.VersionTLS13
+	default:
+		return nil, &errval{s: `invalid TLS minimum version "` + c.Min + `"`}
+	}
+	if c.FIPS && t.MinVersion < tls.VersionTLS12 {
+		return nil, &errval{s: "FIPS mode requires a TLS minimum version of 1.2 or higher"}
+	}
+	if len(c.Ciphers) == 0 {
+		for i := range ciphers {
+			if ciphers[i].def && (!c.FIPS || ciphers[i].fips) {
+				t.CipherSuites = append(t.CipherSuites, ciphers[i].id)
+			}
+		}
+	}
+loop:
+	for _, n := range c.Ciphers {
+		for i := range ciphers {
+			if !strings.EqualFold(n, ciphers[i].name) {
+				continue
+			}
+			if c.FIPS && !ciphers[i].fips {
+				return nil, &errval{s: `TLS cipher suite "` + n + `" is not allowed in FIPS mode`}
+			}
+			t.CipherSuites = append(t.CipherSuites, ciphers[i].id)
+			continue loop
+		}
+		return nil, &errval{s: `invalid TLS cipher suite "` + n + `"`}
+	}
+	if len(c.Curves) == 0 {
+		if c.FIPS {
+			t.CurvePreferences = []tls.CurveID{tls.CurveP256, tls.CurveP384}
+		} else {
+			t.CurvePreferences = []tls.CurveID{tls.CurveP256, tls.X25519}
+		}
+	}
+	for _, n := range c.Curves {
+		var v tls.CurveID
+		switch strings.ToUpper(n) {
+		case "P256", "P-256":
+			v = tls.CurveP256
+		case "P384", "P-384":
+			v = tls.CurveP384
+		case "P521", "P-521":
+			v = tls.CurveP521
+		case "X25519":
+			if c.FIPS {
+				return nil, &errval{s: `TLS curve "` + n + `" is not allowed in FIPS mode`}
+			}
+			v = tls.X25519
+		default:
+			return nil, &errval{s: `invalid TLS curve "` + n + `"`}
+		}
+		t.CurvePreferences = append(t.CurvePreferences, v)
+	}
+	return t, nil
+}
@@ -0,0 +1,48 @@
+// version.go
+// URL Shortener with MySQL database.
+//
+// Copyright (C) 2020 iDigitalFlame
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+//
+
+package linker
+
+import "runtime"
+
+// These values contain the build information of Linker. They are set at build time with the linker flags, such as
+// '-ldflags "-X github.com/iDigitalFlame/linker.Commit=$(git rev-parse --short HEAD)"'.
+var (
+	Release = "v2"
+	Commit  = "unknown"
+	Built   = "unknown"
+)
+
+// Build is a struct that contains the version and build information of Linker.
+type Build struct {
+	Version string `json:"version"`
+	Commit  string `json:"commit"`
+	Built   string `json:"built"`
+	Go      string `json:"go"`
+}
+
+// Info will return the version and build information of Linker.
+func Info() Build {
+	return Build{Version: Release, Commit: Commit, Built: Built, Go: runtime.Version()}
+}
+
+// String will return the build information as a single line, such as "v2 (commit 1a2b3c4, built 2020-06-01, go1.13)".
+func (b Build) String() string {
+	return b.Version + " (commit " + b.Commit + ", built " + b.Built + ", " + b.Go + ")"
+}
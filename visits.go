@@ -0,0 +1,56 @@
+// visits.go
+// URL Shortener with MySQL database.
+//
+// Copyright (C) 2020 iDigitalFlame
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+//
+
+package linker
+
+import (
+	"context"
+	"time"
+)
+
+// Day is a struct that represents the hits of a redirect name on a single day (in UTC). The Uniques count is
+// only tracked when the "uniques" stats option is enabled and is estimated from a salted hash of each visitor's
+// address and user agent. The salt is random, only kept in memory and replaced each day, so visitors cannot be
+// linked across days and no addresses are stored.
+type Day struct {
+	Date    time.Time `json:"date"`
+	Hits    uint64    `json:"hits"`
+	Uniques uint64    `json:"uniques"`
+}
+
+// Visits will return the daily hits and unique visitors of the supplied redirect name over the last number of
+// days (including today, in UTC), ordered from newest to oldest. A day count of zero returns all recorded days.
+// Days without hits are not included. This function will return an error if the lookup fails.
+func (l *Linker) Visits(n string, d int) ([]Day, error) {
+	if l.db == nil {
+		return nil, errNotConfigured
+	}
+	if !validName(n) {
+		return nil, &errval{s: `name "` + n + `" contains invalid characters`}
+	}
+	x := l.ctx
+	if x == nil {
+		x = context.Background()
+	}
+	var s time.Time
+	if d > 0 {
+		s = time.Now().UTC().AddDate(0, 0, 1-d)
+	}
+	return l.db.visits(x, n, s)
+}
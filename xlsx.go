@@ -0,0 +1,122 @@
+// xlsx.go
+// URL Shortener with MySQL database.
+//
+// Copyright (C) 2020 iDigitalFlame
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+//
+
+package linker
+
+import (
+	"archive/zip"
+	"encoding/xml"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// xlsxParts are the fixed parts of a workbook with a single sheet, which is written after them as
+// "xl/worksheets/sheet1.xml".
+var xlsxParts = [...]struct {
+	name, data string
+}{
+	{"[Content_Types].xml", xml.Header + `<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">` +
+		`<Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/>` +
+		`<Default Extension="xml" ContentType="application/xml"/>` +
+		`<Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.` +
+		`spreadsheetml.sheet.main+xml"/><Override PartName="/xl/worksheets/sheet1.xml" ContentType="application/` +
+		`vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/></Types>`},
+	{"_rels/.rels", xml.Header + `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+		`<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/` +
+		`officeDocument" Target="xl/workbook.xml"/></Relationships>`},
+	{"xl/workbook.xml", xml.Header + `<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" ` +
+		`xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships"><sheets>` +
+		`<sheet name="Linker" sheetId="1" r:id="rId1"/></sheets></workbook>`},
+	{"xl/_rels/workbook.xml.rels", xml.Header + `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/` +
+		`relationships"><Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/` +
+		`relationships/worksheet" Target="worksheets/sheet1.xml"/></Relationships>`},
+}
+
+func writeXLSX(w io.Writer, h []string, r [][]string) error {
+	z := zip.NewWriter(w)
+	for i := range xlsxParts {
+		f, err := z.Create(xlsxParts[i].name)
+		if err == nil {
+			_, err = io.WriteString(f, xlsxParts[i].data)
+		}
+		if err != nil {
+			return &errval{s: "unable to write XLSX output", e: err}
+		}
+	}
+	// Columns that only contain (non zero padded) numbers, such as hit counts, are written as numbers so they can
+	// be added up. Every other cell is written as an inline string.
+	n := make([]bool, len(h))
+	for x := range n {
+		n[x] = len(r) > 0
+		for i := 0; i < len(r) && n[x]; i++ {
+			n[x] = x < len(r[i]) && number(r[i][x])
+		}
+	}
+	var b strings.Builder
+	b.WriteString(xml.Header + `<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData>`)
+	cells(&b, 1, h, nil)
+	for i := range r {
+		cells(&b, i+2, r[i], n)
+	}
+	b.WriteString("</sheetData></worksheet>")
+	f, err := z.Create("xl/worksheets/sheet1.xml")
+	if err == nil {
+		if _, err = io.WriteString(f, b.String()); err == nil {
+			err = z.Close()
+		}
+	}
+	if err != nil {
+		return &errval{s: "unable to write XLSX output", e: err}
+	}
+	return nil
+}
+func cells(b *strings.Builder, i int, v []string, n []bool) {
+	s := strconv.Itoa(i)
+	b.WriteString(`<row r="` + s + `">`)
+	for x := range v {
+		b.WriteString(`<c r="` + cell(x) + s + `"`)
+		if x < len(n) && n[x] {
+			b.WriteString("><v>" + v[x] + "</v></c>")
+			continue
+		}
+		b.WriteString(` t="inlineStr"><is><t xml:space="preserve">`)
+		xml.EscapeText(b, []byte(v[x]))
+		b.WriteString("</t></is></c>")
+	}
+	b.WriteString("</row>")
+}
+func cell(x int) string {
+	var s string
+	for x++; x > 0; x = (x - 1) / 26 {
+		s = string(rune('A'+(x-1)%26)) + s
+	}
+	return s
+}
+func number(s string) bool {
+	if len(s) == 0 || len(s) > 15 || (len(s) > 1 && s[0] == '0') {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		if s[i] < '0' || s[i] > '9' {
+			return false
+		}
+	}
+	return true
+}